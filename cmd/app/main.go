@@ -2,6 +2,7 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"net/http"
 	"os"
@@ -9,18 +10,30 @@ import (
 	"syscall"
 	"time"
 
+	"test2auth/domain"
+	"test2auth/internal/audit"
 	"test2auth/internal/config"
+	"test2auth/internal/geoip"
 	authhttp "test2auth/internal/handler/http"
+	"test2auth/internal/janitor"
+	"test2auth/internal/jwtkeys"
+	"test2auth/internal/lockout"
+	"test2auth/internal/metrics"
+	"test2auth/internal/policy"
+	"test2auth/internal/ratelimit"
 	"test2auth/internal/service"
-	"test2auth/internal/storage/postgres"
+	appstorage "test2auth/internal/storage"
+	"test2auth/internal/tracing"
+	"test2auth/internal/useragent"
+	"test2auth/internal/webhook"
 
 	_ "test2auth/docs" // swag init
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
-	"github.com/golang-migrate/migrate/v4"
-	_ "github.com/golang-migrate/migrate/v4/database/postgres"
-	_ "github.com/golang-migrate/migrate/v4/source/file"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/collectors"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	httpSwagger "github.com/swaggo/http-swagger"
 )
 
@@ -30,19 +43,191 @@ import (
 // @host localhost:8080
 // @BasePath /
 func main() {
+	command := "serve"
+	args := os.Args[1:]
+	if len(args) > 0 {
+		command, args = args[0], args[1:]
+	}
+
+	switch command {
+	case "serve":
+		serve()
+	case "migrate":
+		os.Exit(migrateCommand(args))
+	default:
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", command, usage)
+		os.Exit(2)
+	}
+}
+
+func serve() {
 	cfg := config.MustLoad()
 
 	log := setupLogger(cfg.Env)
 
 	log.Info("starting application", slog.String("env", cfg.Env))
 
-	storage, err := postgres.New(cfg.StorageURL)
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config{
+		Exporter:    cfg.Tracing.Exporter,
+		Endpoint:    cfg.Tracing.Endpoint,
+		Insecure:    cfg.Tracing.Insecure,
+		ServiceName: cfg.Tracing.ServiceName,
+		SampleRatio: cfg.Tracing.SampleRatio,
+	})
+	if err != nil {
+		log.Error("failed to init tracing", "error", err)
+		os.Exit(1)
+	}
+
+	if cfg.AutoMigrate {
+		if err := migrateUp(cfg.StorageURL, log); err != nil {
+			log.Error("failed to apply migrations", "error", err)
+			os.Exit(1)
+		}
+	}
+
+	storage, err := appstorage.Open(cfg.StorageURL, log)
 	if err != nil {
 		log.Error("failed to init storage", "error", err)
 		os.Exit(1)
 	}
 
-	runMigrations(cfg.StorageURL, log)
+	auditLog := audit.NewLog(storage, audit.NewChain(cfg.Audit.HMACKey), log)
+
+	registry := prometheus.NewRegistry()
+	registry.MustRegister(
+		collectors.NewGoCollector(),
+		collectors.NewProcessCollector(collectors.ProcessCollectorOpts{}),
+	)
+	if pool, ok := storage.(metrics.PoolStater); ok {
+		registry.MustRegister(metrics.NewPoolCollector(pool))
+	}
+
+	refreshPolicy, err := newPolicy(cfg.Policy)
+	if err != nil {
+		log.Error("failed to init security policy", "error", err)
+		os.Exit(1)
+	}
+
+	uaMatch, err := useragent.ParseStrictness(cfg.Policy.UserAgentMatch)
+	if err != nil {
+		log.Error("failed to init security policy", "error", err)
+		os.Exit(1)
+	}
+
+	if cfg.JWT.RefreshGracePeriod > 0 && cfg.JWT.RefreshTokenKey == "" {
+		log.Error("jwt.refresh_grace_period needs jwt.refresh_token_key (REFRESH_TOKEN_KEY)")
+		os.Exit(1)
+	}
+
+	var keyStore jwtkeys.Store
+	if store, ok := storage.(jwtkeys.Store); ok {
+		keyStore = store
+	}
+	signingKeys := jwtkeys.NewSet(cfg.JWT.Secret, keyStore,
+		jwtkeys.WithKeyEncryptionKey(cfg.JWT.KeysEncryptionKey),
+		jwtkeys.WithRequireKID(cfg.JWT.RequireKID),
+	)
+	if err := signingKeys.Reload(context.Background()); err != nil {
+		log.Error("failed to load signing keys", "error", err)
+		os.Exit(1)
+	}
+	if cfg.JWT.RequireKID && !signingKeys.Active() {
+		log.Error("jwt.require_kid needs an active signing key, rotate one with authctl first")
+		os.Exit(1)
+	}
+
+	webhookOpts := []webhook.Option{
+		webhook.WithTimeout(cfg.Webhook.Timeout),
+		webhook.WithQueueSize(cfg.Webhook.QueueSize),
+	}
+	if store, ok := storage.(webhook.Store); ok {
+		webhookOpts = append(webhookOpts, webhook.WithStore(store))
+	}
+	webhooks := webhook.NewSender(cfg.WebhookURL, log, webhookOpts...)
+
+	// janitorTasks purge rows of shared stores that are keyed by clients or
+	// only kept for a while.
+	var janitorTasks []janitor.Task
+	if purger, ok := storage.(webhook.Purger); ok && cfg.Webhook.Retention > 0 {
+		janitorTasks = append(janitorTasks, janitor.Task{
+			Name: "webhook_deliveries",
+			Delete: func(ctx context.Context, now time.Time, limit int) (int64, error) {
+				return purger.DeleteWebhookDeliveries(ctx, now.Add(-cfg.Webhook.Retention), limit)
+			},
+		})
+	}
+
+	opts := []service.Option{
+		service.WithSigningKeys(signingKeys),
+		service.WithWebhookSender(webhooks),
+		service.WithAuditor(auditLog),
+		service.WithMetrics(metrics.NewAuth(registry)),
+		service.WithPolicy(refreshPolicy),
+		service.WithUserAgentMatch(uaMatch),
+		service.WithSessionLifetime(cfg.JWT.SessionIdleTimeout, cfg.JWT.SessionMaxLifetime),
+		service.WithRefreshGracePeriod(cfg.JWT.RefreshGracePeriod),
+		service.WithRefreshTokenKey(cfg.JWT.RefreshTokenKey),
+		service.WithAccessTokenBinding(cfg.JWT.BindAccessToken),
+	}
+
+	sessionLimitPolicy, err := domain.ParseSessionLimitPolicy(cfg.SessionLimit.OnExceed)
+	if err != nil {
+		log.Error("failed to init session limit", "error", err)
+		os.Exit(1)
+	}
+	opts = append(opts, service.WithSessionLimit(domain.SessionLimit{
+		MaxPerUser:       cfg.SessionLimit.MaxPerUser,
+		MaxPerDeviceType: cfg.SessionLimit.MaxPerDeviceType,
+		Policy:           sessionLimitPolicy,
+	}))
+
+	admins, err := domain.ParseUserIDs(cfg.Admin.UserIDs)
+	if err != nil {
+		log.Error("failed to parse admin user ids", "error", err)
+		os.Exit(1)
+	}
+
+	if cfg.GeoIP.CityDB != "" || cfg.GeoIP.ASNDB != "" {
+		geoResolver, err := geoip.Open(cfg.GeoIP.CityDB, cfg.GeoIP.ASNDB)
+		if err != nil {
+			log.Error("failed to open geoip databases", "error", err)
+			os.Exit(1)
+		}
+		defer geoResolver.Close()
+
+		opts = append(opts, service.WithGeoIP(geoResolver, geoip.TravelCheck{
+			MaxSpeedKmh:   cfg.GeoIP.MaxTravelSpeed,
+			MinDistanceKm: cfg.GeoIP.MinTravelDistance,
+		}))
+	}
+
+	if cfg.Lockout.Enabled {
+		var store lockout.Store = lockout.NewMemory()
+		if cfg.Lockout.Backend == "postgres" {
+			shared, ok := storage.(lockout.Store)
+			if !ok {
+				log.Error("lockout backend postgres needs postgres storage")
+				os.Exit(1)
+			}
+			store = shared
+			if purger, ok := shared.(lockout.Purger); ok {
+				janitorTasks = append(janitorTasks, janitor.Task{
+					Name: "lockouts",
+					Delete: func(ctx context.Context, now time.Time, limit int) (int64, error) {
+						return purger.DeleteStaleLockouts(ctx, now, cfg.Lockout.Window, limit)
+					},
+				})
+			}
+		}
+
+		opts = append(opts, service.WithLockout(lockout.NewGuard(store, lockout.Policy{
+			Threshold:    cfg.Lockout.Threshold,
+			Window:       cfg.Lockout.Window,
+			BaseDuration: cfg.Lockout.BaseDuration,
+			MaxDuration:  cfg.Lockout.MaxDuration,
+		})))
+	}
 
 	authService := service.NewAuthService(
 		storage,
@@ -51,26 +236,105 @@ func main() {
 		cfg.WebhookURL,
 		cfg.JWT.AccessTTL,
 		cfg.JWT.RefreshTTL,
+		opts...,
 	)
-	authHandler := authhttp.NewAuthHandler(authService, cfg.JWT.Secret)
+	refreshCookie, err := newRefreshCookie(cfg.RefreshCookie, cfg.JWT.RefreshTTL)
+	if err != nil {
+		log.Error("failed to init refresh cookie", "error", err)
+		os.Exit(1)
+	}
+
+	authHandler := authhttp.NewAuthHandler(authService, signingKeys, refreshCookie)
+	adminHandler := authhttp.NewAdminHandler(service.NewAdminService(storage, log, auditLog))
+
+	clientIPResolver, err := authhttp.NewClientIPResolver(cfg.HTTPServer.TrustedProxies, cfg.HTTPServer.ForwardedHeader)
+	if err != nil {
+		log.Error("failed to init client ip resolver", "error", err)
+		os.Exit(1)
+	}
 
 	router := chi.NewRouter()
+	router.Use(tracing.Middleware)
+	router.Use(metrics.NewHTTP(registry).Middleware)
 	router.Use(middleware.RequestID)
-	router.Use(middleware.RealIP)
+	if len(cfg.CORS.AllowedOrigins) > 0 {
+		cors, err := authhttp.NewCORS(authhttp.CORSOptions{
+			AllowedOrigins:   cfg.CORS.AllowedOrigins,
+			AllowedMethods:   cfg.CORS.AllowedMethods,
+			AllowedHeaders:   cfg.CORS.AllowedHeaders,
+			ExposedHeaders:   cfg.CORS.ExposedHeaders,
+			AllowCredentials: cfg.CORS.AllowCredentials,
+			MaxAge:           cfg.CORS.MaxAge,
+		})
+		if err != nil {
+			log.Error("failed to init cors", "error", err)
+			os.Exit(1)
+		}
+		router.Use(cors.Middleware)
+	}
+	router.Use(clientIPResolver.Middleware)
 	router.Use(middleware.Logger)
 	router.Use(middleware.Recoverer)
 
-	router.Post("/auth/tokens", authHandler.CreateTokens)
-	router.Post("/auth/tokens/refresh", authHandler.RefreshTokens)
+	tokenRoutes := router.With()
+	if cfg.RateLimit.Enabled {
+		var store ratelimit.Store = ratelimit.NewMemory()
+		if cfg.RateLimit.Backend == "postgres" {
+			shared, ok := storage.(ratelimit.Store)
+			if !ok {
+				log.Error("rate limit backend postgres needs postgres storage")
+				os.Exit(1)
+			}
+			store = shared
+			if purger, ok := shared.(ratelimit.Purger); ok {
+				janitorTasks = append(janitorTasks, janitor.Task{Name: "rate_limits", Delete: purger.DeleteFullRateLimits})
+			}
+		}
+
+		limiter := authhttp.NewRateLimiter(store, authhttp.RateLimits{
+			PerIP:    rateLimit(cfg.RateLimit.PerIP),
+			PerUser:  rateLimit(cfg.RateLimit.PerUser),
+			PerRoute: rateLimit(cfg.RateLimit.PerRoute),
+		}, authHandler.RateLimitUserKey, log)
+		tokenRoutes = router.With(limiter.Middleware)
+	}
+
+	tokenRoutes.Post("/auth/tokens", authHandler.CreateTokens)
+	tokenRoutes.Post("/auth/tokens/refresh", authHandler.RefreshTokens)
 
 	router.Group(func(r chi.Router) {
 		r.Use(authHandler.AuthMiddleware)
 		r.Get("/me", authHandler.GetMyGUID)
 		r.Post("/logout", authHandler.Logout)
+		r.Post("/logout/all", authHandler.LogoutAll)
+		r.Get("/sessions", authHandler.ListSessions)
+		r.Delete("/sessions/{id}", authHandler.RevokeSession)
+	})
+
+	router.Group(func(r chi.Router) {
+		r.Use(authHandler.AuthMiddleware)
+		r.Use(authhttp.RequireScope(service.ScopeAdmin))
+		r.Use(authhttp.RequireUser(admins))
+		r.Get("/admin/sessions", adminHandler.ListSessions)
+		r.Post("/admin/sessions/revoke", adminHandler.RevokeSessions)
+		r.Delete("/admin/sessions/{id}", adminHandler.RevokeSession)
+		r.Delete("/admin/users/{user_id}/sessions", adminHandler.RevokeUserSessions)
 	})
 
 	router.Get("/swagger/*", httpSwagger.WrapHandler)
 
+	background, stopBackground := context.WithCancel(context.Background())
+	defer stopBackground()
+
+	if keyStore != nil {
+		go signingKeys.Run(background, cfg.JWT.KeysReloadInterval, log)
+	}
+
+	stopJanitor := func() {}
+	if cfg.Janitor.Enabled {
+		stopJanitor = startJanitor(cfg.Janitor, storage, janitorTasks, metrics.NewJanitor(registry), log)
+	}
+
 	address := cfg.HTTPServer.Host + ":" + cfg.HTTPServer.Port
 	log.Info("starting server", slog.String("address", address))
 
@@ -93,6 +357,30 @@ func main() {
 		}
 	}()
 
+	// Metrics are served apart from the API, so they stay off the public
+	// listener.
+	var metricsSrv *http.Server
+	if cfg.Metrics.Address != "" {
+		log.Info("starting metrics server", slog.String("address", cfg.Metrics.Address))
+
+		metricsRouter := chi.NewRouter()
+		metricsRouter.Handle("/metrics", promhttp.HandlerFor(registry, promhttp.HandlerOpts{}))
+		metricsSrv = &http.Server{
+			Addr:         cfg.Metrics.Address,
+			Handler:      metricsRouter,
+			ReadTimeout:  cfg.HTTPServer.Timeout,
+			WriteTimeout: cfg.HTTPServer.Timeout,
+			IdleTimeout:  cfg.IdleTimeout,
+		}
+
+		go func() {
+			if err := metricsSrv.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+				log.Error("failed to start metrics server", "error", err)
+				os.Exit(1)
+			}
+		}()
+	}
+
 	<-stop
 
 	log.Info("shutting down server gracefully")
@@ -105,6 +393,22 @@ func main() {
 		os.Exit(1)
 	}
 
+	if metricsSrv != nil {
+		if err := metricsSrv.Shutdown(ctx); err != nil {
+			log.Error("metrics server shutdown failed", "error", err)
+		}
+	}
+
+	stopJanitor()
+
+	if err := webhooks.Close(ctx); err != nil {
+		log.Error("failed to deliver queued webhooks", "error", err)
+	}
+
+	if err := shutdownTracing(ctx); err != nil {
+		log.Error("failed to flush traces", "error", err)
+	}
+
 	log.Info("server stopped")
 }
 
@@ -135,20 +439,90 @@ func setupLogger(env string) *slog.Logger {
 	return log
 }
 
-func runMigrations(storageURL string, log *slog.Logger) {
-	m, err := migrate.New(
-		"file://migrations",
-		storageURL,
-	)
+func newPolicy(cfg config.Policy) (*policy.Engine, error) {
+	rules := map[policy.Signal]string{
+		policy.SignalUserAgentChange:  cfg.UserAgentChange,
+		policy.SignalIPChange:         cfg.IPChange,
+		policy.SignalSubnetChange:     cfg.SubnetChange,
+		policy.SignalASNChange:        cfg.ASNChange,
+		policy.SignalGeoChange:        cfg.GeoChange,
+		policy.SignalImpossibleTravel: cfg.ImpossibleTravel,
+		policy.SignalTokenAge:         cfg.TokenAge,
+	}
+
+	actions := make(map[policy.Signal]policy.Action, len(rules))
+	for signal, rule := range rules {
+		action, err := policy.ParseAction(rule)
+		if err != nil {
+			return nil, fmt.Errorf("policy.%s: %w", signal, err)
+		}
+		actions[signal] = action
+	}
+
+	return policy.NewEngine(actions, cfg.MaxTokenAge), nil
+}
+
+func rateLimit(limit config.Limit) ratelimit.Limit {
+	return ratelimit.Every(limit.Requests, limit.Period, limit.Burst)
+}
+
+func newRefreshCookie(cfg config.RefreshCookie, refreshTTL time.Duration) (*authhttp.RefreshCookie, error) {
+	if !cfg.Enabled {
+		return nil, nil
+	}
+
+	sameSite, err := authhttp.ParseSameSite(cfg.SameSite)
 	if err != nil {
-		log.Error("failed to create migrate instance", "error", err)
-		os.Exit(1)
+		return nil, err
+	}
+
+	return &authhttp.RefreshCookie{
+		Name:           cfg.Name,
+		Path:           cfg.Path,
+		Domain:         cfg.Domain,
+		SameSite:       sameSite,
+		Secure:         cfg.Secure,
+		MaxAge:         refreshTTL,
+		CSRFCookie:     cfg.CSRFCookie,
+		CSRFHeader:     cfg.CSRFHeader,
+		TrustedOrigins: cfg.TrustedOrigins,
+	}, nil
+}
+
+// startJanitor runs the janitor in the background and returns a function that
+// stops it and waits for the current batch to finish.
+func startJanitor(cfg config.Janitor, storage appstorage.Storage, tasks []janitor.Task, m janitor.Metrics, log *slog.Logger) func() {
+	store, ok := storage.(janitor.Store)
+	if !ok {
+		log.Info("storage expires sessions itself, janitor disabled")
+		return func() {}
 	}
 
-	if err := m.Up(); err != nil && err != migrate.ErrNoChange {
-		log.Error("failed to apply migrations", "error", err)
+	if cfg.Interval <= 0 || cfg.BatchSize <= 0 || cfg.MaxBatches <= 0 {
+		log.Error("janitor interval, batch_size and max_batches must be positive")
 		os.Exit(1)
 	}
 
-	log.Info("migrations applied successfully")
+	opts := []janitor.Option{janitor.WithMetrics(m)}
+	for _, task := range tasks {
+		opts = append(opts, janitor.WithTask(task))
+	}
+
+	j := janitor.New(store, janitor.Config{
+		Interval:   cfg.Interval,
+		BatchSize:  cfg.BatchSize,
+		MaxBatches: cfg.MaxBatches,
+	}, log, opts...)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		j.Run(ctx)
+	}()
+
+	return func() {
+		cancel()
+		<-done
+	}
 }
@@ -0,0 +1,166 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+
+	"test2auth/internal/config"
+	"test2auth/migrations"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+const usage = `usage:
+  app [serve]                 run the HTTP server
+  app migrate up [N]          apply all or the next N migrations
+  app migrate down [N]        roll back the last N migrations (default 1)
+  app migrate version         print the current migration version
+  app migrate force VERSION   set the version without running migrations,
+                              to recover from a failed migration
+`
+
+// errNoMigrations is returned for backends without a schema.
+var errNoMigrations = errors.New("storage has no migrations")
+
+// newMigrate opens storageURL with the migrations embedded for its backend.
+func newMigrate(storageURL string) (*migrate.Migrate, error) {
+	dir := "."
+	switch {
+	case strings.HasPrefix(storageURL, "memory://"),
+		strings.HasPrefix(storageURL, "redis://"), strings.HasPrefix(storageURL, "rediss://"):
+		return nil, errNoMigrations
+	case strings.HasPrefix(storageURL, "sqlite://"):
+		dir = "sqlite"
+	}
+
+	source, err := iofs.New(migrations.FS, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return migrate.NewWithSourceInstance("iofs", source, storageURL)
+}
+
+// migrateUp applies all pending migrations, for serve with auto_migrate.
+func migrateUp(storageURL string, log *slog.Logger) error {
+	m, err := newMigrate(storageURL)
+	if errors.Is(err, errNoMigrations) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer m.Close()
+
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		return err
+	}
+
+	log.Info("migrations applied successfully")
+
+	return nil
+}
+
+// migrateCommand runs "app migrate ..." and returns the exit code.
+func migrateCommand(args []string) int {
+	if len(args) == 0 {
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	cfg := config.MustLoad()
+	log := setupLogger(cfg.Env)
+
+	m, err := newMigrate(cfg.StorageURL)
+	if err != nil {
+		log.Error("failed to create migrate instance", "error", err)
+		return 1
+	}
+	defer m.Close()
+
+	switch args[0] {
+	case "up":
+		n, ok := parseCount(args[1:], 0)
+		if !ok {
+			fmt.Fprint(os.Stderr, usage)
+			return 2
+		}
+		if n == 0 {
+			err = m.Up()
+		} else {
+			err = m.Steps(n)
+		}
+	case "down":
+		n, ok := parseCount(args[1:], 1)
+		if !ok {
+			fmt.Fprint(os.Stderr, usage)
+			return 2
+		}
+		err = m.Steps(-n)
+	case "version":
+		version, dirty, err := m.Version()
+		if errors.Is(err, migrate.ErrNilVersion) {
+			fmt.Println("no migrations applied")
+			return 0
+		}
+		if err != nil {
+			log.Error("failed to read migration version", "error", err)
+			return 1
+		}
+		if dirty {
+			fmt.Printf("%d (dirty)\n", version)
+		} else {
+			fmt.Println(version)
+		}
+		return 0
+	case "force":
+		if len(args) != 2 {
+			fmt.Fprint(os.Stderr, usage)
+			return 2
+		}
+		version, convErr := strconv.Atoi(args[1])
+		if convErr != nil {
+			fmt.Fprint(os.Stderr, usage)
+			return 2
+		}
+		err = m.Force(version)
+	default:
+		fmt.Fprint(os.Stderr, usage)
+		return 2
+	}
+
+	if errors.Is(err, migrate.ErrNoChange) {
+		log.Info("no migrations to apply")
+		return 0
+	}
+	if err != nil {
+		log.Error("migration failed", "command", args[0], "error", err)
+		return 1
+	}
+
+	log.Info("migration finished", "command", args[0])
+
+	return 0
+}
+
+// parseCount reads the optional step count of up and down.
+func parseCount(args []string, def int) (int, bool) {
+	switch len(args) {
+	case 0:
+		return def, true
+	case 1:
+		n, err := strconv.Atoi(args[0])
+		if err != nil || n <= 0 {
+			return 0, false
+		}
+		return n, true
+	}
+	return 0, false
+}
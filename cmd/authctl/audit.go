@@ -0,0 +1,28 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"test2auth/internal/audit"
+)
+
+// verifyAudit walks the audit log and reports the first record whose hash
+// link is broken. It exits with status 1 if the chain is not intact.
+func verifyAudit(ctx context.Context, e *env, _ []string) error {
+	chain := audit.NewChain(e.cfg.Audit.HMACKey)
+
+	checked, brk, err := chain.Verify(ctx, e.storage)
+	if err != nil {
+		return fmt.Errorf("failed to verify audit log: %w", err)
+	}
+
+	if brk != nil {
+		fmt.Printf("audit log is broken at record %d: %s (%d records verified before it)\n", brk.RecordID, brk.Reason, checked)
+		os.Exit(1)
+	}
+
+	fmt.Printf("audit log is intact: %d records verified\n", checked)
+	return nil
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+	"time"
+)
+
+func listKeys(_ context.Context, e *env, _ []string) error {
+	now := time.Now()
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATE\tCREATED\tACTIVATES\tRETIRED")
+	for _, key := range e.keys.Keys() {
+		state := "active"
+		switch {
+		case !key.RetiredAt.IsZero() && !key.RetiredAt.After(now):
+			state = "retired"
+		case key.ActivateAt.After(now):
+			state = "pending"
+		}
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\n",
+			key.ID,
+			state,
+			formatTime(key.CreatedAt),
+			formatTime(key.ActivateAt),
+			formatTime(key.RetiredAt),
+		)
+	}
+	return w.Flush()
+}
+
+// rotateKey adds a new signing key. It only starts signing once every
+// replica had the chance to reload the keys, until then it just verifies.
+func rotateKey(ctx context.Context, e *env, args []string) error {
+	flags := flag.NewFlagSet("keys rotate", flag.ContinueOnError)
+	activateIn := flags.Duration("activate-in", 2*e.cfg.JWT.KeysReloadInterval, "delay before the new key starts signing")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	key, err := e.keys.Rotate(ctx, time.Now().Add(*activateIn))
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("added key %s, signing from %s\n", key.ID, formatTime(key.ActivateAt))
+	fmt.Printf("retire the previous key once its tokens expired, in %s after that\n", e.cfg.JWT.AccessTTL)
+	return nil
+}
+
+func retireKey(ctx context.Context, e *env, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: authctl keys retire KEY_ID")
+	}
+
+	if err := e.keys.Retire(ctx, args[0]); err != nil {
+		return err
+	}
+
+	fmt.Printf("retired key %s\n", args[0])
+	return nil
+}
@@ -0,0 +1,189 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+
+	"test2auth/domain"
+	"test2auth/internal/audit"
+	"test2auth/internal/config"
+	"test2auth/internal/jwtkeys"
+	"test2auth/internal/service"
+	appstorage "test2auth/internal/storage"
+	"test2auth/internal/webhook"
+
+	"github.com/google/uuid"
+)
+
+const usage = `authctl manages tokens, sessions, signing keys, webhooks and the audit
+log of the auth service directly in its storage, using the service
+configuration. Signing keys and webhook deliveries need postgres storage.
+
+usage:
+  authctl token issue -user ID [-ua USER_AGENT] [-ip IP]
+  authctl token issue -admin -user ID
+  authctl token decode TOKEN
+  authctl sessions list [-user ID] [-ip IP_OR_CIDR] [-ua SUBSTRING] [-limit N]
+  authctl sessions revoke SESSION_ID
+  authctl sessions revoke-user USER_ID
+  authctl keys list
+  authctl keys rotate [-activate-in DURATION]
+  authctl keys retire KEY_ID
+  authctl webhooks list [-failed] [-limit N]
+  authctl webhooks replay ID... | -failed [-limit N]
+  authctl audit verify
+`
+
+// operatorID is the actor recorded in the audit log for authctl actions.
+var operatorID = uuid.Nil
+
+// env is what the commands work with, built from the service configuration.
+type env struct {
+	cfg      *config.Config
+	storage  appstorage.Storage
+	keys     *jwtkeys.Set
+	auth     service.AuthService
+	admin    service.AdminService
+	webhooks *webhook.Sender
+	// keyStore and webhookStore are nil if the storage does not keep signing
+	// keys or webhook deliveries.
+	keyStore     jwtkeys.Store
+	webhookStore webhook.Store
+}
+
+func main() {
+	if len(os.Args) < 3 {
+		fmt.Fprint(os.Stderr, usage)
+		os.Exit(2)
+	}
+
+	commands := map[string]map[string]func(context.Context, *env, []string) error{
+		"token": {
+			"issue":  issueToken,
+			"decode": decodeToken,
+		},
+		"sessions": {
+			"list":        listSessions,
+			"revoke":      revokeSession,
+			"revoke-user": revokeUserSessions,
+		},
+		"keys": {
+			"list":   listKeys,
+			"rotate": rotateKey,
+			"retire": retireKey,
+		},
+		"webhooks": {
+			"list":   listWebhooks,
+			"replay": replayWebhooks,
+		},
+		"audit": {
+			"verify": verifyAudit,
+		},
+	}
+
+	run, ok := commands[os.Args[1]][os.Args[2]]
+	if !ok {
+		fmt.Fprintf(os.Stderr, "unknown command %q\n\n%s", strings.Join(os.Args[1:3], " "), usage)
+		os.Exit(2)
+	}
+
+	ctx := context.Background()
+
+	e, err := newEnv(ctx)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+
+	err = run(ctx, e, os.Args[3:])
+
+	// Commands may have queued notifications, e.g. of evicted sessions.
+	if err := e.webhooks.Close(ctx); err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+	}
+
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "%s\n", err)
+		os.Exit(1)
+	}
+}
+
+func newEnv(ctx context.Context) (*env, error) {
+	cfg := config.MustLoad()
+
+	// Only warnings and errors, the output belongs to the command.
+	log := slog.New(slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: slog.LevelWarn}))
+
+	storage, err := appstorage.Open(cfg.StorageURL, log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init storage: %w", err)
+	}
+
+	keyStore, _ := storage.(jwtkeys.Store)
+	keys := jwtkeys.NewSet(cfg.JWT.Secret, keyStore,
+		jwtkeys.WithKeyEncryptionKey(cfg.JWT.KeysEncryptionKey),
+		jwtkeys.WithRequireKID(cfg.JWT.RequireKID),
+	)
+	if err := keys.Reload(ctx); err != nil {
+		return nil, fmt.Errorf("failed to load signing keys: %w", err)
+	}
+
+	auditLog := audit.NewLog(storage, audit.NewChain(cfg.Audit.HMACKey), log)
+
+	webhookOpts := []webhook.Option{
+		webhook.WithTimeout(cfg.Webhook.Timeout),
+		webhook.WithQueueSize(cfg.Webhook.QueueSize),
+	}
+	webhookStore, _ := storage.(webhook.Store)
+	if webhookStore != nil {
+		webhookOpts = append(webhookOpts, webhook.WithStore(webhookStore))
+	}
+	webhooks := webhook.NewSender(cfg.WebhookURL, log, webhookOpts...)
+
+	sessionLimitPolicy, err := domain.ParseSessionLimitPolicy(cfg.SessionLimit.OnExceed)
+	if err != nil {
+		return nil, fmt.Errorf("failed to init session limit: %w", err)
+	}
+
+	admins, err := domain.ParseUserIDs(cfg.Admin.UserIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse admin user ids: %w", err)
+	}
+
+	// Issued tokens have to work against the running service, so everything
+	// that shapes them is configured the same way.
+	auth := service.NewAuthService(
+		storage,
+		log,
+		cfg.JWT.Secret,
+		cfg.WebhookURL,
+		cfg.JWT.AccessTTL,
+		cfg.JWT.RefreshTTL,
+		service.WithAuditor(auditLog),
+		service.WithSigningKeys(keys),
+		service.WithWebhookSender(webhooks),
+		service.WithRefreshTokenKey(cfg.JWT.RefreshTokenKey),
+		service.WithSessionLifetime(cfg.JWT.SessionIdleTimeout, cfg.JWT.SessionMaxLifetime),
+		service.WithSessionLimit(domain.SessionLimit{
+			MaxPerUser:       cfg.SessionLimit.MaxPerUser,
+			MaxPerDeviceType: cfg.SessionLimit.MaxPerDeviceType,
+			Policy:           sessionLimitPolicy,
+		}),
+		service.WithAdmins(admins, cfg.Admin.TokenTTL),
+	)
+
+	return &env{
+		cfg:      cfg,
+		storage:  storage,
+		keys:     keys,
+		auth:     auth,
+		admin:    service.NewAdminService(storage, log, auditLog),
+		webhooks: webhooks,
+
+		keyStore:     keyStore,
+		webhookStore: webhookStore,
+	}, nil
+}
@@ -0,0 +1,110 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+
+	"test2auth/domain"
+
+	"github.com/google/uuid"
+)
+
+func listSessions(ctx context.Context, e *env, args []string) error {
+	flags := flag.NewFlagSet("sessions list", flag.ContinueOnError)
+	user := flags.String("user", "", "only sessions of this user ID")
+	ipRange := flags.String("ip", "", "only sessions from this IP address or CIDR range")
+	userAgent := flags.String("ua", "", "only sessions whose user agent contains this")
+	limit := flags.Int("limit", 100, "maximum number of sessions")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	filter := domain.SessionFilter{
+		UserAgent: *userAgent,
+		Limit:     *limit,
+	}
+	if *user != "" {
+		userID, err := uuid.Parse(*user)
+		if err != nil {
+			return fmt.Errorf("invalid -user: %w", err)
+		}
+		filter.UserID = userID
+	}
+	if *ipRange != "" {
+		prefix, err := domain.ParseIPRange(*ipRange)
+		if err != nil {
+			return fmt.Errorf("invalid -ip: %w", err)
+		}
+		filter.IPRange = prefix
+	}
+
+	sessions, err := e.admin.FindSessions(ctx, operatorID, filter)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tUSER\tIP\tDEVICE\tCREATED\tLAST USED\tEXPIRES")
+	for _, session := range sessions {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			session.ID,
+			session.UserID,
+			session.IP,
+			strings.TrimSpace(session.Device.BrowserFamily+" "+session.Device.OS),
+			formatTime(session.CreatedAt),
+			formatTime(session.LastUsedAt),
+			formatTime(session.ExpiresAt),
+		)
+	}
+	return w.Flush()
+}
+
+func revokeSession(ctx context.Context, e *env, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: authctl sessions revoke SESSION_ID")
+	}
+
+	sessionID, err := uuid.Parse(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid session id: %w", err)
+	}
+
+	if err := e.admin.RevokeSession(ctx, operatorID, sessionID); err != nil {
+		return err
+	}
+
+	fmt.Printf("revoked session %s\n", sessionID)
+	return nil
+}
+
+func revokeUserSessions(ctx context.Context, e *env, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: authctl sessions revoke-user USER_ID")
+	}
+
+	userID, err := uuid.Parse(args[0])
+	if err != nil {
+		return fmt.Errorf("invalid user id: %w", err)
+	}
+
+	revoked, err := e.admin.RevokeUserSessions(ctx, operatorID, userID)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("revoked %d sessions of user %s\n", revoked, userID)
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.UTC().Format(time.RFC3339)
+}
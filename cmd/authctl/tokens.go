@@ -0,0 +1,100 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/netip"
+	"os"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
+)
+
+func issueToken(ctx context.Context, e *env, args []string) error {
+	flags := flag.NewFlagSet("token issue", flag.ContinueOnError)
+	user := flags.String("user", "", "user ID (GUID)")
+	userAgent := flags.String("ua", "authctl", "user agent recorded in the session")
+	ipFlag := flags.String("ip", "", "client IP recorded in the session")
+	admin := flags.Bool("admin", false, "issue an admin token for one of admin.user_ids instead, without a session")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	userID, err := uuid.Parse(*user)
+	if err != nil {
+		return fmt.Errorf("invalid -user: %w", err)
+	}
+
+	if *admin {
+		accessToken, err := e.auth.IssueAdminToken(ctx, userID)
+		if err != nil {
+			return err
+		}
+		return printJSON(map[string]string{"access_token": accessToken})
+	}
+
+	var ip netip.Addr
+	if *ipFlag != "" {
+		if ip, err = netip.ParseAddr(*ipFlag); err != nil {
+			return fmt.Errorf("invalid -ip: %w", err)
+		}
+	}
+
+	accessToken, refreshToken, err := e.auth.CreateTokens(ctx, userID, *userAgent, ip)
+	if err != nil {
+		return err
+	}
+
+	return printJSON(map[string]string{
+		"access_token":  accessToken,
+		"refresh_token": refreshToken,
+	})
+}
+
+// decodeToken prints the header and claims of an access token and whether it
+// verifies against the configured keys.
+func decodeToken(_ context.Context, e *env, args []string) error {
+	if len(args) != 1 {
+		return errors.New("usage: authctl token decode TOKEN")
+	}
+
+	token, err := jwt.Parse(args[0], e.keys.Keyfunc)
+	if token == nil {
+		return fmt.Errorf("malformed token: %w", err)
+	}
+
+	if err := printJSON(map[string]any{
+		"header": token.Header,
+		"claims": token.Claims,
+	}); err != nil {
+		return err
+	}
+
+	if claims, ok := token.Claims.(jwt.MapClaims); ok {
+		if exp, ok := claims["exp"].(float64); ok {
+			fmt.Printf("expires: %s\n", time.Unix(int64(exp), 0).UTC().Format(time.RFC3339))
+		}
+	}
+
+	if err != nil {
+		return fmt.Errorf("invalid: %w", err)
+	}
+
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		kid = "JWT secret"
+	}
+	fmt.Printf("valid, signed with %s\n", kid)
+
+	return nil
+}
+
+func printJSON(v any) error {
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"test2auth/domain"
+)
+
+// errNoWebhookStore is returned by webhook commands on storage that does not
+// log deliveries.
+var errNoWebhookStore = errors.New("storage does not log webhook deliveries, use postgres")
+
+func listWebhooks(ctx context.Context, e *env, args []string) error {
+	flags := flag.NewFlagSet("webhooks list", flag.ContinueOnError)
+	failed := flags.Bool("failed", false, "only failed deliveries")
+	limit := flags.Int("limit", 100, "maximum number of deliveries")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if e.webhookStore == nil {
+		return errNoWebhookStore
+	}
+
+	deliveries, err := e.webhookStore.ListWebhookDeliveries(ctx, *failed, *limit)
+	if err != nil {
+		return err
+	}
+
+	w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, "ID\tSTATUS\tATTEMPTS\tCREATED\tUPDATED\tERROR")
+	for _, delivery := range deliveries {
+		fmt.Fprintf(w, "%d\t%s\t%d\t%s\t%s\t%s\n",
+			delivery.ID,
+			delivery.Status,
+			delivery.Attempts,
+			formatTime(delivery.CreatedAt),
+			formatTime(delivery.UpdatedAt),
+			delivery.LastError,
+		)
+	}
+	return w.Flush()
+}
+
+// replayWebhooks posts the given deliveries again, or the failed ones with
+// -failed. It fails if any replay did not go through.
+func replayWebhooks(ctx context.Context, e *env, args []string) error {
+	flags := flag.NewFlagSet("webhooks replay", flag.ContinueOnError)
+	failed := flags.Bool("failed", false, "replay failed deliveries")
+	limit := flags.Int("limit", 100, "maximum number of failed deliveries to replay")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	if e.webhookStore == nil {
+		return errNoWebhookStore
+	}
+
+	var ids []int64
+	switch {
+	case *failed && flags.NArg() > 0:
+		return errors.New("pass either delivery IDs or -failed")
+	case *failed:
+		deliveries, err := e.webhookStore.ListWebhookDeliveries(ctx, true, *limit)
+		if err != nil {
+			return err
+		}
+		for _, delivery := range deliveries {
+			ids = append(ids, delivery.ID)
+		}
+	case flags.NArg() > 0:
+		for _, arg := range flags.Args() {
+			id, err := strconv.ParseInt(arg, 10, 64)
+			if err != nil {
+				return fmt.Errorf("invalid delivery id %q", arg)
+			}
+			ids = append(ids, id)
+		}
+	default:
+		return errors.New("usage: authctl webhooks replay ID... | -failed [-limit N]")
+	}
+
+	var failures int
+	for _, id := range ids {
+		delivery, err := e.webhooks.Replay(ctx, id)
+		if err != nil {
+			return err
+		}
+		if delivery.Status != domain.WebhookDelivered {
+			failures++
+			fmt.Printf("%d: failed: %s\n", id, delivery.LastError)
+			continue
+		}
+		fmt.Printf("%d: delivered\n", id)
+	}
+
+	if failures > 0 {
+		return fmt.Errorf("%d of %d deliveries failed again", failures, len(ids))
+	}
+	return nil
+}
@@ -0,0 +1,35 @@
+package domain
+
+import (
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	AuditSessionCreated   = "session.created"
+	AuditSessionRefreshed = "session.refreshed"
+	AuditSessionRevoked   = "session.revoked"
+	AuditRefreshFailed    = "refresh.failed"
+	AuditLogout           = "logout"
+	AuditLockout          = "lockout"
+	AuditPolicyDecision   = "refresh.policy_decision"
+	AuditSessionEvicted   = "session.evicted"
+	AuditSessionLimit     = "session.limit_reached"
+
+	AuditAdminSessionsListed  = "admin.sessions_listed"
+	AuditAdminSessionRevoked  = "admin.session_revoked"
+	AuditAdminSessionsRevoked = "admin.sessions_revoked"
+	AuditAdminTokenIssued     = "admin.token_issued"
+)
+
+type AuditRecord struct {
+	ID        int64
+	Event     string
+	UserID    uuid.UUID
+	IP        string
+	Details   map[string]string
+	CreatedAt time.Time
+	PrevHash  string
+	Hash      string
+}
@@ -0,0 +1,17 @@
+package domain
+
+const (
+	DeviceDesktop = "desktop"
+	DeviceMobile  = "mobile"
+	DeviceTablet  = "tablet"
+	DeviceBot     = "bot"
+	DeviceUnknown = "unknown"
+)
+
+// Device is what the user agent string tells about the client.
+type Device struct {
+	BrowserFamily string
+	BrowserMajor  string
+	OS            string
+	DeviceType    string
+}
@@ -1,10 +1,43 @@
 package domain
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
 var (
 	ErrSessionNotFound     = errors.New("session not found")
 	ErrInvalidRefreshToken = errors.New("invalid refresh token")
 	ErrSessionExpired      = errors.New("session has expired")
-	ErrInvalidAccessToken  = errors.New("invalid access token")
+	// ErrSessionIdleTimeout and ErrSessionLifetimeExceeded also end the
+	// session, but tell the client why.
+	ErrSessionIdleTimeout      = errors.New("session has been idle for too long")
+	ErrSessionLifetimeExceeded = errors.New("session has reached its maximum lifetime")
+	ErrInvalidAccessToken      = errors.New("invalid access token")
+	ErrAccountLocked           = errors.New("too many failed attempts, try again later")
+	ErrSessionRevoked          = errors.New("session has been revoked")
+	ErrRefreshDenied           = errors.New("refresh denied by security policy")
+	ErrStepUpRequired          = errors.New("re-authentication required")
+	ErrSessionLimitReached     = errors.New("too many active sessions")
+	ErrRefreshConflict         = errors.New("refresh token was rotated concurrently, retry")
+	// ErrEmptyFilter protects against revoking every session by accident.
+	ErrEmptyFilter             = errors.New("at least one filter is required")
+	ErrNotAdmin                = errors.New("user is not an admin")
+	ErrWebhookDeliveryNotFound = errors.New("webhook delivery not found")
 )
+
+// LockoutError is returned while a user or an IP address is locked out after
+// repeated failures. It matches ErrAccountLocked.
+type LockoutError struct {
+	Until time.Time
+	// ByIP is set when the client address is locked rather than the user.
+	ByIP bool
+}
+
+func (e *LockoutError) Error() string {
+	return ErrAccountLocked.Error()
+}
+
+func (e *LockoutError) Unwrap() error {
+	return ErrAccountLocked
+}
@@ -0,0 +1,16 @@
+package domain
+
+// Location is the GeoIP view of a client address. Fields are empty when the
+// address is unknown to the database or GeoIP is not configured.
+type Location struct {
+	Country   string
+	City      string
+	Latitude  float64
+	Longitude float64
+	ASN       uint
+	ASOrg     string
+}
+
+func (l Location) HasCoordinates() bool {
+	return l.Latitude != 0 || l.Longitude != 0
+}
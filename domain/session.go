@@ -1,16 +1,89 @@
 package domain
 
 import (
+	"net/netip"
+	"strings"
 	"time"
 
 	"github.com/google/uuid"
 )
 
 type Session struct {
+	ID               uuid.UUID
 	UserID           uuid.UUID
 	RefreshTokenHash string
 	UserAgent        string
-	IP               string
+	Device           Device
+	IP               netip.Addr
+	Location         Location
 	ExpiresAt        time.Time
 	CreatedAt        time.Time
+	LastUsedAt       time.Time
+	// PrevRefreshTokenHash, RotatedAt and GraceTokens describe the last
+	// rotation. Until GraceUntil the previous refresh token gets the same new
+	// pair again, GraceTokens holds that pair encrypted. Storage may clear
+	// GraceTokens after GraceUntil.
+	PrevRefreshTokenHash string
+	RotatedAt            time.Time
+	GraceTokens          string
+	GraceUntil           time.Time
+}
+
+// SessionFilter selects sessions for administrative queries. Zero fields
+// match every session.
+type SessionFilter struct {
+	UserID  uuid.UUID
+	IPRange netip.Prefix
+	// UserAgent matches as a case-insensitive substring.
+	UserAgent     string
+	CreatedAfter  time.Time
+	CreatedBefore time.Time
+	// Limit caps the number of returned sessions, zero means no limit. It is
+	// ignored when deleting.
+	Limit int
+}
+
+// Matches reports whether session passes the filter, for storage backends
+// that cannot filter in a query.
+func (f SessionFilter) Matches(session Session) bool {
+	if f.UserID != uuid.Nil && session.UserID != f.UserID {
+		return false
+	}
+	if f.IPRange.IsValid() && (!session.IP.IsValid() || !f.IPRange.Contains(session.IP)) {
+		return false
+	}
+	if f.UserAgent != "" && !strings.Contains(strings.ToLower(session.UserAgent), strings.ToLower(f.UserAgent)) {
+		return false
+	}
+	if !f.CreatedAfter.IsZero() && session.CreatedAt.Before(f.CreatedAfter) {
+		return false
+	}
+	if !f.CreatedBefore.IsZero() && !session.CreatedAt.Before(f.CreatedBefore) {
+		return false
+	}
+	return true
+}
+
+func (f SessionFilter) IsEmpty() bool {
+	return f.UserID == uuid.Nil && !f.IPRange.IsValid() && f.UserAgent == "" &&
+		f.CreatedAfter.IsZero() && f.CreatedBefore.IsZero()
+}
+
+// ParseIPRange parses an address or a CIDR range. An address becomes the
+// range of itself, IPv4-mapped IPv6 addresses are unmapped.
+func ParseIPRange(s string) (netip.Prefix, error) {
+	if !strings.Contains(s, "/") {
+		addr, err := netip.ParseAddr(s)
+		if err != nil {
+			return netip.Prefix{}, err
+		}
+		addr = addr.Unmap()
+		return netip.PrefixFrom(addr, addr.BitLen()), nil
+	}
+
+	prefix, err := netip.ParsePrefix(s)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	return prefix.Masked(), nil
 }
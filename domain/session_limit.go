@@ -0,0 +1,112 @@
+package domain
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+)
+
+// SessionLimitPolicy decides what happens to a login that would exceed a
+// SessionLimit.
+type SessionLimitPolicy string
+
+const (
+	// SessionLimitReject refuses the new login.
+	SessionLimitReject SessionLimitPolicy = "reject"
+	// SessionLimitEvictOldest ends the sessions created first.
+	SessionLimitEvictOldest SessionLimitPolicy = "evict_oldest"
+	// SessionLimitEvictLRU ends the sessions that were refreshed least
+	// recently.
+	SessionLimitEvictLRU SessionLimitPolicy = "evict_lru"
+)
+
+func ParseSessionLimitPolicy(s string) (SessionLimitPolicy, error) {
+	policy := SessionLimitPolicy(strings.ToLower(strings.TrimSpace(s)))
+	switch policy {
+	case SessionLimitReject, SessionLimitEvictOldest, SessionLimitEvictLRU:
+		return policy, nil
+	}
+	return "", fmt.Errorf("unknown session limit policy %q", s)
+}
+
+// SessionLimit caps the number of active sessions of a user, overall and per
+// device type. Zero values mean no limit.
+type SessionLimit struct {
+	MaxPerUser int
+	// MaxPerDeviceType is keyed by Device.DeviceType.
+	MaxPerDeviceType map[string]int
+	Policy           SessionLimitPolicy
+}
+
+func (l SessionLimit) IsZero() bool {
+	if l.MaxPerUser > 0 {
+		return false
+	}
+	for _, n := range l.MaxPerDeviceType {
+		if n > 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// Admit decides whether session may be added next to the user's active
+// sessions. It returns the sessions to evict first, or ErrSessionLimitReached
+// if the policy rejects the login. Storage backends call it while holding a
+// per-user lock so that concurrent logins cannot both slip under the limit.
+func (l SessionLimit) Admit(active []Session, session Session, now time.Time) ([]Session, error) {
+	candidates := make([]Session, 0, len(active))
+	for _, s := range active {
+		if now.Before(s.ExpiresAt) {
+			candidates = append(candidates, s)
+		}
+	}
+
+	switch l.Policy {
+	case SessionLimitEvictLRU:
+		slices.SortStableFunc(candidates, func(a, b Session) int {
+			return a.LastUsedAt.Compare(b.LastUsedAt)
+		})
+	default:
+		slices.SortStableFunc(candidates, func(a, b Session) int {
+			return a.CreatedAt.Compare(b.CreatedAt)
+		})
+	}
+
+	var evicted []Session
+	evict := func(match func(Session) bool, limit int) error {
+		count := 0
+		for _, s := range candidates {
+			if match(s) {
+				count++
+			}
+		}
+
+		for excess := count + 1 - limit; excess > 0; excess-- {
+			if l.Policy == SessionLimitReject {
+				return ErrSessionLimitReached
+			}
+
+			i := slices.IndexFunc(candidates, match)
+			evicted = append(evicted, candidates[i])
+			candidates = slices.Delete(candidates, i, i+1)
+		}
+		return nil
+	}
+
+	deviceType := session.Device.DeviceType
+	if limit := l.MaxPerDeviceType[deviceType]; limit > 0 {
+		err := evict(func(s Session) bool { return s.Device.DeviceType == deviceType }, limit)
+		if err != nil {
+			return nil, err
+		}
+	}
+	if l.MaxPerUser > 0 {
+		if err := evict(func(Session) bool { return true }, l.MaxPerUser); err != nil {
+			return nil, err
+		}
+	}
+
+	return evicted, nil
+}
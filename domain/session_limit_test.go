@@ -0,0 +1,133 @@
+package domain
+
+import (
+	"errors"
+	"slices"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+func TestSessionLimitAdmit(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+
+	// Sessions are created a, b, c and were last used c, a, b.
+	session := func(name string, created, lastUsed int, deviceType string) Session {
+		return Session{
+			ID:         uuid.NewSHA1(uuid.Nil, []byte(name)),
+			Device:     Device{DeviceType: deviceType},
+			CreatedAt:  now.Add(time.Duration(created) * time.Minute),
+			LastUsedAt: now.Add(time.Duration(lastUsed) * time.Minute),
+			ExpiresAt:  now.Add(time.Hour),
+		}
+	}
+	a := session("a", -30, -20, "desktop")
+	b := session("b", -20, -10, "mobile")
+	c := session("c", -10, -30, "mobile")
+	expired := session("expired", -40, -40, "mobile")
+	expired.ExpiresAt = now.Add(-time.Minute)
+	active := []Session{c, expired, a, b}
+
+	desktop := session("new", 0, 0, "desktop")
+	mobile := session("new", 0, 0, "mobile")
+
+	tests := []struct {
+		name        string
+		limit       SessionLimit
+		session     Session
+		wantEvicted []Session
+		wantErr     error
+	}{
+		{
+			name:    "no limit",
+			limit:   SessionLimit{},
+			session: desktop,
+		},
+		{
+			name:    "under the limit",
+			limit:   SessionLimit{MaxPerUser: 4, Policy: SessionLimitReject},
+			session: desktop,
+		},
+		{
+			name:        "evict oldest",
+			limit:       SessionLimit{MaxPerUser: 2, Policy: SessionLimitEvictOldest},
+			session:     desktop,
+			wantEvicted: []Session{a, b},
+		},
+		{
+			name:        "evict least recently used",
+			limit:       SessionLimit{MaxPerUser: 2, Policy: SessionLimitEvictLRU},
+			session:     desktop,
+			wantEvicted: []Session{c, a},
+		},
+		{
+			name:    "reject",
+			limit:   SessionLimit{MaxPerUser: 3, Policy: SessionLimitReject},
+			session: desktop,
+			wantErr: ErrSessionLimitReached,
+		},
+		{
+			name:        "per device type",
+			limit:       SessionLimit{MaxPerDeviceType: map[string]int{"mobile": 2}, Policy: SessionLimitEvictOldest},
+			session:     mobile,
+			wantEvicted: []Session{b},
+		},
+		{
+			name:    "other device types are not limited",
+			limit:   SessionLimit{MaxPerDeviceType: map[string]int{"mobile": 1}, Policy: SessionLimitReject},
+			session: desktop,
+		},
+		{
+			name: "device evictions count toward the user limit",
+			limit: SessionLimit{
+				MaxPerUser:       3,
+				MaxPerDeviceType: map[string]int{"mobile": 1},
+				Policy:           SessionLimitEvictLRU,
+			},
+			session:     mobile,
+			wantEvicted: []Session{c, b},
+		},
+		{
+			name: "device and user limits together",
+			limit: SessionLimit{
+				MaxPerUser:       2,
+				MaxPerDeviceType: map[string]int{"mobile": 2},
+				Policy:           SessionLimitEvictOldest,
+			},
+			session:     mobile,
+			wantEvicted: []Session{b, a},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			evicted, err := tt.limit.Admit(active, tt.session, now)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("Admit: error %v, want %v", err, tt.wantErr)
+			}
+			if !slices.EqualFunc(evicted, tt.wantEvicted, func(x, y Session) bool { return x.ID == y.ID }) {
+				t.Errorf("Admit evicted %v, want %v", sessionNames(evicted), sessionNames(tt.wantEvicted))
+			}
+		})
+	}
+}
+
+func sessionNames(sessions []Session) []string {
+	ids := make([]string, len(sessions))
+	for i, s := range sessions {
+		ids[i] = s.ID.String()[:8]
+	}
+	return ids
+}
+
+func TestParseSessionLimitPolicy(t *testing.T) {
+	for _, s := range []string{"reject", " Evict_Oldest ", "EVICT_LRU"} {
+		if _, err := ParseSessionLimitPolicy(s); err != nil {
+			t.Errorf("ParseSessionLimitPolicy(%q): %v", s, err)
+		}
+	}
+	if _, err := ParseSessionLimitPolicy("evict_newest"); err == nil {
+		t.Error("ParseSessionLimitPolicy of an unknown policy: want an error")
+	}
+}
@@ -0,0 +1,52 @@
+package domain
+
+import (
+	"net/netip"
+	"testing"
+)
+
+func TestParseIPRange(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    netip.Prefix
+		wantErr bool
+	}{
+		{in: "203.0.113.7", want: netip.MustParsePrefix("203.0.113.7/32")},
+		{in: "2001:db8::1", want: netip.MustParsePrefix("2001:db8::1/128")},
+		{in: "::ffff:203.0.113.7", want: netip.MustParsePrefix("203.0.113.7/32")},
+		{in: "203.0.113.7/24", want: netip.MustParsePrefix("203.0.113.0/24")},
+		{in: "2001:db8::1/32", want: netip.MustParsePrefix("2001:db8::/32")},
+		{in: "203.0.113.7:8080", wantErr: true},
+		{in: "203.0.113.0/33", wantErr: true},
+		{in: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.in, func(t *testing.T) {
+			got, err := ParseIPRange(tt.in)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("ParseIPRange(%q) = %s, want an error", tt.in, got)
+				}
+				return
+			}
+			if err != nil || got != tt.want {
+				t.Errorf("ParseIPRange(%q) = %s, %v, want %s", tt.in, got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseUserIDs(t *testing.T) {
+	ids, err := ParseUserIDs([]string{" 6f1c0f6e-2f55-4a35-9a40-1b7c0d1f0a01 ", "", "6f1c0f6e-2f55-4a35-9a40-1b7c0d1f0a02"})
+	if err != nil {
+		t.Fatalf("ParseUserIDs: %v", err)
+	}
+	if len(ids) != 2 || ids[0].String() != "6f1c0f6e-2f55-4a35-9a40-1b7c0d1f0a01" {
+		t.Errorf("ParseUserIDs = %v", ids)
+	}
+
+	if _, err := ParseUserIDs([]string{"admin"}); err == nil {
+		t.Error("ParseUserIDs of an invalid ID: want an error")
+	}
+}
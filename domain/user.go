@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+)
+
+// ParseUserIDs parses user IDs from configuration, skipping blank entries.
+func ParseUserIDs(ids []string) ([]uuid.UUID, error) {
+	userIDs := make([]uuid.UUID, 0, len(ids))
+	for _, id := range ids {
+		id = strings.TrimSpace(id)
+		if id == "" {
+			continue
+		}
+
+		userID, err := uuid.Parse(id)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user id %q: %w", id, err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, nil
+}
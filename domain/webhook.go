@@ -0,0 +1,21 @@
+package domain
+
+import "time"
+
+const (
+	WebhookDelivered = "delivered"
+	WebhookFailed    = "failed"
+)
+
+// WebhookDelivery is one webhook payload and the outcome of its last
+// delivery attempt.
+type WebhookDelivery struct {
+	ID        int64
+	URL       string
+	Payload   []byte
+	Status    string
+	Attempts  int
+	LastError string
+	CreatedAt time.Time
+	UpdatedAt time.Time
+}
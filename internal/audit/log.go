@@ -0,0 +1,55 @@
+package audit
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	"test2auth/domain"
+
+	"github.com/google/uuid"
+)
+
+type Storage interface {
+	// AppendAuditRecord stores record after the current tail of the log.
+	// seal is called with the hash of the tail and must return the hash of
+	// the new record; reading the tail and inserting happen atomically.
+	AppendAuditRecord(ctx context.Context, record domain.AuditRecord, seal func(prevHash string, record domain.AuditRecord) string) error
+}
+
+type Log struct {
+	storage Storage
+	chain   *Chain
+	log     *slog.Logger
+}
+
+func NewLog(storage Storage, chain *Chain, log *slog.Logger) *Log {
+	return &Log{
+		storage: storage,
+		chain:   chain,
+		log:     log,
+	}
+}
+
+// Record appends an event to the audit log. Failures are logged and never
+// interrupt the caller's flow.
+func (l *Log) Record(ctx context.Context, event string, userID uuid.UUID, ip string, details map[string]string) {
+	const op = "audit.Log.Record"
+
+	if details == nil {
+		details = map[string]string{}
+	}
+
+	record := domain.AuditRecord{
+		Event:   event,
+		UserID:  userID,
+		IP:      ip,
+		Details: details,
+		// Postgres keeps microseconds, the hash must survive a round trip.
+		CreatedAt: time.Now().UTC().Truncate(time.Microsecond),
+	}
+
+	if err := l.storage.AppendAuditRecord(ctx, record, l.chain.Hash); err != nil {
+		l.log.Error("failed to append audit record", slog.String("op", op), slog.String("event", event), "error", err)
+	}
+}
@@ -9,11 +9,29 @@ import (
 )
 
 type Config struct {
-	Env        string `yaml:"env" env-default:"local"`
+	Env string `yaml:"env" env-default:"local"`
+	// StorageURL is a postgres URL, sqlite://path, redis:// or rediss://, or
+	// memory:// to keep everything in process memory.
 	StorageURL string `yaml:"storage_url" env:"POSTGRES_URL" env-required:"true"`
-	HTTPServer `yaml:"http_server"`
-	JWT        `yaml:"jwt"`
-	WebhookURL string `yaml:"webhook_url" env:"WEBHOOK_URL" env-required:"true"`
+	// AutoMigrate applies pending migrations when serve starts. With several
+	// replicas run "migrate up" as a deploy step instead.
+	AutoMigrate   bool `yaml:"auto_migrate" env:"AUTO_MIGRATE" env-default:"false"`
+	HTTPServer    `yaml:"http_server"`
+	JWT           `yaml:"jwt"`
+	WebhookURL    string `yaml:"webhook_url" env:"WEBHOOK_URL" env-required:"true"`
+	Webhook       `yaml:"webhook"`
+	Audit         `yaml:"audit"`
+	RateLimit     `yaml:"rate_limit"`
+	Lockout       `yaml:"lockout"`
+	Policy        `yaml:"policy"`
+	GeoIP         `yaml:"geoip"`
+	Admin         `yaml:"admin"`
+	SessionLimit  `yaml:"session_limit"`
+	RefreshCookie `yaml:"refresh_cookie"`
+	CORS          `yaml:"cors"`
+	Janitor       `yaml:"janitor"`
+	Tracing       `yaml:"tracing"`
+	Metrics       `yaml:"metrics"`
 }
 
 type HTTPServer struct {
@@ -21,12 +39,124 @@ type HTTPServer struct {
 	Port        string        `yaml:"port" env:"APP_PORT" env-required:"true"`
 	Timeout     time.Duration `yaml:"timeout" env-default:"4s"`
 	IdleTimeout time.Duration `yaml:"idle_timeout" env-default:"60s"`
+	// TrustedProxies lists CIDRs or addresses of reverse proxies whose
+	// ForwardedHeader is believed.
+	TrustedProxies []string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES" env-separator:","`
+	// ForwardedHeader is the header the trusted proxies write,
+	// "x-forwarded-for" or "forwarded". The other one is never read, since a
+	// proxy passes it on from the client as it is.
+	ForwardedHeader string `yaml:"forwarded_header" env:"FORWARDED_HEADER" env-default:"x-forwarded-for"`
+}
+
+// Metrics serves GET /metrics on its own listener, away from the public API.
+// An empty Address disables it.
+type Metrics struct {
+	Address string `yaml:"address" env:"METRICS_ADDRESS" env-default:"localhost:9090"`
 }
 
 type JWT struct {
 	Secret     string        `yaml:"secret" env:"JWT_SECRET" env-required:"true"`
 	AccessTTL  time.Duration `yaml:"access_ttl" env-default:"15m"`
 	RefreshTTL time.Duration `yaml:"refresh_ttl" env-default:"72h"`
+	// SessionIdleTimeout ends a session that was not refreshed for that long,
+	// SessionMaxLifetime ends it that long after login. Zero disables them.
+	SessionIdleTimeout time.Duration `yaml:"session_idle_timeout" env-default:"0s"`
+	SessionMaxLifetime time.Duration `yaml:"session_max_lifetime" env-default:"0s"`
+	// RefreshGracePeriod is how long a just rotated refresh token still gets
+	// the pair that replaced it. Zero disables it, otherwise RefreshTokenKey
+	// is required: it seals the pair kept in the session.
+	RefreshGracePeriod time.Duration `yaml:"refresh_grace_period" env-default:"0s"`
+	// RefreshTokenKey keys the hash of stored refresh tokens, Secret is used
+	// if it is empty. Changing it invalidates all refresh tokens.
+	RefreshTokenKey string `yaml:"refresh_token_key" env:"REFRESH_TOKEN_KEY" env-default:""`
+	// BindAccessToken requires the session's access token on refresh.
+	BindAccessToken bool `yaml:"bind_access_token" env-default:"false"`
+	// KeysReloadInterval is how often signing keys rotated with authctl are
+	// picked up. Only the postgres storage keeps signing keys.
+	KeysReloadInterval time.Duration `yaml:"keys_reload_interval" env-default:"1m"`
+	// KeysEncryptionKey seals the stored signing keys, using or rotating
+	// them needs it.
+	KeysEncryptionKey string `yaml:"keys_encryption_key" env:"JWT_KEYS_ENCRYPTION_KEY" env-default:""`
+	// RequireKID rejects access tokens without a key ID, i.e. signed with
+	// Secret. Turn it on after cutting over to rotated keys.
+	RequireKID bool `yaml:"require_kid" env:"JWT_REQUIRE_KID" env-default:"false"`
+}
+
+// Webhook tunes the delivery of notifications to WebhookURL.
+type Webhook struct {
+	Timeout time.Duration `yaml:"timeout" env-default:"5s"`
+	// QueueSize bounds the notifications waiting for delivery, further ones
+	// are dropped and logged.
+	QueueSize int `yaml:"queue_size" env-default:"1000"`
+	// Retention is how long the janitor keeps delivery logs. Zero keeps them.
+	Retention time.Duration `yaml:"retention" env-default:"720h"`
+}
+
+type Audit struct {
+	// HMACKey turns the audit hash chain into an HMAC chain. It must stay the
+	// same for the lifetime of the log, otherwise verification fails.
+	HMACKey string `yaml:"hmac_key" env:"AUDIT_HMAC_KEY" env-default:""`
+}
+
+type RateLimit struct {
+	Enabled bool `yaml:"enabled" env:"RATE_LIMIT_ENABLED" env-default:"true"`
+	// Backend is "memory" for a single replica or "postgres" to share
+	// buckets between replicas.
+	Backend  string `yaml:"backend" env:"RATE_LIMIT_BACKEND" env-default:"memory"`
+	PerIP    Limit  `yaml:"per_ip"`
+	PerUser  Limit  `yaml:"per_user"`
+	PerRoute Limit  `yaml:"per_route"`
+}
+
+// Limit allows Requests per Period with bursts of up to Burst requests
+// (Requests if unset). Zero Requests disables the limit.
+type Limit struct {
+	Requests int           `yaml:"requests" env-default:"0"`
+	Period   time.Duration `yaml:"period" env-default:"1m"`
+	Burst    int           `yaml:"burst" env-default:"0"`
+}
+
+// Lockout locks a user or an IP address out of token refresh after Threshold
+// failures within Window. Lockouts start at BaseDuration and double with
+// every further failure up to MaxDuration.
+type Lockout struct {
+	Enabled      bool          `yaml:"enabled" env:"LOCKOUT_ENABLED" env-default:"true"`
+	Backend      string        `yaml:"backend" env:"LOCKOUT_BACKEND" env-default:"memory"`
+	Threshold    int           `yaml:"threshold" env-default:"5"`
+	Window       time.Duration `yaml:"window" env-default:"15m"`
+	BaseDuration time.Duration `yaml:"base_duration" env-default:"1m"`
+	MaxDuration  time.Duration `yaml:"max_duration" env-default:"1h"`
+}
+
+// Policy sets the reaction to each refresh anomaly: allow, notify,
+// require_step_up, deny or revoke. The strongest reaction among the detected
+// anomalies wins. ASN and geo changes need GeoIP data to be detected.
+// TokenAge fires once the refresh token is older than MaxTokenAge, counted
+// from the refresh that issued it or from login; zero disables it.
+type Policy struct {
+	// UserAgentMatch is exact, family_os (browser family and OS must stay the
+	// same, versions may change) or off.
+	UserAgentMatch   string        `yaml:"user_agent_match" env-default:"exact"`
+	UserAgentChange  string        `yaml:"user_agent_change" env-default:"revoke"`
+	IPChange         string        `yaml:"ip_change" env-default:"notify"`
+	SubnetChange     string        `yaml:"subnet_change" env-default:"allow"`
+	ASNChange        string        `yaml:"asn_change" env-default:"allow"`
+	GeoChange        string        `yaml:"geo_change" env-default:"allow"`
+	ImpossibleTravel string        `yaml:"impossible_travel" env-default:"notify"`
+	TokenAge         string        `yaml:"token_age" env-default:"allow"`
+	MaxTokenAge      time.Duration `yaml:"max_token_age" env-default:"0"`
+}
+
+// GeoIP enables location enrichment from local MaxMind-format .mmdb files.
+// Leave both paths empty to disable it.
+type GeoIP struct {
+	CityDB string `yaml:"city_db" env:"GEOIP_CITY_DB" env-default:""`
+	ASNDB  string `yaml:"asn_db" env:"GEOIP_ASN_DB" env-default:""`
+	// MaxTravelSpeed in km/h above which consecutive refreshes are considered
+	// impossible travel. Zero disables the check.
+	MaxTravelSpeed float64 `yaml:"max_travel_speed" env-default:"1000"`
+	// MinTravelDistance in km below which travel is never flagged.
+	MinTravelDistance float64 `yaml:"min_travel_distance" env-default:"200"`
 }
 
 func MustLoad() *Config {
@@ -55,3 +185,69 @@ func MustLoad() *Config {
 
 	return &cfg
 }
+
+type SessionLimit struct {
+	// MaxPerUser caps active sessions of a user, MaxPerDeviceType caps them
+	// per device type (desktop, mobile, tablet, bot). Zero means no limit.
+	MaxPerUser       int            `yaml:"max_per_user" env:"SESSION_LIMIT_MAX_PER_USER" env-default:"0"`
+	MaxPerDeviceType map[string]int `yaml:"max_per_device_type"`
+	// OnExceed is reject, evict_oldest or evict_lru.
+	OnExceed string `yaml:"on_exceed" env-default:"evict_lru"`
+}
+
+// RefreshCookie enables cookie mode for browser clients, see
+// authhttp.RefreshCookie.
+type RefreshCookie struct {
+	Enabled        bool     `yaml:"enabled" env:"REFRESH_COOKIE_ENABLED" env-default:"false"`
+	Name           string   `yaml:"name" env-default:"refresh_token"`
+	Path           string   `yaml:"path" env-default:"/auth/tokens/refresh"`
+	Domain         string   `yaml:"domain" env-default:""`
+	SameSite       string   `yaml:"same_site" env-default:"strict"`
+	Secure         bool     `yaml:"secure" env-default:"true"`
+	CSRFCookie     string   `yaml:"csrf_cookie" env-default:"csrf_token"`
+	CSRFHeader     string   `yaml:"csrf_header" env-default:"X-CSRF-Token"`
+	TrustedOrigins []string `yaml:"trusted_origins" env:"REFRESH_COOKIE_TRUSTED_ORIGINS" env-separator:","`
+}
+
+// CORS lets browser apps on other origins call the API. Origins may be exact,
+// wildcard subdomains like "https://*.example.com" or "*". No origins means
+// CORS is off.
+type CORS struct {
+	AllowedOrigins   []string      `yaml:"allowed_origins" env:"CORS_ALLOWED_ORIGINS" env-separator:","`
+	AllowedMethods   []string      `yaml:"allowed_methods" env-default:"GET,POST,DELETE"`
+	AllowedHeaders   []string      `yaml:"allowed_headers" env-default:"Authorization,Content-Type,X-CSRF-Token"`
+	ExposedHeaders   []string      `yaml:"exposed_headers" env-default:"Retry-After"`
+	AllowCredentials bool          `yaml:"allow_credentials" env-default:"false"`
+	MaxAge           time.Duration `yaml:"max_age" env-default:"10m"`
+}
+
+type Admin struct {
+	// UserIDs may get admin tokens from "authctl token issue -admin", valid
+	// for TokenTTL. Removing a user here rejects their admin tokens at once.
+	UserIDs []string `yaml:"user_ids" env:"ADMIN_USER_IDS" env-separator:","`
+	// TokenTTL is the lifetime of admin tokens. They carry sid=uuid.Nil,
+	// which names no session, so logging out or revoking sessions cannot end
+	// them.
+	TokenTTL time.Duration `yaml:"token_ttl" env-default:"15m"`
+}
+
+// Janitor purges expired sessions every Interval, at most MaxBatches batches
+// of BatchSize sessions per run.
+type Janitor struct {
+	Enabled    bool          `yaml:"enabled" env:"JANITOR_ENABLED" env-default:"true"`
+	Interval   time.Duration `yaml:"interval" env-default:"10m"`
+	BatchSize  int           `yaml:"batch_size" env-default:"1000"`
+	MaxBatches int           `yaml:"max_batches" env-default:"100"`
+}
+
+// Tracing exports OpenTelemetry spans. Exporter is none, stdout (pretty
+// printed spans, for local runs) or otlp (OTLP over HTTP to Endpoint).
+type Tracing struct {
+	Exporter string `yaml:"exporter" env:"TRACING_EXPORTER" env-default:"none"`
+	// Endpoint is host:port of the collector. Empty falls back to the
+	// standard OTEL_EXPORTER_OTLP_ENDPOINT variable or localhost:4318.
+	Endpoint    string  `yaml:"endpoint" env:"TRACING_ENDPOINT" env-default:""`
+	Insecure    bool    `yaml:"insecure" env:"TRACING_INSECURE" env-default:"false"`
+	ServiceName string  `yaml:"service_name" env-default:"auth-service"`
+	SampleRatio float64 `yaml:"sample_ratio" env:"TRACING_SAMPLE_RATIO" env-default:"1"`
+}
@@ -0,0 +1,128 @@
+package geoip
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"net"
+	"net/netip"
+	"test2auth/domain"
+	"time"
+
+	"github.com/oschwald/geoip2-golang"
+)
+
+const earthRadiusKm = 6371.0
+
+// Resolver reads MaxMind-format databases: a City (or Country) database for
+// the place and an ASN database for the network owner. Either may be absent.
+type Resolver struct {
+	city *geoip2.Reader
+	asn  *geoip2.Reader
+}
+
+func Open(cityPath, asnPath string) (*Resolver, error) {
+	const op = "geoip.Open"
+
+	r := &Resolver{}
+
+	if cityPath != "" {
+		city, err := geoip2.Open(cityPath)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		r.city = city
+	}
+
+	if asnPath != "" {
+		asn, err := geoip2.Open(asnPath)
+		if err != nil {
+			r.Close()
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		r.asn = asn
+	}
+
+	return r, nil
+}
+
+// Lookup never fails: unknown addresses yield an empty location.
+func (r *Resolver) Lookup(ip netip.Addr) domain.Location {
+	var loc domain.Location
+	if !ip.IsValid() {
+		return loc
+	}
+
+	addr := net.IP(ip.AsSlice())
+
+	if r.city != nil {
+		if city, err := r.city.City(addr); err == nil {
+			loc.Country = city.Country.IsoCode
+			loc.City = city.City.Names["en"]
+			loc.Latitude = city.Location.Latitude
+			loc.Longitude = city.Location.Longitude
+		}
+	}
+
+	if r.asn != nil {
+		if asn, err := r.asn.ASN(addr); err == nil {
+			loc.ASN = asn.AutonomousSystemNumber
+			loc.ASOrg = asn.AutonomousSystemOrganization
+		}
+	}
+
+	return loc
+}
+
+func (r *Resolver) Close() error {
+	var errs []error
+	if r.city != nil {
+		errs = append(errs, r.city.Close())
+	}
+	if r.asn != nil {
+		errs = append(errs, r.asn.Close())
+	}
+	return errors.Join(errs...)
+}
+
+// DistanceKm is the great-circle distance between two locations.
+func DistanceKm(a, b domain.Location) float64 {
+	lat1 := a.Latitude * math.Pi / 180
+	lat2 := b.Latitude * math.Pi / 180
+	dLat := lat2 - lat1
+	dLon := (b.Longitude - a.Longitude) * math.Pi / 180
+
+	h := math.Sin(dLat/2)*math.Sin(dLat/2) + math.Cos(lat1)*math.Cos(lat2)*math.Sin(dLon/2)*math.Sin(dLon/2)
+	return 2 * earthRadiusKm * math.Asin(math.Sqrt(h))
+}
+
+// TravelCheck flags consecutive requests that are too far apart to have been
+// made by the same person. Distances below MinDistanceKm are ignored, GeoIP
+// coordinates are not precise enough for them.
+type TravelCheck struct {
+	MaxSpeedKmh   float64
+	MinDistanceKm float64
+}
+
+type Travel struct {
+	DistanceKm float64
+	SpeedKmh   float64
+}
+
+// Impossible reports whether getting from one location to the other within
+// elapsed needs a speed above MaxSpeedKmh. A zero MaxSpeedKmh disables it.
+func (c TravelCheck) Impossible(from, to domain.Location, elapsed time.Duration) (Travel, bool) {
+	if c.MaxSpeedKmh <= 0 || !from.HasCoordinates() || !to.HasCoordinates() {
+		return Travel{}, false
+	}
+
+	travel := Travel{DistanceKm: DistanceKm(from, to)}
+	if travel.DistanceKm < c.MinDistanceKm {
+		return travel, false
+	}
+
+	hours := math.Max(elapsed.Hours(), time.Second.Hours())
+	travel.SpeedKmh = travel.DistanceKm / hours
+
+	return travel, travel.SpeedKmh > c.MaxSpeedKmh
+}
@@ -0,0 +1,275 @@
+package http
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"test2auth/domain"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type AdminService interface {
+	FindSessions(ctx context.Context, actorID uuid.UUID, filter domain.SessionFilter) ([]domain.Session, error)
+	RevokeSession(ctx context.Context, actorID, sessionID uuid.UUID) error
+	RevokeUserSessions(ctx context.Context, actorID, userID uuid.UUID) (int64, error)
+	RevokeSessions(ctx context.Context, actorID uuid.UUID, filter domain.SessionFilter) (int64, error)
+}
+
+// AdminHandler serves the admin API. Its routes must be mounted behind
+// AuthMiddleware, RequireScope with the admin scope and RequireUser with the
+// admins.
+type AdminHandler struct {
+	adminService AdminService
+}
+
+func NewAdminHandler(adminService AdminService) *AdminHandler {
+	return &AdminHandler{adminService: adminService}
+}
+
+type adminSessionResponse struct {
+	UserID string `json:"user_id"`
+	sessionResponse
+}
+
+type revokedResponse struct {
+	Revoked int64 `json:"revoked"`
+}
+
+// sessionFilterRequest is shared by the query string of GET /admin/sessions
+// and the body of POST /admin/sessions/revoke.
+type sessionFilterRequest struct {
+	UserID string `json:"user_id"`
+	// IP is a single address or a CIDR range.
+	IP            string `json:"ip"`
+	UserAgent     string `json:"user_agent"`
+	CreatedAfter  string `json:"created_after"`
+	CreatedBefore string `json:"created_before"`
+}
+
+func (req sessionFilterRequest) filter() (domain.SessionFilter, error) {
+	var filter domain.SessionFilter
+
+	if req.UserID != "" {
+		userID, err := uuid.Parse(req.UserID)
+		if err != nil {
+			return domain.SessionFilter{}, errors.New("invalid user_id")
+		}
+		filter.UserID = userID
+	}
+
+	if req.IP != "" {
+		ipRange, err := domain.ParseIPRange(req.IP)
+		if err != nil {
+			return domain.SessionFilter{}, errors.New("invalid ip")
+		}
+		filter.IPRange = ipRange
+	}
+
+	filter.UserAgent = strings.TrimSpace(req.UserAgent)
+
+	if req.CreatedAfter != "" {
+		createdAfter, err := time.Parse(time.RFC3339, req.CreatedAfter)
+		if err != nil {
+			return domain.SessionFilter{}, errors.New("invalid created_after")
+		}
+		filter.CreatedAfter = createdAfter
+	}
+
+	if req.CreatedBefore != "" {
+		createdBefore, err := time.Parse(time.RFC3339, req.CreatedBefore)
+		if err != nil {
+			return domain.SessionFilter{}, errors.New("invalid created_before")
+		}
+		filter.CreatedBefore = createdBefore
+	}
+
+	return filter, nil
+}
+
+// ListSessions godoc
+// @Summary      Find sessions
+// @Description  Find sessions of any user by user, IP address or range, user agent substring and creation time, newest first
+// @Tags         admin
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        user_id query string false "User ID (GUID)"
+// @Param        ip query string false "IP address or CIDR range"
+// @Param        user_agent query string false "User agent substring"
+// @Param        created_after query string false "RFC 3339 time"
+// @Param        created_before query string false "RFC 3339 time"
+// @Param        limit query int false "Maximum number of sessions"
+// @Success      200 {array} adminSessionResponse
+// @Failure      400 {object} errorResponse
+// @Failure      401 {object} errorResponse
+// @Failure      403 {object} errorResponse
+// @Failure      500 {object} errorResponse
+// @Router       /admin/sessions [get]
+func (h *AdminHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	actorID, _, ok := currentSession(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	filter, err := sessionFilterRequest{
+		UserID:        query.Get("user_id"),
+		IP:            query.Get("ip"),
+		UserAgent:     query.Get("user_agent"),
+		CreatedAfter:  query.Get("created_after"),
+		CreatedBefore: query.Get("created_before"),
+	}.filter()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if limitStr := query.Get("limit"); limitStr != "" {
+		limit, err := strconv.Atoi(limitStr)
+		if err != nil || limit < 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		filter.Limit = limit
+	}
+
+	sessions, err := h.adminService.FindSessions(r.Context(), actorID, filter)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to find sessions")
+		return
+	}
+
+	resp := make([]adminSessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		resp = append(resp, adminSessionResponse{
+			UserID:          session.UserID.String(),
+			sessionResponse: newSessionResponse(session, uuid.Nil),
+		})
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// RevokeSession godoc
+// @Summary      Revoke any session
+// @Description  Revoke a single session of any user
+// @Tags         admin
+// @Security     ApiKeyAuth
+// @Param        id path string true "Session ID (GUID)"
+// @Success      204
+// @Failure      400 {object} errorResponse
+// @Failure      401 {object} errorResponse
+// @Failure      403 {object} errorResponse
+// @Failure      404 {object} errorResponse
+// @Failure      500 {object} errorResponse
+// @Router       /admin/sessions/{id} [delete]
+func (h *AdminHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	actorID, _, ok := currentSession(w, r)
+	if !ok {
+		return
+	}
+
+	sessionID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid session id")
+		return
+	}
+
+	if err := h.adminService.RevokeSession(r.Context(), actorID, sessionID); err != nil {
+		if errors.Is(err, domain.ErrSessionNotFound) {
+			writeError(w, http.StatusNotFound, domain.ErrSessionNotFound.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to revoke session")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// RevokeUserSessions godoc
+// @Summary      Revoke all sessions of a user
+// @Description  Log a user out of every device
+// @Tags         admin
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        user_id path string true "User ID (GUID)"
+// @Success      200 {object} revokedResponse
+// @Failure      400 {object} errorResponse
+// @Failure      401 {object} errorResponse
+// @Failure      403 {object} errorResponse
+// @Failure      500 {object} errorResponse
+// @Router       /admin/users/{user_id}/sessions [delete]
+func (h *AdminHandler) RevokeUserSessions(w http.ResponseWriter, r *http.Request) {
+	actorID, _, ok := currentSession(w, r)
+	if !ok {
+		return
+	}
+
+	userID, err := uuid.Parse(chi.URLParam(r, "user_id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid user_id")
+		return
+	}
+
+	revoked, err := h.adminService.RevokeUserSessions(r.Context(), actorID, userID)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "failed to revoke sessions")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revokedResponse{Revoked: revoked})
+}
+
+// RevokeSessions godoc
+// @Summary      Bulk revoke sessions
+// @Description  Revoke every session matching the filter, e.g. an IP range or a creation window. At least one filter is required
+// @Tags         admin
+// @Accept       json
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Param        input body sessionFilterRequest true "Session filter"
+// @Success      200 {object} revokedResponse
+// @Failure      400 {object} errorResponse
+// @Failure      401 {object} errorResponse
+// @Failure      403 {object} errorResponse
+// @Failure      500 {object} errorResponse
+// @Router       /admin/sessions/revoke [post]
+func (h *AdminHandler) RevokeSessions(w http.ResponseWriter, r *http.Request) {
+	actorID, _, ok := currentSession(w, r)
+	if !ok {
+		return
+	}
+
+	var req sessionFilterRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	filter, err := req.filter()
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	revoked, err := h.adminService.RevokeSessions(r.Context(), actorID, filter)
+	if err != nil {
+		if errors.Is(err, domain.ErrEmptyFilter) {
+			writeError(w, http.StatusBadRequest, domain.ErrEmptyFilter.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to revoke sessions")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(revokedResponse{Revoked: revoked})
+}
@@ -0,0 +1,101 @@
+package http_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	authhttp "test2auth/internal/handler/http"
+	"test2auth/internal/jwtkeys"
+	"test2auth/internal/service"
+	"test2auth/internal/storage/memory"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+const testSecret = "test-secret"
+
+// newAdminRouter mounts the token and admin routes the way the server does,
+// with adminID as the only admin.
+func newAdminRouter(t *testing.T, adminID uuid.UUID) (http.Handler, service.AuthService) {
+	t.Helper()
+
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	storage := memory.New()
+	keys := jwtkeys.NewSet(testSecret, nil)
+	admins := []uuid.UUID{adminID}
+
+	authService := service.NewAuthService(storage, log, testSecret, "http://127.0.0.1:0", time.Minute, time.Hour,
+		service.WithSigningKeys(keys),
+		service.WithAdmins(admins, time.Minute),
+	)
+	authHandler := authhttp.NewAuthHandler(authService, keys, nil)
+	adminHandler := authhttp.NewAdminHandler(service.NewAdminService(storage, log, nil))
+
+	router := chi.NewRouter()
+	router.Post("/auth/tokens", authHandler.CreateTokens)
+	router.Group(func(r chi.Router) {
+		r.Use(authHandler.AuthMiddleware)
+		r.Use(authhttp.RequireScope(service.ScopeAdmin))
+		r.Use(authhttp.RequireUser(admins))
+		r.Get("/admin/sessions", adminHandler.ListSessions)
+	})
+
+	return router, authService
+}
+
+func TestAdminAPIRejectsPublicTokens(t *testing.T) {
+	adminID := uuid.New()
+	router, _ := newAdminRouter(t, adminID)
+
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/auth/tokens?user_id="+adminID.String(), nil))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("POST /auth/tokens: status %d: %s", rec.Code, rec.Body)
+	}
+
+	var tokens struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(rec.Body).Decode(&tokens); err != nil {
+		t.Fatalf("decode tokens: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/sessions?user_id="+adminID.String(), nil)
+	req.Header.Set("Authorization", "Bearer "+tokens.AccessToken)
+	rec = httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("GET /admin/sessions with a token of /auth/tokens: status %d, want %d", rec.Code, http.StatusForbidden)
+	}
+}
+
+func TestAdminAPIAcceptsAdminTokens(t *testing.T) {
+	adminID := uuid.New()
+	router, authService := newAdminRouter(t, adminID)
+
+	if _, err := authService.IssueAdminToken(context.Background(), uuid.New()); err == nil {
+		t.Fatal("IssueAdminToken for a user that is not an admin: want an error")
+	}
+
+	token, err := authService.IssueAdminToken(context.Background(), adminID)
+	if err != nil {
+		t.Fatalf("IssueAdminToken: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/admin/sessions?user_id="+adminID.String(), nil)
+	req.Header.Set("Authorization", "Bearer "+token)
+	rec := httptest.NewRecorder()
+	router.ServeHTTP(rec, req)
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("GET /admin/sessions with an admin token: status %d: %s", rec.Code, rec.Body)
+	}
+}
@@ -4,33 +4,79 @@ import (
 	"context"
 	"encoding/json"
 	"errors"
+	"io"
+	"math"
 	"net/http"
+	"net/netip"
+	"strconv"
 	"test2auth/domain"
+	"test2auth/internal/jwtkeys"
+	"test2auth/internal/tracing"
+	"time"
 
 	"github.com/google/uuid"
 )
 
 type AuthService interface {
-	CreateTokens(ctx context.Context, userID uuid.UUID, userAgent, ip string) (accessToken, refreshToken string, err error)
-	RefreshTokens(ctx context.Context, accessToken, refreshToken, userAgent, ip string) (newAccessToken, newRefreshToken string, err error)
-	Logout(ctx context.Context, userID uuid.UUID) error
+	CreateTokens(ctx context.Context, userID uuid.UUID, userAgent string, ip netip.Addr) (accessToken, refreshToken string, err error)
+	RefreshTokens(ctx context.Context, accessToken, refreshToken, userAgent string, ip netip.Addr) (newAccessToken, newRefreshToken string, err error)
+	Logout(ctx context.Context, userID, sessionID uuid.UUID) error
+	LogoutAll(ctx context.Context, userID uuid.UUID) error
+	ListSessions(ctx context.Context, userID uuid.UUID) ([]domain.Session, error)
+	RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error
+	RefreshTokenOwner(ctx context.Context, refreshToken string) (uuid.UUID, error)
 }
 
 type AuthHandler struct {
 	authService AuthService
-	jwtSecret   string
+	keys        *jwtkeys.Set
+	cookie      *RefreshCookie
 }
 
-func NewAuthHandler(authService AuthService, jwtSecret string) *AuthHandler {
+// NewAuthHandler builds the auth handler. A nil cookie disables cookie mode.
+func NewAuthHandler(authService AuthService, keys *jwtkeys.Set, cookie *RefreshCookie) *AuthHandler {
 	return &AuthHandler{
 		authService: authService,
-		jwtSecret:   jwtSecret,
+		keys:        keys,
+		cookie:      cookie,
 	}
 }
 
+// tokensResponse carries the refresh token only in JSON mode. In cookie mode
+// it carries the CSRF token to send back on refresh instead.
 type tokensResponse struct {
 	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
+	RefreshToken string `json:"refresh_token,omitempty"`
+	CSRFToken    string `json:"csrf_token,omitempty"`
+}
+
+// writeTokens answers with the pair, putting the refresh token into a cookie
+// in cookie mode.
+func (h *AuthHandler) writeTokens(w http.ResponseWriter, accessToken, refreshToken string, cookieMode bool) {
+	resp := tokensResponse{
+		AccessToken:  accessToken,
+		RefreshToken: refreshToken,
+	}
+
+	if cookieMode {
+		csrfToken, err := h.cookie.setTokens(w, refreshToken)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, "failed to set cookies")
+			return
+		}
+		resp.RefreshToken = ""
+		resp.CSRFToken = csrfToken
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// clearCookies drops the refresh token cookie in cookie mode.
+func (h *AuthHandler) clearCookies(w http.ResponseWriter) {
+	if h.cookie != nil {
+		h.cookie.clear(w)
+	}
 }
 
 type errorResponse struct {
@@ -43,18 +89,40 @@ func writeError(w http.ResponseWriter, statusCode int, message string) {
 	json.NewEncoder(w).Encode(errorResponse{Message: message})
 }
 
+// writeLockoutError answers 423 for a locked user and 429 for a locked
+// client address.
+func writeLockoutError(w http.ResponseWriter, err *domain.LockoutError) {
+	retryAfter := int(math.Ceil(time.Until(err.Until).Seconds()))
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	w.Header().Set("Retry-After", strconv.Itoa(retryAfter))
+
+	statusCode := http.StatusLocked
+	if err.ByIP {
+		statusCode = http.StatusTooManyRequests
+	}
+	writeError(w, statusCode, err.Error())
+}
+
 // CreateTokens godoc
 // @Summary      Create a new pair of tokens
-// @Description  Create access and refresh tokens for a user
+// @Description  Create access and refresh tokens for a user. With delivery=cookie the refresh token is set as an HttpOnly cookie and the response carries a CSRF token instead
 // @Tags         auth
 // @Accept       json
 // @Produce      json
 // @Param        user_id query string true "User ID (GUID)"
+// @Param        delivery query string false "Refresh token delivery" Enums(json, cookie)
 // @Success      200 {object} tokensResponse
 // @Failure      400 {object} errorResponse
+// @Failure      409 {object} errorResponse
+// @Failure      429 {object} errorResponse
 // @Failure      500 {object} errorResponse
 // @Router       /auth/tokens [post]
 func (h *AuthHandler) CreateTokens(w http.ResponseWriter, r *http.Request) {
+	r, span := startSpan(r, "handler.http.AuthHandler.CreateTokens")
+	defer span.End()
+
 	userIDStr := r.URL.Query().Get("user_id")
 	if userIDStr == "" {
 		writeError(w, http.StatusBadRequest, "user_id is required")
@@ -67,64 +135,124 @@ func (h *AuthHandler) CreateTokens(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	cookieMode := r.URL.Query().Get("delivery") == deliveryCookie
+	if cookieMode && h.cookie == nil {
+		writeError(w, http.StatusBadRequest, "cookie delivery is disabled")
+		return
+	}
+
 	userAgent := r.UserAgent()
-	ip := r.RemoteAddr
+	ip := clientIP(r)
 
 	accessToken, refreshToken, err := h.authService.CreateTokens(r.Context(), userID, userAgent, ip)
 	if err != nil {
+		tracing.RecordError(span, err)
+		if errors.Is(err, domain.ErrSessionLimitReached) {
+			writeError(w, http.StatusConflict, domain.ErrSessionLimitReached.Error())
+			return
+		}
 		writeError(w, http.StatusInternalServerError, "failed to create tokens")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(tokensResponse{
-		AccessToken:  accessToken,
-		RefreshToken: refreshToken,
-	})
+	h.writeTokens(w, accessToken, refreshToken, cookieMode)
 }
 
 type refreshRequest struct {
-	AccessToken  string `json:"access_token"`
-	RefreshToken string `json:"refresh_token"`
+	// AccessToken is the last access token of the session, expired or not.
+	// It is only required when access token binding is enabled.
+	AccessToken string `json:"access_token,omitempty"`
+	// RefreshToken is read from the cookie in cookie mode.
+	RefreshToken string `json:"refresh_token,omitempty"`
 }
 
 // RefreshTokens godoc
 // @Summary      Refresh a pair of tokens
-// @Description  Refresh access and refresh tokens using a valid refresh token
+// @Description  Refresh access and refresh tokens using a valid refresh token. The access token is optional unless access token binding is enabled; if sent, it must belong to the same session. In cookie mode the refresh token comes from the cookie and the CSRF token must be sent in the X-CSRF-Token header
 // @Tags         auth
 // @Accept       json
 // @Produce      json
-// @Param        input body refreshRequest true "Access and Refresh Tokens"
+// @Param        input body refreshRequest false "Refresh token and, optionally, access token"
+// @Param        X-CSRF-Token header string false "CSRF token, required in cookie mode"
 // @Success      200 {object} tokensResponse
 // @Failure      400 {object} errorResponse
 // @Failure      401 {object} errorResponse
+// @Failure      403 {object} errorResponse
+// @Failure      409 {object} errorResponse
+// @Failure      423 {object} errorResponse
+// @Failure      429 {object} errorResponse
 // @Failure      500 {object} errorResponse
 // @Router       /auth/tokens/refresh [post]
 func (h *AuthHandler) RefreshTokens(w http.ResponseWriter, r *http.Request) {
+	r, span := startSpan(r, "handler.http.AuthHandler.RefreshTokens")
+	defer span.End()
+
 	var req refreshRequest
-	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && !errors.Is(err, io.EOF) {
 		writeError(w, http.StatusBadRequest, "invalid request body")
 		return
 	}
 
+	// Cookie mode: the body carries no refresh token, the browser sent it
+	cookieMode := false
+	if req.RefreshToken == "" && h.cookie != nil {
+		req.RefreshToken = h.cookie.refreshToken(r)
+		cookieMode = req.RefreshToken != ""
+	}
+	if req.RefreshToken == "" {
+		writeError(w, http.StatusBadRequest, "refresh_token is required")
+		return
+	}
+	if cookieMode {
+		if reason := h.cookie.checkCSRF(r); reason != "" {
+			writeError(w, http.StatusForbidden, reason)
+			return
+		}
+	}
+
 	userAgent := r.UserAgent()
-	ip := r.RemoteAddr
+	ip := clientIP(r)
 
 	newAccessToken, newRefreshToken, err := h.authService.RefreshTokens(r.Context(), req.AccessToken, req.RefreshToken, userAgent, ip)
 	if err != nil {
-		if errors.Is(err, domain.ErrInvalidRefreshToken) || errors.Is(err, domain.ErrSessionExpired) || errors.Is(err, domain.ErrSessionNotFound) {
+		tracing.RecordError(span, err)
+		var lockoutErr *domain.LockoutError
+		if errors.As(err, &lockoutErr) {
+			writeLockoutError(w, lockoutErr)
+			return
+		}
+		if errors.Is(err, domain.ErrInvalidRefreshToken) || errors.Is(err, domain.ErrInvalidAccessToken) || errors.Is(err, domain.ErrSessionExpired) || errors.Is(err, domain.ErrSessionNotFound) ||
+			errors.Is(err, domain.ErrSessionIdleTimeout) || errors.Is(err, domain.ErrSessionLifetimeExceeded) {
+			if cookieMode {
+				h.clearCookies(w)
+			}
 			writeError(w, http.StatusUnauthorized, err.Error())
 			return
 		}
+		if errors.Is(err, domain.ErrSessionRevoked) {
+			if cookieMode {
+				h.clearCookies(w)
+			}
+			writeError(w, http.StatusUnauthorized, domain.ErrSessionRevoked.Error())
+			return
+		}
+		if errors.Is(err, domain.ErrRefreshConflict) {
+			writeError(w, http.StatusConflict, domain.ErrRefreshConflict.Error())
+			return
+		}
+		if errors.Is(err, domain.ErrRefreshDenied) {
+			writeError(w, http.StatusForbidden, domain.ErrRefreshDenied.Error())
+			return
+		}
+		if errors.Is(err, domain.ErrStepUpRequired) {
+			writeError(w, http.StatusForbidden, domain.ErrStepUpRequired.Error())
+			return
+		}
 		writeError(w, http.StatusInternalServerError, "internal server error")
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(tokensResponse{
-		AccessToken:  newAccessToken,
-		RefreshToken: newRefreshToken,
-	})
+	h.writeTokens(w, newAccessToken, newRefreshToken, cookieMode)
 }
 
 type guidResponse struct {
@@ -153,7 +281,7 @@ func (h *AuthHandler) GetMyGUID(w http.ResponseWriter, r *http.Request) {
 
 // Logout godoc
 // @Summary      Logout user
-// @Description  Deauthorize the current user by deleting their session
+// @Description  Deauthorize the current session. Other sessions of the user stay active, see /logout/all
 // @Tags         auth
 // @Security     ApiKeyAuth
 // @Success      200
@@ -161,22 +289,79 @@ func (h *AuthHandler) GetMyGUID(w http.ResponseWriter, r *http.Request) {
 // @Failure      500 {object} errorResponse
 // @Router       /logout [post]
 func (h *AuthHandler) Logout(w http.ResponseWriter, r *http.Request) {
-	userIDStr, ok := r.Context().Value(UserIDContextKey).(string)
+	r, span := startSpan(r, "handler.http.AuthHandler.Logout")
+	defer span.End()
+
+	userID, sessionID, ok := currentSession(w, r)
 	if !ok {
-		writeError(w, http.StatusUnauthorized, "user_id not found in context")
 		return
 	}
 
-	userID, err := uuid.Parse(userIDStr)
-	if err != nil {
-		writeError(w, http.StatusInternalServerError, "invalid user_id in context")
+	err := h.authService.Logout(r.Context(), userID, sessionID)
+	if err != nil && !errors.Is(err, domain.ErrSessionNotFound) {
+		tracing.RecordError(span, err)
+		writeError(w, http.StatusInternalServerError, "failed to logout")
 		return
 	}
 
-	if err := h.authService.Logout(r.Context(), userID); err != nil {
+	h.clearCookies(w)
+	w.WriteHeader(http.StatusOK)
+}
+
+// LogoutAll godoc
+// @Summary      Logout user everywhere
+// @Description  Deauthorize the current user by deleting all of their sessions
+// @Tags         auth
+// @Security     ApiKeyAuth
+// @Success      200
+// @Failure      401 {object} errorResponse
+// @Failure      500 {object} errorResponse
+// @Router       /logout/all [post]
+func (h *AuthHandler) LogoutAll(w http.ResponseWriter, r *http.Request) {
+	r, span := startSpan(r, "handler.http.AuthHandler.LogoutAll")
+	defer span.End()
+
+	userID, _, ok := currentSession(w, r)
+	if !ok {
+		return
+	}
+
+	if err := h.authService.LogoutAll(r.Context(), userID); err != nil {
+		tracing.RecordError(span, err)
 		writeError(w, http.StatusInternalServerError, "failed to logout")
 		return
 	}
 
+	h.clearCookies(w)
 	w.WriteHeader(http.StatusOK)
 }
+
+// currentSession reads the user and session put into the context by
+// AuthMiddleware. It writes the error response itself if they are missing.
+func currentSession(w http.ResponseWriter, r *http.Request) (uuid.UUID, uuid.UUID, bool) {
+	userIDStr, ok := r.Context().Value(UserIDContextKey).(string)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "user_id not found in context")
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	userID, err := uuid.Parse(userIDStr)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "invalid user_id in context")
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	sessionIDStr, ok := r.Context().Value(SessionIDContextKey).(string)
+	if !ok {
+		writeError(w, http.StatusUnauthorized, "session_id not found in context")
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	sessionID, err := uuid.Parse(sessionIDStr)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, "invalid session_id in context")
+		return uuid.Nil, uuid.Nil, false
+	}
+
+	return userID, sessionID, true
+}
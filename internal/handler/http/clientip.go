@@ -0,0 +1,158 @@
+package http
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/netip"
+	"strings"
+
+	"test2auth/domain"
+)
+
+const ClientIPContextKey = contextKey("client_ip")
+
+// ClientIPResolver finds the address of the client behind a chain of trusted
+// reverse proxies. The forwarding header is only believed when the request
+// comes from a trusted proxy, and is walked from the right so that a client
+// cannot hide its address by prepending fake hops.
+type ClientIPResolver struct {
+	trusted []netip.Prefix
+	hops    func(http.Header) []string
+}
+
+// Forwarding headers the trusted proxies may write.
+const (
+	HeaderXForwardedFor = "x-forwarded-for"
+	HeaderForwarded     = "forwarded"
+)
+
+// NewClientIPResolver accepts CIDRs or single addresses of trusted proxies and
+// the header they write, HeaderXForwardedFor or HeaderForwarded. Only that
+// header is read: the other one may come from the client untouched.
+func NewClientIPResolver(trustedProxies []string, header string) (*ClientIPResolver, error) {
+	const op = "handler.http.NewClientIPResolver"
+
+	resolver := &ClientIPResolver{}
+	switch strings.ToLower(strings.TrimSpace(header)) {
+	case HeaderXForwardedFor:
+		resolver.hops = func(h http.Header) []string { return xForwardedFor(h.Values("X-Forwarded-For")) }
+	case HeaderForwarded:
+		resolver.hops = func(h http.Header) []string { return forwardedFor(h.Values("Forwarded")) }
+	default:
+		return nil, fmt.Errorf("%s: unknown forwarded header %q", op, header)
+	}
+
+	for _, proxy := range trustedProxies {
+		proxy = strings.TrimSpace(proxy)
+		if proxy == "" {
+			continue
+		}
+
+		prefix, err := domain.ParseIPRange(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("%s: invalid trusted proxy %q: %w", op, proxy, err)
+		}
+		resolver.trusted = append(resolver.trusted, prefix)
+	}
+
+	return resolver, nil
+}
+
+func (c *ClientIPResolver) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx := context.WithValue(r.Context(), ClientIPContextKey, c.Resolve(r))
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// Resolve returns the client address of r, or an invalid address if even the
+// peer address cannot be parsed.
+func (c *ClientIPResolver) Resolve(r *http.Request) netip.Addr {
+	addr := parseHost(r.RemoteAddr)
+	if !addr.IsValid() || !c.isTrusted(addr) {
+		return addr
+	}
+
+	hops := c.hops(r.Header)
+	for i := len(hops) - 1; i >= 0; i-- {
+		hop := parseHost(hops[i])
+		if !hop.IsValid() {
+			// Whatever is left of a malformed hop was written by the client.
+			break
+		}
+
+		addr = hop
+		if !c.isTrusted(hop) {
+			break
+		}
+	}
+
+	return addr
+}
+
+func (c *ClientIPResolver) isTrusted(addr netip.Addr) bool {
+	for _, prefix := range c.trusted {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// clientIP returns the address found by ClientIPResolver.Middleware, falling
+// back to the peer address if the middleware is not installed.
+func clientIP(r *http.Request) netip.Addr {
+	if addr, ok := r.Context().Value(ClientIPContextKey).(netip.Addr); ok {
+		return addr
+	}
+	return parseHost(r.RemoteAddr)
+}
+
+// parseHost parses an address with or without a port, in or out of square
+// brackets, and unmaps IPv4-mapped IPv6 addresses.
+func parseHost(s string) netip.Addr {
+	s = strings.TrimSpace(s)
+
+	if addrPort, err := netip.ParseAddrPort(s); err == nil {
+		return addrPort.Addr().Unmap()
+	}
+
+	s = strings.TrimSuffix(strings.TrimPrefix(s, "["), "]")
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}
+	}
+
+	// Zones only make sense on the host that received the packet.
+	return addr.WithZone("").Unmap()
+}
+
+func xForwardedFor(values []string) []string {
+	var hops []string
+	for _, value := range values {
+		for _, hop := range strings.Split(value, ",") {
+			hops = append(hops, strings.TrimSpace(hop))
+		}
+	}
+	return hops
+}
+
+// forwardedFor extracts the for= parameters of RFC 7239 Forwarded headers.
+// Elements without one are kept as empty hops so they are not skipped over.
+func forwardedFor(values []string) []string {
+	var hops []string
+	for _, value := range values {
+		for _, element := range strings.Split(value, ",") {
+			hop := ""
+			for _, pair := range strings.Split(element, ";") {
+				key, val, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok && strings.EqualFold(key, "for") {
+					hop = strings.Trim(val, `"`)
+				}
+			}
+			hops = append(hops, hop)
+		}
+	}
+	return hops
+}
@@ -0,0 +1,177 @@
+package http_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+
+	authhttp "test2auth/internal/handler/http"
+)
+
+func TestClientIPResolver(t *testing.T) {
+	trusted := []string{"10.0.0.0/8", " 192.0.2.1 ", "", "2001:db8:ffff::/48"}
+	resolvers := make(map[string]*authhttp.ClientIPResolver)
+	for _, header := range []string{authhttp.HeaderXForwardedFor, authhttp.HeaderForwarded} {
+		resolver, err := authhttp.NewClientIPResolver(trusted, header)
+		if err != nil {
+			t.Fatalf("NewClientIPResolver: %v", err)
+		}
+		resolvers[header] = resolver
+	}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		// header is the one the proxies write, X-Forwarded-For if empty.
+		header        string
+		xForwardedFor []string
+		forwarded     []string
+		want          string
+	}{
+		{
+			name:       "direct client",
+			remoteAddr: "203.0.113.7:4711",
+			want:       "203.0.113.7",
+		},
+		{
+			name:          "headers from an untrusted peer are ignored",
+			remoteAddr:    "203.0.113.7:4711",
+			xForwardedFor: []string{"198.51.100.1"},
+			want:          "203.0.113.7",
+		},
+		{
+			name:          "trusted proxy",
+			remoteAddr:    "10.0.0.1:4711",
+			xForwardedFor: []string{"198.51.100.1"},
+			want:          "198.51.100.1",
+		},
+		{
+			name:          "trusted single address",
+			remoteAddr:    "192.0.2.1:4711",
+			xForwardedFor: []string{"198.51.100.1"},
+			want:          "198.51.100.1",
+		},
+		{
+			name:          "chain of trusted proxies",
+			remoteAddr:    "10.0.0.1:4711",
+			xForwardedFor: []string{"198.51.100.1, 10.0.0.3", "10.0.0.2"},
+			want:          "198.51.100.1",
+		},
+		{
+			name:          "prepended hops are ignored",
+			remoteAddr:    "10.0.0.1:4711",
+			xForwardedFor: []string{"1.2.3.4, 198.51.100.1"},
+			want:          "198.51.100.1",
+		},
+		{
+			name:          "malformed hop stops the walk",
+			remoteAddr:    "10.0.0.1:4711",
+			xForwardedFor: []string{"198.51.100.1, garbage, 10.0.0.2"},
+			want:          "10.0.0.2",
+		},
+		{
+			name:          "only trusted hops",
+			remoteAddr:    "10.0.0.1:4711",
+			xForwardedFor: []string{"10.0.0.2"},
+			want:          "10.0.0.2",
+		},
+		{
+			name:          "Forwarded from the client is ignored",
+			remoteAddr:    "10.0.0.1:4711",
+			xForwardedFor: []string{"198.51.100.1"},
+			forwarded:     []string{`for=1.2.3.4;proto=https`},
+			want:          "198.51.100.1",
+		},
+		{
+			name:          "X-Forwarded-For from the client is ignored",
+			remoteAddr:    "10.0.0.1:4711",
+			header:        authhttp.HeaderForwarded,
+			xForwardedFor: []string{"1.2.3.4"},
+			forwarded:     []string{`for=198.51.100.2;proto=https`},
+			want:          "198.51.100.2",
+		},
+		{
+			name:       "Forwarded with a quoted IPv6 address and port",
+			remoteAddr: "[2001:db8:ffff::1]:4711",
+			header:     authhttp.HeaderForwarded,
+			forwarded:  []string{`for="[2001:db8::7]:4711", for=10.0.0.2`},
+			want:       "2001:db8::7",
+		},
+		{
+			name:       "Forwarded element without for",
+			remoteAddr: "10.0.0.1:4711",
+			header:     authhttp.HeaderForwarded,
+			forwarded:  []string{`for=198.51.100.1, proto=https`},
+			want:       "10.0.0.1",
+		},
+		{
+			name:       "IPv4-mapped peer",
+			remoteAddr: "[::ffff:203.0.113.7]:4711",
+			want:       "203.0.113.7",
+		},
+		{
+			name:       "unparsable peer",
+			remoteAddr: "pipe",
+			want:       "invalid IP",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req.RemoteAddr = tt.remoteAddr
+			for _, value := range tt.xForwardedFor {
+				req.Header.Add("X-Forwarded-For", value)
+			}
+			for _, value := range tt.forwarded {
+				req.Header.Add("Forwarded", value)
+			}
+
+			header := tt.header
+			if header == "" {
+				header = authhttp.HeaderXForwardedFor
+			}
+			if got := resolvers[header].Resolve(req); got.String() != tt.want {
+				t.Errorf("Resolve = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestClientIPResolverMiddleware(t *testing.T) {
+	resolver, err := authhttp.NewClientIPResolver([]string{"10.0.0.0/8"}, authhttp.HeaderXForwardedFor)
+	if err != nil {
+		t.Fatalf("NewClientIPResolver: %v", err)
+	}
+
+	var got netip.Addr
+	handler := resolver.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got, _ = r.Context().Value(authhttp.ClientIPContextKey).(netip.Addr)
+	}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.RemoteAddr = "10.0.0.1:4711"
+	req.Header.Set("X-Forwarded-For", "198.51.100.1")
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	if want := netip.MustParseAddr("198.51.100.1"); got != want {
+		t.Errorf("client IP in the context = %s, want %s", got, want)
+	}
+}
+
+func TestNewClientIPResolverRejectsInvalidProxies(t *testing.T) {
+	for _, proxy := range []string{"10.0.0.0/33", "proxy.internal", "10.0.0.1:80"} {
+		t.Run(proxy, func(t *testing.T) {
+			if _, err := authhttp.NewClientIPResolver([]string{proxy}, authhttp.HeaderXForwardedFor); err == nil {
+				t.Errorf("NewClientIPResolver(%q): want an error", proxy)
+			}
+		})
+	}
+}
+
+func TestNewClientIPResolverRejectsUnknownHeader(t *testing.T) {
+	if _, err := authhttp.NewClientIPResolver(nil, "x-real-ip"); err == nil {
+		t.Error("NewClientIPResolver with X-Real-IP: want an error")
+	}
+}
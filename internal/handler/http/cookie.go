@@ -0,0 +1,111 @@
+package http
+
+import (
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+)
+
+// deliveryCookie is the value of the delivery query parameter of token
+// creation that selects cookie mode.
+const deliveryCookie = "cookie"
+
+// RefreshCookie configures cookie mode: the refresh token travels in an
+// HttpOnly cookie scoped to the refresh path instead of the JSON body, so
+// browser scripts never see it. Since browsers attach the cookie by
+// themselves, refreshes in cookie mode are protected against CSRF by a
+// double-submitted token and, if the browser sends one, the Origin header.
+type RefreshCookie struct {
+	Name     string
+	Path     string
+	Domain   string
+	SameSite http.SameSite
+	Secure   bool
+	MaxAge   time.Duration
+	// CSRFCookie holds the CSRF token, which the client echoes in the
+	// CSRFHeader request header. The token is also returned in the response
+	// body for clients on another origin that cannot read the cookie.
+	CSRFCookie string
+	CSRFHeader string
+	// TrustedOrigins are the origins allowed to refresh in cookie mode.
+	TrustedOrigins []string
+}
+
+func ParseSameSite(s string) (http.SameSite, error) {
+	switch strings.ToLower(strings.TrimSpace(s)) {
+	case "strict":
+		return http.SameSiteStrictMode, nil
+	case "lax":
+		return http.SameSiteLaxMode, nil
+	case "none":
+		return http.SameSiteNoneMode, nil
+	}
+	return 0, fmt.Errorf("unknown SameSite mode %q", s)
+}
+
+// setTokens sets the refresh token and a fresh CSRF token cookie and returns
+// the CSRF token.
+func (c *RefreshCookie) setTokens(w http.ResponseWriter, refreshToken string) (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	csrfToken := base64.RawURLEncoding.EncodeToString(b)
+
+	http.SetCookie(w, c.cookie(c.Name, refreshToken, true, int(c.MaxAge.Seconds())))
+	http.SetCookie(w, c.cookie(c.CSRFCookie, csrfToken, false, int(c.MaxAge.Seconds())))
+
+	return csrfToken, nil
+}
+
+func (c *RefreshCookie) clear(w http.ResponseWriter) {
+	http.SetCookie(w, c.cookie(c.Name, "", true, -1))
+	http.SetCookie(w, c.cookie(c.CSRFCookie, "", false, -1))
+}
+
+func (c *RefreshCookie) cookie(name, value string, httpOnly bool, maxAge int) *http.Cookie {
+	return &http.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     c.Path,
+		Domain:   c.Domain,
+		MaxAge:   maxAge,
+		Secure:   c.Secure,
+		HttpOnly: httpOnly,
+		SameSite: c.SameSite,
+	}
+}
+
+// refreshToken returns the refresh token cookie of r, if any.
+func (c *RefreshCookie) refreshToken(r *http.Request) string {
+	cookie, err := r.Cookie(c.Name)
+	if err != nil {
+		return ""
+	}
+	return cookie.Value
+}
+
+// checkCSRF verifies a cookie mode refresh. It returns the reason for
+// rejecting the request, or an empty string.
+func (c *RefreshCookie) checkCSRF(r *http.Request) string {
+	if origin := r.Header.Get("Origin"); origin != "" && !slices.Contains(c.TrustedOrigins, origin) {
+		return "origin not allowed"
+	}
+
+	cookie, err := r.Cookie(c.CSRFCookie)
+	if err != nil || cookie.Value == "" {
+		return "csrf token missing"
+	}
+
+	header := r.Header.Get(c.CSRFHeader)
+	if subtle.ConstantTimeCompare([]byte(header), []byte(cookie.Value)) != 1 {
+		return "csrf token mismatch"
+	}
+
+	return ""
+}
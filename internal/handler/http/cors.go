@@ -0,0 +1,175 @@
+package http
+
+import (
+	"fmt"
+	"net/http"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type CORSOptions struct {
+	// AllowedOrigins are exact origins such as "https://app.example.com",
+	// wildcard subdomains such as "https://*.example.com" or "*" for any
+	// origin.
+	AllowedOrigins   []string
+	AllowedMethods   []string
+	AllowedHeaders   []string
+	ExposedHeaders   []string
+	AllowCredentials bool
+	// MaxAge lets browsers cache preflight results, zero leaves it to them.
+	MaxAge time.Duration
+}
+
+// CORS answers preflight requests and adds CORS headers to actual requests
+// from allowed origins. Requests from other origins pass through without CORS
+// headers, which makes the browser withhold the response.
+type CORS struct {
+	opts      CORSOptions
+	anyOrigin bool
+	exact     []string
+	wildcards []wildcardOrigin
+	methods   []string
+	headers   []string
+}
+
+// wildcardOrigin matches any subdomain, at any depth, of a scheme and host.
+type wildcardOrigin struct {
+	prefix string // "https://"
+	suffix string // ".example.com"
+}
+
+func NewCORS(opts CORSOptions) (*CORS, error) {
+	const op = "handler.http.NewCORS"
+
+	c := &CORS{opts: opts}
+	for _, origin := range opts.AllowedOrigins {
+		origin = strings.ToLower(strings.TrimSpace(origin))
+		switch {
+		case origin == "":
+			continue
+		case origin == "*":
+			c.anyOrigin = true
+		case strings.Contains(origin, "*"):
+			prefix, suffix, ok := strings.Cut(origin, "*")
+			if !ok || !strings.HasSuffix(prefix, "://") || !strings.HasPrefix(suffix, ".") || strings.Contains(suffix, "*") {
+				return nil, fmt.Errorf("%s: invalid origin pattern %q", op, origin)
+			}
+			c.wildcards = append(c.wildcards, wildcardOrigin{prefix: prefix, suffix: suffix})
+		default:
+			c.exact = append(c.exact, origin)
+		}
+	}
+
+	if c.anyOrigin && opts.AllowCredentials {
+		return nil, fmt.Errorf("%s: credentials cannot be allowed for any origin", op)
+	}
+
+	for _, method := range opts.AllowedMethods {
+		c.methods = append(c.methods, strings.ToUpper(strings.TrimSpace(method)))
+	}
+	for _, header := range opts.AllowedHeaders {
+		c.headers = append(c.headers, http.CanonicalHeaderKey(strings.TrimSpace(header)))
+	}
+
+	return c, nil
+}
+
+func (c *CORS) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origin := r.Header.Get("Origin")
+		preflight := r.Method == http.MethodOptions && r.Header.Get("Access-Control-Request-Method") != ""
+
+		// Responses differ by origin, so caches must key on it even when
+		// this particular request is not a CORS request.
+		w.Header().Add("Vary", "Origin")
+		if preflight {
+			w.Header().Add("Vary", "Access-Control-Request-Method")
+			w.Header().Add("Vary", "Access-Control-Request-Headers")
+		}
+
+		if origin == "" || !c.allowedOrigin(origin) {
+			if preflight {
+				w.WriteHeader(http.StatusNoContent)
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		if preflight {
+			c.handlePreflight(w, r, origin)
+			return
+		}
+
+		c.setOrigin(w, origin)
+		if len(c.opts.ExposedHeaders) > 0 {
+			w.Header().Set("Access-Control-Expose-Headers", strings.Join(c.opts.ExposedHeaders, ", "))
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+func (c *CORS) handlePreflight(w http.ResponseWriter, r *http.Request, origin string) {
+	method := strings.ToUpper(r.Header.Get("Access-Control-Request-Method"))
+	if !slices.Contains(c.methods, method) {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+
+	var requested []string
+	for _, value := range r.Header.Values("Access-Control-Request-Headers") {
+		for _, header := range strings.Split(value, ",") {
+			if header = strings.TrimSpace(header); header != "" {
+				requested = append(requested, http.CanonicalHeaderKey(header))
+			}
+		}
+	}
+	for _, header := range requested {
+		if !slices.Contains(c.headers, header) {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+	}
+
+	c.setOrigin(w, origin)
+	w.Header().Set("Access-Control-Allow-Methods", strings.Join(c.methods, ", "))
+	if len(requested) > 0 {
+		w.Header().Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+	}
+	if c.opts.MaxAge > 0 {
+		w.Header().Set("Access-Control-Max-Age", strconv.Itoa(int(c.opts.MaxAge.Seconds())))
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (c *CORS) setOrigin(w http.ResponseWriter, origin string) {
+	if c.anyOrigin {
+		w.Header().Set("Access-Control-Allow-Origin", "*")
+		return
+	}
+
+	w.Header().Set("Access-Control-Allow-Origin", origin)
+	if c.opts.AllowCredentials {
+		w.Header().Set("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (c *CORS) allowedOrigin(origin string) bool {
+	if c.anyOrigin {
+		return true
+	}
+
+	origin = strings.ToLower(origin)
+	if slices.Contains(c.exact, origin) {
+		return true
+	}
+	for _, w := range c.wildcards {
+		if strings.HasPrefix(origin, w.prefix) && strings.HasSuffix(origin, w.suffix) &&
+			len(origin) > len(w.prefix)+len(w.suffix) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,207 @@
+package http_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"slices"
+	"testing"
+	"time"
+
+	authhttp "test2auth/internal/handler/http"
+)
+
+func newTestCORS(t *testing.T) http.Handler {
+	t.Helper()
+
+	cors, err := authhttp.NewCORS(authhttp.CORSOptions{
+		AllowedOrigins:   []string{"https://app.example.com", "https://*.example.org"},
+		AllowedMethods:   []string{"GET", "POST"},
+		AllowedHeaders:   []string{"Authorization", "Content-Type"},
+		ExposedHeaders:   []string{"Retry-After"},
+		AllowCredentials: true,
+		MaxAge:           10 * time.Minute,
+	})
+	if err != nil {
+		t.Fatalf("NewCORS: %v", err)
+	}
+
+	return cors.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+}
+
+func TestCORS(t *testing.T) {
+	tests := []struct {
+		name string
+		// method OPTIONS with requestMethod set makes a preflight.
+		method         string
+		origin         string
+		requestMethod  string
+		requestHeaders string
+
+		wantStatus  int
+		wantOrigin  string
+		wantMethods string
+		wantHeaders string
+	}{
+		{
+			name:       "exact origin",
+			method:     http.MethodGet,
+			origin:     "https://app.example.com",
+			wantStatus: http.StatusOK,
+			wantOrigin: "https://app.example.com",
+		},
+		{
+			name:       "wildcard origin",
+			method:     http.MethodPost,
+			origin:     "https://eu.tenant.example.org",
+			wantStatus: http.StatusOK,
+			wantOrigin: "https://eu.tenant.example.org",
+		},
+		{
+			name:       "wildcard does not match the bare domain",
+			method:     http.MethodGet,
+			origin:     "https://example.org",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "disallowed origin",
+			method:     http.MethodGet,
+			origin:     "https://evil.example.net",
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:       "no origin",
+			method:     http.MethodGet,
+			wantStatus: http.StatusOK,
+		},
+		{
+			name:           "preflight",
+			method:         http.MethodOptions,
+			origin:         "https://app.example.com",
+			requestMethod:  "POST",
+			requestHeaders: "content-type, authorization",
+			wantStatus:     http.StatusNoContent,
+			wantOrigin:     "https://app.example.com",
+			wantMethods:    "GET, POST",
+			wantHeaders:    "Content-Type, Authorization",
+		},
+		{
+			name:          "preflight from a disallowed origin",
+			method:        http.MethodOptions,
+			origin:        "https://evil.example.net",
+			requestMethod: "POST",
+			wantStatus:    http.StatusNoContent,
+		},
+		{
+			name:          "preflight with a disallowed method",
+			method:        http.MethodOptions,
+			origin:        "https://app.example.com",
+			requestMethod: "DELETE",
+			wantStatus:    http.StatusNoContent,
+		},
+		{
+			name:           "preflight with a disallowed header",
+			method:         http.MethodOptions,
+			origin:         "https://app.example.com",
+			requestMethod:  "POST",
+			requestHeaders: "Content-Type, X-Debug",
+			wantStatus:     http.StatusNoContent,
+		},
+	}
+
+	handler := newTestCORS(t)
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, "/auth/tokens", nil)
+			if tt.origin != "" {
+				req.Header.Set("Origin", tt.origin)
+			}
+			if tt.requestMethod != "" {
+				req.Header.Set("Access-Control-Request-Method", tt.requestMethod)
+			}
+			if tt.requestHeaders != "" {
+				req.Header.Set("Access-Control-Request-Headers", tt.requestHeaders)
+			}
+
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+			header := rec.Header()
+
+			if rec.Code != tt.wantStatus {
+				t.Errorf("status = %d, want %d", rec.Code, tt.wantStatus)
+			}
+			if got := header.Get("Access-Control-Allow-Origin"); got != tt.wantOrigin {
+				t.Errorf("Access-Control-Allow-Origin = %q, want %q", got, tt.wantOrigin)
+			}
+			if got := header.Get("Access-Control-Allow-Methods"); got != tt.wantMethods {
+				t.Errorf("Access-Control-Allow-Methods = %q, want %q", got, tt.wantMethods)
+			}
+			if got := header.Get("Access-Control-Allow-Headers"); got != tt.wantHeaders {
+				t.Errorf("Access-Control-Allow-Headers = %q, want %q", got, tt.wantHeaders)
+			}
+
+			wantCredentials := ""
+			if tt.wantOrigin != "" {
+				wantCredentials = "true"
+			}
+			if got := header.Get("Access-Control-Allow-Credentials"); got != wantCredentials {
+				t.Errorf("Access-Control-Allow-Credentials = %q, want %q", got, wantCredentials)
+			}
+
+			// Every response, CORS or not, varies by origin.
+			if !slices.Contains(header.Values("Vary"), "Origin") {
+				t.Errorf("Vary = %q, want it to contain Origin", header.Values("Vary"))
+			}
+		})
+	}
+}
+
+func TestNewCORSRejectsInvalidOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts authhttp.CORSOptions
+	}{
+		{
+			name: "any origin with credentials",
+			opts: authhttp.CORSOptions{AllowedOrigins: []string{"*"}, AllowCredentials: true},
+		},
+		{
+			name: "wildcard without a scheme",
+			opts: authhttp.CORSOptions{AllowedOrigins: []string{"*.example.com"}},
+		},
+		{
+			name: "wildcard in the middle of a label",
+			opts: authhttp.CORSOptions{AllowedOrigins: []string{"https://app-*.example.com"}},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := authhttp.NewCORS(tt.opts); err == nil {
+				t.Error("NewCORS: want an error")
+			}
+		})
+	}
+}
+
+func TestCORSAnyOrigin(t *testing.T) {
+	cors, err := authhttp.NewCORS(authhttp.CORSOptions{AllowedOrigins: []string{"*"}})
+	if err != nil {
+		t.Fatalf("NewCORS: %v", err)
+	}
+	handler := cors.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	req := httptest.NewRequest(http.MethodGet, "/", nil)
+	req.Header.Set("Origin", "https://anywhere.example")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, req)
+
+	if got := rec.Header().Get("Access-Control-Allow-Origin"); got != "*" {
+		t.Errorf("Access-Control-Allow-Origin = %q, want *", got)
+	}
+	if got := rec.Header().Get("Access-Control-Allow-Credentials"); got != "" {
+		t.Errorf("Access-Control-Allow-Credentials = %q, want none", got)
+	}
+}
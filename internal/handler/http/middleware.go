@@ -2,17 +2,22 @@ package http
 
 import (
 	"context"
-	"fmt"
 	"net/http"
+	"slices"
 	"strings"
 
+	"test2auth/internal/tracing"
+
 	"github.com/dgrijalva/jwt-go"
+	"github.com/google/uuid"
 )
 
 type contextKey string
 
 const (
-	UserIDContextKey = contextKey("user_id")
+	UserIDContextKey    = contextKey("user_id")
+	SessionIDContextKey = contextKey("session_id")
+	ScopeContextKey     = contextKey("scope")
 )
 
 func (h *AuthHandler) AuthMiddleware(next http.Handler) http.Handler {
@@ -31,12 +36,10 @@ func (h *AuthHandler) AuthMiddleware(next http.Handler) http.Handler {
 
 		tokenString := headerParts[1]
 
-		token, err := jwt.Parse(tokenString, func(token *jwt.Token) (interface{}, error) {
-			if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-				return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-			}
-			return []byte(h.jwtSecret), nil
-		})
+		_, span := tracer.Start(r.Context(), "handler.http.AuthHandler.AuthMiddleware")
+		token, err := jwt.Parse(tokenString, h.keys.Keyfunc)
+		tracing.RecordError(span, err)
+		span.End()
 
 		if err != nil || !token.Valid {
 			writeError(w, http.StatusUnauthorized, "invalid or expired token")
@@ -55,7 +58,59 @@ func (h *AuthHandler) AuthMiddleware(next http.Handler) http.Handler {
 			return
 		}
 
+		sessionID, ok := claims["sid"].(string)
+		if !ok {
+			writeError(w, http.StatusUnauthorized, "session_id not found in token")
+			return
+		}
+		if _, err := uuid.Parse(sessionID); err != nil {
+			writeError(w, http.StatusUnauthorized, "invalid session_id in token")
+			return
+		}
+
 		ctx := context.WithValue(r.Context(), UserIDContextKey, userID)
+		ctx = context.WithValue(ctx, SessionIDContextKey, sessionID)
+		if scope, ok := claims["scope"].(string); ok {
+			ctx = context.WithValue(ctx, ScopeContextKey, scope)
+		}
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
+
+// RequireUser must run after AuthMiddleware. It rejects tokens of users other
+// than userIDs, so that a token outlives its user's privileges no longer than
+// the configuration does.
+func RequireUser(userIDs []uuid.UUID) func(http.Handler) http.Handler {
+	allowed := make(map[string]bool, len(userIDs))
+	for _, id := range userIDs {
+		allowed[id.String()] = true
+	}
+
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			userID, _ := r.Context().Value(UserIDContextKey).(string)
+			if !allowed[userID] {
+				writeError(w, http.StatusForbidden, "insufficient scope")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireScope must run after AuthMiddleware. It rejects tokens that do not
+// carry the given scope in their space separated scope claim.
+func RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scopes, _ := r.Context().Value(ScopeContextKey).(string)
+			if !slices.Contains(strings.Fields(scopes), scope) {
+				writeError(w, http.StatusForbidden, "insufficient scope")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
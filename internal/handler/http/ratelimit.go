@@ -0,0 +1,165 @@
+package http
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"test2auth/internal/ratelimit"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+// maxPeekBody bounds how much of a request body is read to find the user.
+const maxPeekBody = 64 << 10
+
+type RateLimits struct {
+	PerIP    ratelimit.Limit
+	PerUser  ratelimit.Limit
+	PerRoute ratelimit.Limit
+}
+
+type rateLimitCheck struct {
+	key   string
+	limit ratelimit.Limit
+	store ratelimit.Store
+}
+
+type RateLimiter struct {
+	store ratelimit.Store
+	// routeStore holds the per-route buckets in memory of this replica. A
+	// shared per-route bucket would be one row every request waits for.
+	routeStore ratelimit.Store
+	limits     RateLimits
+	userKey    func(r *http.Request) string
+	log        *slog.Logger
+}
+
+// NewRateLimiter checks the per-IP and per-user limits against store. The
+// per-route limit always applies to each replica on its own.
+func NewRateLimiter(store ratelimit.Store, limits RateLimits, userKey func(r *http.Request) string, log *slog.Logger) *RateLimiter {
+	return &RateLimiter{
+		store:      store,
+		routeStore: ratelimit.NewMemory(),
+		limits:     limits,
+		userKey:    userKey,
+		log:        log,
+	}
+}
+
+// Middleware must be installed per route (router.With) so that the chi route
+// pattern is already known when it runs.
+func (l *RateLimiter) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		const op = "handler.http.RateLimiter"
+
+		route := r.URL.Path
+		if rctx := chi.RouteContext(r.Context()); rctx != nil && rctx.RoutePattern() != "" {
+			route = rctx.RoutePattern()
+		}
+
+		// taken are the checks a token was taken for. If a later one denies
+		// the request, they get their tokens back: a request that was never
+		// served must not count against the other limits.
+		var taken []rateLimitCheck
+		allow := func(check rateLimitCheck) bool {
+			if check.limit.Disabled() {
+				return true
+			}
+
+			res, err := check.store.TakeRateLimitToken(r.Context(), check.key, check.limit)
+			if err != nil {
+				// Fail open: an unavailable limiter must not take the service down.
+				l.log.Error("failed to check rate limit", slog.String("op", op), "error", err)
+				return true
+			}
+			if res.Allowed {
+				taken = append(taken, check)
+				return true
+			}
+
+			for _, t := range taken {
+				if err := t.store.ReturnRateLimitToken(r.Context(), t.key, t.limit); err != nil {
+					l.log.Error("failed to return rate limit token", slog.String("op", op), "error", err)
+				}
+			}
+			w.Header().Set("Retry-After", strconv.Itoa(retryAfterSeconds(res.RetryAfter)))
+			writeError(w, http.StatusTooManyRequests, "too many requests")
+			return false
+		}
+
+		if !allow(rateLimitCheck{key: "ip:" + route + ":" + clientIP(r).String(), limit: l.limits.PerIP, store: l.store}) {
+			return
+		}
+		// Finding the user may cost a storage lookup, so it waits until the
+		// per-IP limit let the request through. Anonymous requests are covered
+		// by the per-IP and per-route limits.
+		if !l.limits.PerUser.Disabled() {
+			if user := l.userKey(r); user != "" {
+				if !allow(rateLimitCheck{key: "user:" + route + ":" + user, limit: l.limits.PerUser, store: l.store}) {
+					return
+				}
+			}
+		}
+		if !allow(rateLimitCheck{key: "route:" + route, limit: l.limits.PerRoute, store: l.routeStore}) {
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// retryAfterSeconds rounds up to whole seconds, and to at least one: a
+// Retry-After of 0 invites an immediate retry that is rejected again.
+func retryAfterSeconds(d time.Duration) int {
+	return max(1, int(math.Ceil(d.Seconds())))
+}
+
+// RateLimitUserKey finds the user a token request is made for: the user_id
+// query parameter on token creation or the owner of the session the refresh
+// token belongs to. It returns an empty string if the user is unknown, e.g.
+// for an invalid refresh token.
+func (h *AuthHandler) RateLimitUserKey(r *http.Request) string {
+	if userID, err := uuid.Parse(r.URL.Query().Get("user_id")); err == nil {
+		return userID.String()
+	}
+
+	refreshToken := h.peekRefreshToken(r)
+	if refreshToken == "" {
+		return ""
+	}
+
+	userID, err := h.authService.RefreshTokenOwner(r.Context(), refreshToken)
+	if err != nil {
+		return ""
+	}
+	return userID.String()
+}
+
+// peekRefreshToken reads the refresh token from the body, leaving the body
+// for the handler, or from the cookie in cookie mode.
+func (h *AuthHandler) peekRefreshToken(r *http.Request) string {
+	if r.Body != nil {
+		body, err := io.ReadAll(io.LimitReader(r.Body, maxPeekBody))
+		r.Body = io.NopCloser(io.MultiReader(bytes.NewReader(body), r.Body))
+		if err != nil {
+			return ""
+		}
+
+		var req refreshRequest
+		if err := json.Unmarshal(body, &req); err == nil && req.RefreshToken != "" {
+			return req.RefreshToken
+		}
+	}
+
+	if h.cookie != nil {
+		return h.cookie.refreshToken(r)
+	}
+	return ""
+}
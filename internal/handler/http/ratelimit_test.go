@@ -0,0 +1,56 @@
+package http_test
+
+import (
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	authhttp "test2auth/internal/handler/http"
+	"test2auth/internal/ratelimit"
+)
+
+func TestRateLimiter(t *testing.T) {
+	var user string
+	lookups := 0
+	userKey := func(*http.Request) string {
+		lookups++
+		return user
+	}
+
+	limiter := authhttp.NewRateLimiter(ratelimit.NewMemory(), authhttp.RateLimits{
+		PerIP:   ratelimit.Limit{Rate: 0.001, Burst: 2},
+		PerUser: ratelimit.Limit{Rate: 0.001, Burst: 1},
+	}, userKey, slog.New(slog.NewTextHandler(io.Discard, nil)))
+	handler := limiter.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	steps := []struct {
+		name        string
+		user        string
+		wantCode    int
+		wantLookups int
+	}{
+		{name: "first request of the user", user: "alice", wantCode: http.StatusOK, wantLookups: 1},
+		// The IP token of the denied request is given back.
+		{name: "user limit exceeded", user: "alice", wantCode: http.StatusTooManyRequests, wantLookups: 2},
+		{name: "anonymous request gets the returned token", wantCode: http.StatusOK, wantLookups: 3},
+		// The user is not looked up once the IP is limited.
+		{name: "IP limit exceeded", user: "bob", wantCode: http.StatusTooManyRequests, wantLookups: 3},
+	}
+
+	for _, step := range steps {
+		user = step.user
+		req := httptest.NewRequest(http.MethodPost, "/auth/tokens", nil)
+		req.RemoteAddr = "203.0.113.7:4711"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != step.wantCode {
+			t.Errorf("%s: status %d, want %d", step.name, rec.Code, step.wantCode)
+		}
+		if lookups != step.wantLookups {
+			t.Errorf("%s: %d user lookups, want %d", step.name, lookups, step.wantLookups)
+		}
+	}
+}
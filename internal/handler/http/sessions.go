@@ -0,0 +1,122 @@
+package http
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"test2auth/domain"
+	"test2auth/internal/tracing"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"github.com/google/uuid"
+)
+
+type sessionResponse struct {
+	ID            string    `json:"id"`
+	Current       bool      `json:"current"`
+	UserAgent     string    `json:"user_agent"`
+	BrowserFamily string    `json:"browser_family"`
+	BrowserMajor  string    `json:"browser_major"`
+	OS            string    `json:"os"`
+	DeviceType    string    `json:"device_type"`
+	IP            string    `json:"ip"`
+	Country       string    `json:"country,omitempty"`
+	City          string    `json:"city,omitempty"`
+	CreatedAt     time.Time `json:"created_at"`
+	LastUsedAt    time.Time `json:"last_used_at"`
+	ExpiresAt     time.Time `json:"expires_at"`
+}
+
+func newSessionResponse(session domain.Session, currentID uuid.UUID) sessionResponse {
+	return sessionResponse{
+		ID:            session.ID.String(),
+		Current:       session.ID == currentID,
+		UserAgent:     session.UserAgent,
+		BrowserFamily: session.Device.BrowserFamily,
+		BrowserMajor:  session.Device.BrowserMajor,
+		OS:            session.Device.OS,
+		DeviceType:    session.Device.DeviceType,
+		IP:            session.IP.String(),
+		Country:       session.Location.Country,
+		City:          session.Location.City,
+		CreatedAt:     session.CreatedAt,
+		LastUsedAt:    session.LastUsedAt,
+		ExpiresAt:     session.ExpiresAt,
+	}
+}
+
+// ListSessions godoc
+// @Summary      List sessions
+// @Description  List active sessions of the current user, most recently used first
+// @Tags         sessions
+// @Produce      json
+// @Security     ApiKeyAuth
+// @Success      200 {array} sessionResponse
+// @Failure      401 {object} errorResponse
+// @Failure      500 {object} errorResponse
+// @Router       /sessions [get]
+func (h *AuthHandler) ListSessions(w http.ResponseWriter, r *http.Request) {
+	r, span := startSpan(r, "handler.http.AuthHandler.ListSessions")
+	defer span.End()
+
+	userID, sessionID, ok := currentSession(w, r)
+	if !ok {
+		return
+	}
+
+	sessions, err := h.authService.ListSessions(r.Context(), userID)
+	if err != nil {
+		tracing.RecordError(span, err)
+		writeError(w, http.StatusInternalServerError, "failed to list sessions")
+		return
+	}
+
+	resp := make([]sessionResponse, 0, len(sessions))
+	for _, session := range sessions {
+		resp = append(resp, newSessionResponse(session, sessionID))
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(resp)
+}
+
+// RevokeSession godoc
+// @Summary      Revoke a session
+// @Description  Log out one device of the current user
+// @Tags         sessions
+// @Security     ApiKeyAuth
+// @Param        id path string true "Session ID (GUID)"
+// @Success      204
+// @Failure      400 {object} errorResponse
+// @Failure      401 {object} errorResponse
+// @Failure      404 {object} errorResponse
+// @Failure      500 {object} errorResponse
+// @Router       /sessions/{id} [delete]
+func (h *AuthHandler) RevokeSession(w http.ResponseWriter, r *http.Request) {
+	r, span := startSpan(r, "handler.http.AuthHandler.RevokeSession")
+	defer span.End()
+
+	userID, _, ok := currentSession(w, r)
+	if !ok {
+		return
+	}
+
+	sessionID, err := uuid.Parse(chi.URLParam(r, "id"))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid session id")
+		return
+	}
+
+	if err := h.authService.RevokeSession(r.Context(), userID, sessionID); err != nil {
+		tracing.RecordError(span, err)
+		if errors.Is(err, domain.ErrSessionNotFound) {
+			writeError(w, http.StatusNotFound, domain.ErrSessionNotFound.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to revoke session")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,181 @@
+// Package janitor periodically purges expired sessions, which are otherwise
+// only removed when their owner tries to refresh them, the refresh grace
+// tokens of sessions past their grace period and other stale rows registered
+// as tasks.
+package janitor
+
+import (
+	"context"
+	"log/slog"
+	"time"
+)
+
+type Store interface {
+	// DeleteExpiredSessions deletes at most limit sessions that expired
+	// before now and returns how many it deleted.
+	DeleteExpiredSessions(ctx context.Context, now time.Time, limit int) (int64, error)
+}
+
+// GraceStore is implemented by stores that keep the sealed token pairs of the
+// refresh grace period until the janitor clears them.
+type GraceStore interface {
+	// ClearGraceTokens clears the pairs of at most limit sessions whose grace
+	// period ended before now and returns how many it cleared.
+	ClearGraceTokens(ctx context.Context, now time.Time, limit int) (int64, error)
+}
+
+// Locker is implemented by stores shared between replicas, so that only one
+// replica purges at a time.
+type Locker interface {
+	// TryJanitorLock takes the janitor lock without waiting. If ok is true the
+	// caller holds the lock until it calls release.
+	TryJanitorLock(ctx context.Context) (release func(), ok bool, err error)
+}
+
+// Task purges one kind of stale rows. Delete removes at most limit rows that
+// are stale at now and returns how many it removed.
+type Task struct {
+	Name   string
+	Delete func(ctx context.Context, now time.Time, limit int) (int64, error)
+}
+
+// Metrics receives the outcome of every run.
+type Metrics interface {
+	// ObserveRun is called for each task of a run that held the lock. err is
+	// the error that stopped the task early, if any.
+	ObserveRun(task string, deleted int64, duration time.Duration, err error)
+	// ObserveSkipped is called when another replica holds the lock.
+	ObserveSkipped()
+}
+
+type nopMetrics struct{}
+
+func (nopMetrics) ObserveRun(string, int64, time.Duration, error) {}
+func (nopMetrics) ObserveSkipped()                                {}
+
+// Config bounds each task of a run to MaxBatches deletes of BatchSize rows,
+// so a large backlog is worked off over several intervals instead of one long
+// lock.
+type Config struct {
+	Interval   time.Duration
+	BatchSize  int
+	MaxBatches int
+}
+
+type Janitor struct {
+	store   Store
+	tasks   []Task
+	cfg     Config
+	log     *slog.Logger
+	metrics Metrics
+}
+
+type Option func(*Janitor)
+
+func WithMetrics(metrics Metrics) Option {
+	return func(j *Janitor) {
+		j.metrics = metrics
+	}
+}
+
+// WithTask purges the rows of task on every run, after the sessions.
+func WithTask(task Task) Option {
+	return func(j *Janitor) {
+		j.tasks = append(j.tasks, task)
+	}
+}
+
+func New(store Store, cfg Config, log *slog.Logger, opts ...Option) *Janitor {
+	j := &Janitor{
+		store:   store,
+		tasks:   []Task{{Name: "sessions", Delete: store.DeleteExpiredSessions}},
+		cfg:     cfg,
+		log:     log,
+		metrics: nopMetrics{},
+	}
+	if grace, ok := store.(GraceStore); ok {
+		j.tasks = append(j.tasks, Task{Name: "grace_tokens", Delete: grace.ClearGraceTokens})
+	}
+	for _, opt := range opts {
+		opt(j)
+	}
+	return j
+}
+
+// Run purges expired sessions every interval until ctx is cancelled. A run in
+// progress stops after its current batch.
+func (j *Janitor) Run(ctx context.Context) {
+	ticker := time.NewTicker(j.cfg.Interval)
+	defer ticker.Stop()
+
+	for {
+		j.RunOnce(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// RunOnce runs every task. It returns the number of deleted rows.
+func (j *Janitor) RunOnce(ctx context.Context) int64 {
+	if locker, ok := j.store.(Locker); ok {
+		release, ok, err := locker.TryJanitorLock(ctx)
+		if err != nil {
+			j.log.Error("janitor: failed to take lock", "error", err)
+			return 0
+		}
+		if !ok {
+			j.log.Debug("janitor: another replica is purging, skipping run")
+			j.metrics.ObserveSkipped()
+			return 0
+		}
+		defer release()
+	}
+
+	var total int64
+	for _, task := range j.tasks {
+		if ctx.Err() != nil {
+			break
+		}
+		total += j.runTask(ctx, task)
+	}
+
+	return total
+}
+
+// runTask deletes in batches until a batch comes back short, MaxBatches is
+// reached or ctx is cancelled.
+func (j *Janitor) runTask(ctx context.Context, task Task) int64 {
+	start := time.Now()
+	var (
+		total int64
+		err   error
+	)
+	for batch := 0; batch < j.cfg.MaxBatches && ctx.Err() == nil; batch++ {
+		var deleted int64
+		deleted, err = task.Delete(ctx, time.Now(), j.cfg.BatchSize)
+		if err != nil {
+			break
+		}
+		total += deleted
+		if deleted < int64(j.cfg.BatchSize) {
+			break
+		}
+	}
+	duration := time.Since(start)
+
+	j.metrics.ObserveRun(task.Name, total, duration, err)
+
+	if err != nil && ctx.Err() == nil {
+		j.log.Error("janitor: failed to purge", "task", task.Name, "error", err, "deleted", total)
+		return total
+	}
+	if total > 0 {
+		j.log.Info("janitor: purged", "task", task.Name, "deleted", total, "duration", duration)
+	}
+
+	return total
+}
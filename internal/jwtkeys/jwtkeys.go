@@ -0,0 +1,357 @@
+// Package jwtkeys holds the keys that sign and verify access tokens. Tokens
+// carry the ID of their key in the "kid" header. Tokens without one are
+// verified with the configured JWT secret, which also signs while no stored
+// key is active, unless the set requires key IDs.
+package jwtkeys
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log/slog"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+var (
+	ErrKeyNotFound  = errors.New("signing key not found")
+	ErrNoActiveKey  = errors.New("no active signing key")
+	ErrNoEncryption = errors.New("no key encryption key")
+)
+
+// Key is a signing key. It signs new tokens from ActivateAt on and verifies
+// tokens until RetiredAt.
+type Key struct {
+	ID         string
+	Secret     []byte
+	CreatedAt  time.Time
+	ActivateAt time.Time
+	RetiredAt  time.Time
+}
+
+func (k Key) retired(now time.Time) bool {
+	return !k.RetiredAt.IsZero() && !k.RetiredAt.After(now)
+}
+
+// Record is a key as stored, with its secret sealed.
+type Record struct {
+	ID           string
+	SealedSecret string
+	CreatedAt    time.Time
+	ActivateAt   time.Time
+	RetiredAt    time.Time
+}
+
+type Store interface {
+	ListSigningKeys(ctx context.Context) ([]Record, error)
+	SaveSigningKey(ctx context.Context, record Record) error
+	// RetireSigningKey returns ErrKeyNotFound for an unknown ID.
+	RetireSigningKey(ctx context.Context, id string, at time.Time) error
+}
+
+type Set struct {
+	secret     []byte
+	store      Store
+	kek        []byte
+	requireKID bool
+
+	mu     sync.RWMutex
+	keys   map[string]Key
+	active Key
+}
+
+type Option func(*Set)
+
+// WithKeyEncryptionKey seals and opens stored keys with a key derived from
+// kek. Without it stored keys cannot be used.
+func WithKeyEncryptionKey(kek string) Option {
+	return func(s *Set) {
+		if kek != "" {
+			s.kek = []byte(kek)
+		}
+	}
+}
+
+// WithRequireKID rejects tokens without a key ID, so the JWT secret neither
+// signs nor verifies tokens any more. Turn it on once a stored key is active
+// and the tokens signed with the secret have expired.
+func WithRequireKID(require bool) Option {
+	return func(s *Set) {
+		s.requireKID = require
+	}
+}
+
+// NewSet builds a key set around the JWT secret. A nil store makes the
+// secret the only key.
+func NewSet(secret string, store Store, opts ...Option) *Set {
+	s := &Set{
+		secret: []byte(secret),
+		store:  store,
+		keys:   map[string]Key{},
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+	return s
+}
+
+// Reload reads the keys from the store.
+func (s *Set) Reload(ctx context.Context) error {
+	const op = "jwtkeys.Set.Reload"
+
+	if s.store == nil {
+		return nil
+	}
+
+	records, err := s.store.ListSigningKeys(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	keys := make(map[string]Key, len(records))
+	for _, record := range records {
+		secret, err := s.open(record.ID, record.SealedSecret)
+		if err != nil {
+			return fmt.Errorf("%s: key %s: %w", op, record.ID, err)
+		}
+		keys[record.ID] = Key{
+			ID:         record.ID,
+			Secret:     secret,
+			CreatedAt:  record.CreatedAt,
+			ActivateAt: record.ActivateAt,
+			RetiredAt:  record.RetiredAt,
+		}
+	}
+
+	s.mu.Lock()
+	s.keys = keys
+	s.mu.Unlock()
+
+	return nil
+}
+
+// Run reloads the keys every interval until ctx is cancelled, so that keys
+// rotated elsewhere are picked up.
+func (s *Set) Run(ctx context.Context, interval time.Duration, log *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			if err := s.Reload(ctx); err != nil && ctx.Err() == nil {
+				log.Error("failed to reload signing keys", "error", err)
+			}
+		}
+	}
+}
+
+// Keys returns the stored keys, newest first.
+func (s *Set) Keys() []Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	keys := make([]Key, 0, len(s.keys))
+	for _, key := range s.keys {
+		keys = append(keys, key)
+	}
+	slices.SortFunc(keys, func(a, b Key) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	return keys
+}
+
+// signingKey returns the newest active key, or a key without ID for the JWT
+// secret.
+func (s *Set) signingKey(now time.Time) Key {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	active := Key{Secret: s.secret}
+	for _, key := range s.keys {
+		if key.retired(now) || key.ActivateAt.After(now) {
+			continue
+		}
+		if active.ID == "" || key.ActivateAt.After(active.ActivateAt) {
+			active = key
+		}
+	}
+	return active
+}
+
+// Active reports whether a stored key signs tokens now.
+func (s *Set) Active() bool {
+	return s.signingKey(time.Now()).ID != ""
+}
+
+// Sign signs claims with HS512 and the active key.
+func (s *Set) Sign(claims jwt.Claims) (string, error) {
+	key := s.signingKey(time.Now())
+	if key.ID == "" && s.requireKID {
+		return "", ErrNoActiveKey
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS512, claims)
+	if key.ID != "" {
+		token.Header["kid"] = key.ID
+	}
+	return token.SignedString(key.Secret)
+}
+
+// Keyfunc resolves the verification key of a token for jwt.Parse. Keys that
+// are not active yet verify as well, other replicas may already sign with
+// them.
+func (s *Set) Keyfunc(token *jwt.Token) (interface{}, error) {
+	if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
+		return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
+	}
+
+	kid, ok := token.Header["kid"].(string)
+	if !ok {
+		if s.requireKID {
+			return nil, errors.New("token has no key ID")
+		}
+		return s.secret, nil
+	}
+
+	s.mu.RLock()
+	key, ok := s.keys[kid]
+	s.mu.RUnlock()
+
+	if !ok || key.retired(time.Now()) {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+	return key.Secret, nil
+}
+
+// Rotate stores a new random key that starts signing at activateAt. Leave
+// other replicas time to reload before it activates.
+func (s *Set) Rotate(ctx context.Context, activateAt time.Time) (Key, error) {
+	const op = "jwtkeys.Set.Rotate"
+
+	if s.store == nil {
+		return Key{}, fmt.Errorf("%s: no key store", op)
+	}
+	if s.kek == nil {
+		return Key{}, fmt.Errorf("%s: %w", op, ErrNoEncryption)
+	}
+
+	id := make([]byte, 8)
+	secret := make([]byte, 64)
+	if _, err := rand.Read(id); err != nil {
+		return Key{}, fmt.Errorf("%s: %w", op, err)
+	}
+	if _, err := rand.Read(secret); err != nil {
+		return Key{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	key := Key{
+		ID:         hex.EncodeToString(id),
+		Secret:     secret,
+		CreatedAt:  time.Now().UTC().Truncate(time.Microsecond),
+		ActivateAt: activateAt.UTC().Truncate(time.Microsecond),
+	}
+
+	sealed, err := s.seal(key.ID, key.Secret)
+	if err != nil {
+		return Key{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.store.SaveSigningKey(ctx, Record{
+		ID:           key.ID,
+		SealedSecret: sealed,
+		CreatedAt:    key.CreatedAt,
+		ActivateAt:   key.ActivateAt,
+	}); err != nil {
+		return Key{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.Reload(ctx); err != nil {
+		return Key{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return key, nil
+}
+
+// Retire stops a key from verifying tokens. Retire a key only once the
+// tokens it signed have expired.
+func (s *Set) Retire(ctx context.Context, id string) error {
+	const op = "jwtkeys.Set.Retire"
+
+	if s.store == nil {
+		return fmt.Errorf("%s: no key store", op)
+	}
+
+	if err := s.store.RetireSigningKey(ctx, id, time.Now()); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := s.Reload(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// seal encrypts a secret for storage with a key derived from the key
+// encryption key, the key ID is authenticated as well.
+func (s *Set) seal(id string, secret []byte) (string, error) {
+	aead, err := newCipher(s.kek)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(secret)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, secret, []byte(id))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// open decrypts a stored secret with the key encryption key.
+func (s *Set) open(id, sealed string) ([]byte, error) {
+	if s.kek == nil {
+		return nil, ErrNoEncryption
+	}
+
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return nil, err
+	}
+
+	aead, err := newCipher(s.kek)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) < aead.NonceSize() {
+		return nil, errors.New("sealed secret too short")
+	}
+
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	return aead.Open(nil, nonce, ciphertext, []byte(id))
+}
+
+func newCipher(key []byte) (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte("jwt signing keys"))
+
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
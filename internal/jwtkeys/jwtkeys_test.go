@@ -0,0 +1,117 @@
+package jwtkeys
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/dgrijalva/jwt-go"
+)
+
+type memoryStore struct {
+	records map[string]Record
+}
+
+func newMemoryStore() *memoryStore {
+	return &memoryStore{records: map[string]Record{}}
+}
+
+func (m *memoryStore) ListSigningKeys(context.Context) ([]Record, error) {
+	records := make([]Record, 0, len(m.records))
+	for _, record := range m.records {
+		records = append(records, record)
+	}
+	return records, nil
+}
+
+func (m *memoryStore) SaveSigningKey(_ context.Context, record Record) error {
+	m.records[record.ID] = record
+	return nil
+}
+
+func (m *memoryStore) RetireSigningKey(_ context.Context, id string, at time.Time) error {
+	record, ok := m.records[id]
+	if !ok {
+		return ErrKeyNotFound
+	}
+	record.RetiredAt = at
+	m.records[id] = record
+	return nil
+}
+
+func parse(s *Set, token string) error {
+	_, err := jwt.Parse(token, s.Keyfunc)
+	return err
+}
+
+func TestRequireKID(t *testing.T) {
+	ctx := context.Background()
+	claims := jwt.MapClaims{"sub": "user"}
+
+	legacy, err := NewSet("secret", nil).Sign(claims)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+
+	s := NewSet("secret", newMemoryStore(), WithKeyEncryptionKey("kek"), WithRequireKID(true))
+	if _, err := s.Sign(claims); !errors.Is(err, ErrNoActiveKey) {
+		t.Errorf("Sign without an active key: error %v, want %v", err, ErrNoActiveKey)
+	}
+	if err := parse(s, legacy); err == nil {
+		t.Error("token without a key ID verified")
+	}
+
+	if _, err := s.Rotate(ctx, time.Now()); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if !s.Active() {
+		t.Fatal("no active key after Rotate")
+	}
+
+	token, err := s.Sign(claims)
+	if err != nil {
+		t.Fatalf("Sign: %v", err)
+	}
+	if err := parse(s, token); err != nil {
+		t.Errorf("token of the active key: %v", err)
+	}
+	if err := parse(s, legacy); err == nil {
+		t.Error("token without a key ID verified after Rotate")
+	}
+	if err := parse(NewSet("secret", nil), legacy); err != nil {
+		t.Errorf("token without a key ID and no require_kid: %v", err)
+	}
+}
+
+func TestKeyEncryptionKey(t *testing.T) {
+	ctx := context.Background()
+
+	if _, err := NewSet("secret", newMemoryStore()).Rotate(ctx, time.Now()); !errors.Is(err, ErrNoEncryption) {
+		t.Errorf("Rotate without a key encryption key: error %v, want %v", err, ErrNoEncryption)
+	}
+
+	store := newMemoryStore()
+	s := NewSet("secret", store, WithKeyEncryptionKey("kek"))
+	if _, err := s.Rotate(ctx, time.Now()); err != nil {
+		t.Fatalf("Rotate: %v", err)
+	}
+	if got := len(s.Keys()); got != 1 {
+		t.Fatalf("%d keys loaded, want 1", got)
+	}
+
+	// Only the key encryption key opens stored keys, the JWT secret plays no
+	// part.
+	if err := NewSet("other secret", store, WithKeyEncryptionKey("kek")).Reload(ctx); err != nil {
+		t.Errorf("Reload with the key encryption key and another secret: %v", err)
+	}
+	if err := NewSet("secret", store, WithKeyEncryptionKey("other kek")).Reload(ctx); err == nil {
+		t.Error("Reload opened a key with another key encryption key")
+	}
+	if err := NewSet("secret", store, WithKeyEncryptionKey("secret")).Reload(ctx); err == nil {
+		t.Error("Reload opened a key with the JWT secret")
+	}
+	if err := NewSet("secret", store).Reload(ctx); !errors.Is(err, ErrNoEncryption) {
+		t.Errorf("Reload without a key encryption key: error %v, want %v", err, ErrNoEncryption)
+	}
+}
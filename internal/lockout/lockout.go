@@ -0,0 +1,125 @@
+package lockout
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// maxShift keeps the exponential lockout from overflowing time.Duration.
+const maxShift = 30
+
+// Policy locks a key out once it collects Threshold failures within Window.
+// The first lockout lasts BaseDuration and every further failure doubles it,
+// up to MaxDuration.
+type Policy struct {
+	Threshold    int
+	Window       time.Duration
+	BaseDuration time.Duration
+	MaxDuration  time.Duration
+}
+
+type State struct {
+	Failures      int
+	LastFailureAt time.Time
+	LockedUntil   time.Time
+}
+
+// Fail returns the state after one more failure at now.
+func (p Policy) Fail(s State, now time.Time) State {
+	// The window starts after the last lockout ends, otherwise a lockout longer
+	// than the window would reset the counter and never grow.
+	since := s.LastFailureAt
+	if s.LockedUntil.After(since) {
+		since = s.LockedUntil
+	}
+	if now.Sub(since) > p.Window {
+		s.Failures = 0
+	}
+
+	s.Failures++
+	s.LastFailureAt = now
+
+	if s.Failures >= p.Threshold {
+		shift := min(s.Failures-p.Threshold, maxShift)
+		d := p.BaseDuration << shift
+		if d <= 0 || d > p.MaxDuration {
+			d = p.MaxDuration
+		}
+		s.LockedUntil = now.Add(d)
+	}
+
+	return s
+}
+
+type Store interface {
+	GetLockoutState(ctx context.Context, key string) (State, error)
+	// RegisterLockoutFailure atomically applies policy.Fail to the state of key.
+	RegisterLockoutFailure(ctx context.Context, key string, policy Policy) (State, error)
+	ResetLockoutState(ctx context.Context, key string) error
+}
+
+// Purger is implemented by shared stores, which keep the state of every key
+// that ever failed until the janitor deletes it.
+type Purger interface {
+	// DeleteStaleLockouts deletes at most limit keys that are not locked and
+	// whose failures fell out of window before now, i.e. keys Fail would
+	// start counting from zero again.
+	DeleteStaleLockouts(ctx context.Context, now time.Time, window time.Duration, limit int) (int64, error)
+}
+
+type Guard struct {
+	store  Store
+	policy Policy
+}
+
+func NewGuard(store Store, policy Policy) *Guard {
+	return &Guard{
+		store:  store,
+		policy: policy,
+	}
+}
+
+// LockedUntil returns the end of the current lockout of key, or the zero time
+// if key is not locked.
+func (g *Guard) LockedUntil(ctx context.Context, key string) (time.Time, error) {
+	const op = "lockout.Guard.LockedUntil"
+
+	state, err := g.store.GetLockoutState(ctx, key)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if state.LockedUntil.After(time.Now()) {
+		return state.LockedUntil, nil
+	}
+
+	return time.Time{}, nil
+}
+
+// RegisterFailure counts a failed attempt for key. If the failure triggers a
+// lockout its end is returned, otherwise the zero time.
+func (g *Guard) RegisterFailure(ctx context.Context, key string) (time.Time, error) {
+	const op = "lockout.Guard.RegisterFailure"
+
+	state, err := g.store.RegisterLockoutFailure(ctx, key, g.policy)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if state.LockedUntil.After(time.Now()) {
+		return state.LockedUntil, nil
+	}
+
+	return time.Time{}, nil
+}
+
+func (g *Guard) Reset(ctx context.Context, key string) error {
+	const op = "lockout.Guard.Reset"
+
+	if err := g.store.ResetLockoutState(ctx, key); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
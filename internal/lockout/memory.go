@@ -0,0 +1,65 @@
+package lockout
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Memory keeps lockout state in process memory. It is only correct for a
+// single replica; use the postgres store when running several.
+type Memory struct {
+	mu        sync.Mutex
+	states    map[string]State
+	lastSweep time.Time
+}
+
+const sweepInterval = time.Minute
+
+func NewMemory() *Memory {
+	return &Memory{
+		states:    make(map[string]State),
+		lastSweep: time.Now(),
+	}
+}
+
+func (m *Memory) GetLockoutState(_ context.Context, key string) (State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return m.states[key], nil
+}
+
+func (m *Memory) RegisterLockoutFailure(_ context.Context, key string, policy Policy) (State, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := time.Now()
+	if now.Sub(m.lastSweep) > sweepInterval {
+		m.sweep(now, policy.Window)
+	}
+
+	state := policy.Fail(m.states[key], now)
+	m.states[key] = state
+
+	return state, nil
+}
+
+func (m *Memory) ResetLockoutState(_ context.Context, key string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.states, key)
+
+	return nil
+}
+
+// sweep forgets keys whose failures have fallen out of the window.
+func (m *Memory) sweep(now time.Time, window time.Duration) {
+	for key, state := range m.states {
+		if now.Sub(state.LastFailureAt) > window && now.After(state.LockedUntil.Add(window)) {
+			delete(m.states, key)
+		}
+	}
+	m.lastSweep = now
+}
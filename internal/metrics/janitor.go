@@ -0,0 +1,68 @@
+package metrics
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+// Janitor counts janitor runs per task, it implements janitor.Metrics.
+type Janitor struct {
+	runs     *prometheus.CounterVec
+	deleted  *prometheus.CounterVec
+	errors   *prometheus.CounterVec
+	duration *prometheus.HistogramVec
+	skipped  prometheus.Counter
+}
+
+func NewJanitor(reg prometheus.Registerer) *Janitor {
+	m := &Janitor{
+		runs: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "janitor",
+			Name:      "runs_total",
+			Help:      "Janitor runs by task.",
+		}, []string{"task"}),
+		deleted: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "janitor",
+			Name:      "deleted_total",
+			Help:      "Rows purged by the janitor by task.",
+		}, []string{"task"}),
+		errors: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "janitor",
+			Name:      "errors_total",
+			Help:      "Janitor runs stopped by an error by task.",
+		}, []string{"task"}),
+		duration: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Subsystem: "janitor",
+			Name:      "run_duration_seconds",
+			Help:      "Janitor run duration by task.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{"task"}),
+		skipped: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Subsystem: "janitor",
+			Name:      "skipped_total",
+			Help:      "Janitor runs skipped because another replica held the lock.",
+		}),
+	}
+
+	reg.MustRegister(m.runs, m.deleted, m.errors, m.duration, m.skipped)
+	return m
+}
+
+func (m *Janitor) ObserveRun(task string, deleted int64, duration time.Duration, err error) {
+	m.runs.WithLabelValues(task).Inc()
+	m.deleted.WithLabelValues(task).Add(float64(deleted))
+	if err != nil {
+		m.errors.WithLabelValues(task).Inc()
+	}
+	m.duration.WithLabelValues(task).Observe(duration.Seconds())
+}
+
+func (m *Janitor) ObserveSkipped() {
+	m.skipped.Inc()
+}
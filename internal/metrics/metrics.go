@@ -0,0 +1,64 @@
+// Package metrics exposes the service to Prometheus.
+package metrics
+
+import (
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const namespace = "auth"
+
+// Auth counts tokens and webhooks, it implements service.Metrics.
+type Auth struct {
+	issued        prometheus.Counter
+	refreshed     prometheus.Counter
+	refreshFailed *prometheus.CounterVec
+	webhooks      *prometheus.CounterVec
+}
+
+func NewAuth(reg prometheus.Registerer) *Auth {
+	m := &Auth{
+		issued: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tokens_issued_total",
+			Help:      "Token pairs issued for new sessions.",
+		}),
+		refreshed: prometheus.NewCounter(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "tokens_refreshed_total",
+			Help:      "Successful token refreshes.",
+		}),
+		refreshFailed: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "token_refresh_failures_total",
+			Help:      "Failed token refreshes by reason.",
+		}, []string{"reason"}),
+		webhooks: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "webhooks_total",
+			Help:      "Webhooks sent by event and status (delivered or failed).",
+		}, []string{"event", "status"}),
+	}
+
+	reg.MustRegister(m.issued, m.refreshed, m.refreshFailed, m.webhooks)
+	return m
+}
+
+func (m *Auth) ObserveTokensIssued() {
+	m.issued.Inc()
+}
+
+func (m *Auth) ObserveTokensRefreshed() {
+	m.refreshed.Inc()
+}
+
+func (m *Auth) ObserveRefreshFailed(reason string) {
+	m.refreshFailed.WithLabelValues(reason).Inc()
+}
+
+func (m *Auth) ObserveWebhook(event string, delivered bool) {
+	status := "delivered"
+	if !delivered {
+		status = "failed"
+	}
+	m.webhooks.WithLabelValues(event, status).Inc()
+}
@@ -0,0 +1,158 @@
+package policy
+
+import (
+	"fmt"
+	"net/netip"
+	"strings"
+	"time"
+)
+
+type Action string
+
+const (
+	ActionAllow  Action = "allow"
+	ActionNotify Action = "notify"
+	// ActionStepUp refuses the refresh but keeps the session: the client has
+	// to authenticate again before it gets new tokens.
+	ActionStepUp Action = "require_step_up"
+	ActionDeny   Action = "deny"
+	ActionRevoke Action = "revoke"
+)
+
+// severity orders actions; the strongest triggered action wins.
+var severity = map[Action]int{
+	ActionAllow:  0,
+	ActionNotify: 1,
+	ActionStepUp: 2,
+	ActionDeny:   3,
+	ActionRevoke: 4,
+}
+
+func ParseAction(s string) (Action, error) {
+	action := Action(strings.ToLower(strings.TrimSpace(s)))
+	if _, ok := severity[action]; !ok {
+		return "", fmt.Errorf("unknown policy action %q", s)
+	}
+	return action, nil
+}
+
+type Signal string
+
+const (
+	SignalUserAgentChange Signal = "user_agent_change"
+	SignalIPChange        Signal = "ip_change"
+	SignalSubnetChange    Signal = "subnet_change"
+	SignalASNChange       Signal = "asn_change"
+	SignalGeoChange       Signal = "geo_change"
+	// SignalImpossibleTravel fires when the distance between consecutive
+	// refreshes cannot be covered in the time between them.
+	SignalImpossibleTravel Signal = "impossible_travel"
+	SignalTokenAge         Signal = "token_age"
+)
+
+// Observation is what changed between the session and the refresh request.
+type Observation struct {
+	UserAgentChanged bool
+	IPChanged        bool
+	SubnetChanged    bool
+	ASNChanged       bool
+	GeoChanged       bool
+	ImpossibleTravel bool
+	TokenAge         time.Duration
+}
+
+type Decision struct {
+	Action Action
+	// Signals lists every signal that fired, in evaluation order.
+	Signals []Signal
+	// Notify is set if any fired signal asks for a notification, even when a
+	// stronger action wins.
+	Notify bool
+}
+
+func (d Decision) SignalNames() string {
+	names := make([]string, len(d.Signals))
+	for i, signal := range d.Signals {
+		names[i] = string(signal)
+	}
+	return strings.Join(names, ",")
+}
+
+type Engine struct {
+	actions     map[Signal]Action
+	maxTokenAge time.Duration
+}
+
+// NewEngine builds an engine from per-signal actions. Signals without an
+// action are allowed. maxTokenAge of zero disables the token age signal.
+func NewEngine(actions map[Signal]Action, maxTokenAge time.Duration) *Engine {
+	return &Engine{
+		actions:     actions,
+		maxTokenAge: maxTokenAge,
+	}
+}
+
+// Default reproduces the historical behavior: a changed user agent revokes
+// the session and a changed IP address sends a notification.
+func Default() *Engine {
+	return NewEngine(map[Signal]Action{
+		SignalUserAgentChange: ActionRevoke,
+		SignalIPChange:        ActionNotify,
+	}, 0)
+}
+
+func (e *Engine) Evaluate(obs Observation) Decision {
+	fired := []struct {
+		signal Signal
+		ok     bool
+	}{
+		{SignalUserAgentChange, obs.UserAgentChanged},
+		{SignalIPChange, obs.IPChanged},
+		{SignalSubnetChange, obs.SubnetChanged},
+		{SignalASNChange, obs.ASNChanged},
+		{SignalGeoChange, obs.GeoChanged},
+		{SignalImpossibleTravel, obs.ImpossibleTravel},
+		{SignalTokenAge, e.maxTokenAge > 0 && obs.TokenAge > e.maxTokenAge},
+	}
+
+	decision := Decision{Action: ActionAllow}
+	for _, f := range fired {
+		if !f.ok {
+			continue
+		}
+
+		decision.Signals = append(decision.Signals, f.signal)
+
+		action, ok := e.actions[f.signal]
+		if !ok {
+			continue
+		}
+		if action == ActionNotify {
+			decision.Notify = true
+		}
+		if severity[action] > severity[decision.Action] {
+			decision.Action = action
+		}
+	}
+
+	return decision
+}
+
+// SameSubnet reports whether a and b share a /24 (IPv4) or /48 (IPv6)
+// network, roughly what a single ISP customer keeps across reconnects.
+func SameSubnet(a, b netip.Addr) bool {
+	if !a.IsValid() || !b.IsValid() || a.Is4() != b.Is4() {
+		return false
+	}
+
+	bits := 48
+	if a.Is4() {
+		bits = 24
+	}
+
+	prefix, err := a.Prefix(bits)
+	if err != nil {
+		return false
+	}
+	return prefix.Contains(b)
+}
@@ -0,0 +1,163 @@
+package policy
+
+import (
+	"net/netip"
+	"slices"
+	"testing"
+	"time"
+)
+
+func TestEvaluate(t *testing.T) {
+	engine := NewEngine(map[Signal]Action{
+		SignalUserAgentChange:  ActionRevoke,
+		SignalIPChange:         ActionNotify,
+		SignalSubnetChange:     ActionAllow,
+		SignalGeoChange:        ActionStepUp,
+		SignalImpossibleTravel: ActionDeny,
+		SignalTokenAge:         ActionStepUp,
+	}, time.Hour)
+
+	tests := []struct {
+		name        string
+		obs         Observation
+		wantAction  Action
+		wantSignals []Signal
+		wantNotify  bool
+	}{
+		{
+			name:       "nothing changed",
+			wantAction: ActionAllow,
+		},
+		{
+			name:        "notify",
+			obs:         Observation{IPChanged: true},
+			wantAction:  ActionNotify,
+			wantSignals: []Signal{SignalIPChange},
+			wantNotify:  true,
+		},
+		{
+			name:        "allowed signal is still reported",
+			obs:         Observation{SubnetChanged: true},
+			wantAction:  ActionAllow,
+			wantSignals: []Signal{SignalSubnetChange},
+		},
+		{
+			name:        "signal without an action is allowed",
+			obs:         Observation{ASNChanged: true},
+			wantAction:  ActionAllow,
+			wantSignals: []Signal{SignalASNChange},
+		},
+		{
+			name:        "strongest action wins and notify is kept",
+			obs:         Observation{UserAgentChanged: true, IPChanged: true, GeoChanged: true},
+			wantAction:  ActionRevoke,
+			wantSignals: []Signal{SignalUserAgentChange, SignalIPChange, SignalGeoChange},
+			wantNotify:  true,
+		},
+		{
+			name:        "deny over step up",
+			obs:         Observation{GeoChanged: true, ImpossibleTravel: true},
+			wantAction:  ActionDeny,
+			wantSignals: []Signal{SignalGeoChange, SignalImpossibleTravel},
+		},
+		{
+			name:        "old token",
+			obs:         Observation{TokenAge: 2 * time.Hour},
+			wantAction:  ActionStepUp,
+			wantSignals: []Signal{SignalTokenAge},
+		},
+		{
+			name:       "token at the maximum age",
+			obs:        Observation{TokenAge: time.Hour},
+			wantAction: ActionAllow,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := engine.Evaluate(tt.obs)
+			if got.Action != tt.wantAction || !slices.Equal(got.Signals, tt.wantSignals) || got.Notify != tt.wantNotify {
+				t.Errorf("Evaluate = %+v, want action %s, signals %v, notify %t",
+					got, tt.wantAction, tt.wantSignals, tt.wantNotify)
+			}
+		})
+	}
+}
+
+func TestEvaluateWithoutMaxTokenAge(t *testing.T) {
+	engine := NewEngine(map[Signal]Action{SignalTokenAge: ActionDeny}, 0)
+
+	if got := engine.Evaluate(Observation{TokenAge: 1000 * time.Hour}); got.Action != ActionAllow || len(got.Signals) != 0 {
+		t.Errorf("Evaluate = %+v, want the token age signal disabled", got)
+	}
+}
+
+func TestDefault(t *testing.T) {
+	tests := []struct {
+		obs  Observation
+		want Action
+	}{
+		{Observation{}, ActionAllow},
+		{Observation{IPChanged: true}, ActionNotify},
+		{Observation{UserAgentChanged: true}, ActionRevoke},
+		{Observation{GeoChanged: true, ASNChanged: true}, ActionAllow},
+	}
+
+	for _, tt := range tests {
+		if got := Default().Evaluate(tt.obs); got.Action != tt.want {
+			t.Errorf("Default().Evaluate(%+v) = %s, want %s", tt.obs, got.Action, tt.want)
+		}
+	}
+}
+
+func TestParseAction(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Action
+		wantErr bool
+	}{
+		{in: "allow", want: ActionAllow},
+		{in: " Notify ", want: ActionNotify},
+		{in: "require_step_up", want: ActionStepUp},
+		{in: "DENY", want: ActionDeny},
+		{in: "revoke", want: ActionRevoke},
+		{in: "block", wantErr: true},
+		{in: "", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		got, err := ParseAction(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseAction(%q) = %q, %v, want %q, error %t", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
+
+func TestSameSubnet(t *testing.T) {
+	tests := []struct {
+		a, b string
+		want bool
+	}{
+		{"203.0.113.7", "203.0.113.200", true},
+		{"203.0.113.7", "203.0.114.7", false},
+		{"2001:db8:1::1", "2001:db8:1:ffff::1", true},
+		{"2001:db8:1::1", "2001:db8:2::1", false},
+		{"203.0.113.7", "::ffff:203.0.113.8", false},
+		{"203.0.113.7", "", false},
+	}
+
+	for _, tt := range tests {
+		a, _ := netip.ParseAddr(tt.a)
+		b, _ := netip.ParseAddr(tt.b)
+		if got := SameSubnet(a, b); got != tt.want {
+			t.Errorf("SameSubnet(%s, %s) = %t, want %t", tt.a, tt.b, got, tt.want)
+		}
+	}
+}
+
+func TestSignalNames(t *testing.T) {
+	d := Decision{Signals: []Signal{SignalIPChange, SignalGeoChange}}
+	if got, want := d.SignalNames(), "ip_change,geo_change"; got != want {
+		t.Errorf("SignalNames = %q, want %q", got, want)
+	}
+}
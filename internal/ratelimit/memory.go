@@ -0,0 +1,77 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+const sweepInterval = time.Minute
+
+type bucket struct {
+	tokens    float64
+	updatedAt time.Time
+	limit     Limit
+}
+
+// Memory keeps buckets in process memory. It is only correct for a single
+// replica; use the postgres store when running several.
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		buckets:   make(map[string]*bucket),
+		lastSweep: time.Now(),
+	}
+}
+
+func (m *Memory) TakeRateLimitToken(_ context.Context, key string, limit Limit) (Result, error) {
+	now := time.Now()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if now.Sub(m.lastSweep) > sweepInterval {
+		m.sweep(now)
+	}
+
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &bucket{tokens: float64(limit.Burst), updatedAt: now}
+		m.buckets[key] = b
+	}
+
+	tokens, res := limit.Take(b.tokens, now.Sub(b.updatedAt))
+	b.tokens = tokens
+	b.updatedAt = now
+	b.limit = limit
+
+	return res, nil
+}
+
+func (m *Memory) ReturnRateLimitToken(_ context.Context, key string, limit Limit) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	// A bucket swept in the meantime is full already.
+	if b, ok := m.buckets[key]; ok {
+		b.tokens = min(float64(limit.Burst), b.tokens+1)
+	}
+	return nil
+}
+
+// sweep drops buckets that have refilled completely, they are
+// indistinguishable from new ones.
+func (m *Memory) sweep(now time.Time) {
+	for key, b := range m.buckets {
+		missing := float64(b.limit.Burst) - b.tokens
+		if now.Sub(b.updatedAt).Seconds()*b.limit.Rate >= missing {
+			delete(m.buckets, key)
+		}
+	}
+	m.lastSweep = now
+}
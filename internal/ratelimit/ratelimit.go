@@ -0,0 +1,65 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"time"
+)
+
+// Limit describes a token bucket: it refills at Rate tokens per second and
+// holds at most Burst tokens.
+type Limit struct {
+	Rate  float64
+	Burst int
+}
+
+// Every returns a limit allowing n requests per period with a burst of n.
+func Every(n int, period time.Duration, burst int) Limit {
+	if n <= 0 || period <= 0 {
+		return Limit{}
+	}
+	if burst <= 0 {
+		burst = n
+	}
+	return Limit{Rate: float64(n) / period.Seconds(), Burst: burst}
+}
+
+// Disabled reports whether the limit lets everything through.
+func (l Limit) Disabled() bool {
+	return l.Rate <= 0 || l.Burst <= 0
+}
+
+type Result struct {
+	Allowed    bool
+	RetryAfter time.Duration
+}
+
+// Take refills a bucket that held tokens elapsed ago and tries to take one
+// token from it. It returns the new amount of tokens in the bucket.
+func (l Limit) Take(tokens float64, elapsed time.Duration) (float64, Result) {
+	if elapsed > 0 {
+		tokens = math.Min(float64(l.Burst), tokens+elapsed.Seconds()*l.Rate)
+	}
+
+	if tokens >= 1 {
+		return tokens - 1, Result{Allowed: true}
+	}
+
+	wait := time.Duration((1 - tokens) / l.Rate * float64(time.Second))
+	return tokens, Result{Allowed: false, RetryAfter: wait}
+}
+
+type Store interface {
+	TakeRateLimitToken(ctx context.Context, key string, limit Limit) (Result, error)
+	// ReturnRateLimitToken gives back a token taken for a request that was
+	// denied by a later limit, never filling the bucket beyond its burst.
+	ReturnRateLimitToken(ctx context.Context, key string, limit Limit) error
+}
+
+// Purger is implemented by shared stores, which keep buckets until the
+// janitor deletes them.
+type Purger interface {
+	// DeleteFullRateLimits deletes at most limit buckets that have refilled
+	// completely by now and returns how many it deleted.
+	DeleteFullRateLimits(ctx context.Context, now time.Time, limit int) (int64, error)
+}
@@ -0,0 +1,133 @@
+package ratelimit
+
+import (
+	"context"
+	"math"
+	"testing"
+	"time"
+)
+
+func TestEvery(t *testing.T) {
+	tests := []struct {
+		name   string
+		n      int
+		period time.Duration
+		burst  int
+		want   Limit
+	}{
+		{name: "burst defaults to n", n: 30, period: time.Minute, want: Limit{Rate: 0.5, Burst: 30}},
+		{name: "explicit burst", n: 10, period: time.Second, burst: 5, want: Limit{Rate: 10, Burst: 5}},
+		{name: "no requests", n: 0, period: time.Minute, want: Limit{}},
+		{name: "no period", n: 10, period: 0, want: Limit{}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Every(tt.n, tt.period, tt.burst)
+			if got != tt.want {
+				t.Errorf("Every(%d, %s, %d) = %+v, want %+v", tt.n, tt.period, tt.burst, got, tt.want)
+			}
+			if got.Disabled() != (tt.want == Limit{}) {
+				t.Errorf("Disabled = %t", got.Disabled())
+			}
+		})
+	}
+}
+
+func TestTake(t *testing.T) {
+	limit := Limit{Rate: 2, Burst: 3}
+
+	tests := []struct {
+		name           string
+		tokens         float64
+		elapsed        time.Duration
+		wantTokens     float64
+		wantAllowed    bool
+		wantRetryAfter time.Duration
+	}{
+		{name: "full bucket", tokens: 3, wantTokens: 2, wantAllowed: true},
+		{name: "last token", tokens: 1, wantTokens: 0, wantAllowed: true},
+		{name: "empty bucket", tokens: 0, wantTokens: 0, wantRetryAfter: 500 * time.Millisecond},
+		{name: "partly refilled", tokens: 0.5, wantTokens: 0.5, wantRetryAfter: 250 * time.Millisecond},
+		{name: "refilled by elapsed time", tokens: 0, elapsed: time.Second, wantTokens: 1, wantAllowed: true},
+		{name: "refill stops at burst", tokens: 0, elapsed: time.Hour, wantTokens: 2, wantAllowed: true},
+		{name: "clock went back", tokens: 0.5, elapsed: -time.Second, wantTokens: 0.5, wantRetryAfter: 250 * time.Millisecond},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tokens, res := limit.Take(tt.tokens, tt.elapsed)
+			if math.Abs(tokens-tt.wantTokens) > 1e-9 || res.Allowed != tt.wantAllowed || res.RetryAfter != tt.wantRetryAfter {
+				t.Errorf("Take(%g, %s) = %g, %+v, want %g, allowed %t, retry after %s",
+					tt.tokens, tt.elapsed, tokens, res, tt.wantTokens, tt.wantAllowed, tt.wantRetryAfter)
+			}
+		})
+	}
+}
+
+func TestMemory(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	limit := Limit{Rate: 0.001, Burst: 2}
+
+	for i, want := range []bool{true, true, false} {
+		res, err := m.TakeRateLimitToken(ctx, "ip:203.0.113.7", limit)
+		if err != nil {
+			t.Fatalf("TakeRateLimitToken: %v", err)
+		}
+		if res.Allowed != want {
+			t.Errorf("request %d: allowed %t, want %t", i+1, res.Allowed, want)
+		}
+		if !res.Allowed && res.RetryAfter <= 0 {
+			t.Errorf("request %d: RetryAfter %s, want it positive", i+1, res.RetryAfter)
+		}
+	}
+
+	// Keys have buckets of their own.
+	res, err := m.TakeRateLimitToken(ctx, "ip:203.0.113.8", limit)
+	if err != nil || !res.Allowed {
+		t.Errorf("other key: %+v, %v, want allowed", res, err)
+	}
+}
+
+func TestMemoryReturn(t *testing.T) {
+	ctx := context.Background()
+	m := NewMemory()
+	limit := Limit{Rate: 0.001, Burst: 1}
+
+	if res, err := m.TakeRateLimitToken(ctx, "ip:203.0.113.7", limit); err != nil || !res.Allowed {
+		t.Fatalf("TakeRateLimitToken = %+v, %v, want allowed", res, err)
+	}
+	for range 2 {
+		if err := m.ReturnRateLimitToken(ctx, "ip:203.0.113.7", limit); err != nil {
+			t.Fatalf("ReturnRateLimitToken: %v", err)
+		}
+	}
+
+	// Returning more tokens than were taken does not raise the burst.
+	for i, want := range []bool{true, false} {
+		res, err := m.TakeRateLimitToken(ctx, "ip:203.0.113.7", limit)
+		if err != nil {
+			t.Fatalf("TakeRateLimitToken: %v", err)
+		}
+		if res.Allowed != want {
+			t.Errorf("request %d after the return: allowed %t, want %t", i+1, res.Allowed, want)
+		}
+	}
+}
+
+func TestMemorySweep(t *testing.T) {
+	m := NewMemory()
+	now := time.Now()
+	m.buckets["full"] = &bucket{tokens: 1, updatedAt: now.Add(-time.Second), limit: Limit{Rate: 1, Burst: 2}}
+	m.buckets["refilling"] = &bucket{tokens: 0, updatedAt: now.Add(-time.Second), limit: Limit{Rate: 1, Burst: 2}}
+
+	m.sweep(now)
+
+	if _, ok := m.buckets["full"]; ok {
+		t.Error("refilled bucket kept")
+	}
+	if _, ok := m.buckets["refilling"]; !ok {
+		t.Error("refilling bucket dropped")
+	}
+}
@@ -1,154 +1,424 @@
 package service
 
 import (
-	"bytes"
 	"context"
+	"crypto/hmac"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"log/slog"
-	"net/http"
+	"net/netip"
 	"test2auth/domain"
+	"test2auth/internal/geoip"
+	"test2auth/internal/jwtkeys"
+	"test2auth/internal/policy"
+	"test2auth/internal/tracing"
+	"test2auth/internal/useragent"
+	"test2auth/internal/webhook"
 	"time"
 
 	"github.com/dgrijalva/jwt-go"
 	"github.com/google/uuid"
-	"golang.org/x/crypto/bcrypt"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/trace"
 )
 
+var tracer = otel.Tracer("test2auth/internal/service")
+
 //go:generate go run github.com/vektra/mockery/v2@v2.42.1 --name=AuthService
 type AuthService interface {
-	CreateTokens(ctx context.Context, userID uuid.UUID, userAgent, ip string) (accessToken, refreshToken string, err error)
-	RefreshTokens(ctx context.Context, accessToken, refreshToken, userAgent, ip string) (newAccessToken, newRefreshToken string, err error)
-	Logout(ctx context.Context, userID uuid.UUID) error
+	CreateTokens(ctx context.Context, userID uuid.UUID, userAgent string, ip netip.Addr) (accessToken, refreshToken string, err error)
+	// RefreshTokens rotates the session of refreshToken. accessToken may be
+	// empty unless access token binding is required.
+	RefreshTokens(ctx context.Context, accessToken, refreshToken, userAgent string, ip netip.Addr) (newAccessToken, newRefreshToken string, err error)
+	Logout(ctx context.Context, userID, sessionID uuid.UUID) error
+	LogoutAll(ctx context.Context, userID uuid.UUID) error
+	ListSessions(ctx context.Context, userID uuid.UUID) ([]domain.Session, error)
+	RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error
+	// IssueAdminToken returns an access token with the admin scope to one of
+	// the admins. It is not tied to a session and not offered over the API.
+	IssueAdminToken(ctx context.Context, userID uuid.UUID) (string, error)
+	// RefreshTokenOwner returns the user of the session refreshToken belongs
+	// to, without checking or rotating it.
+	RefreshTokenOwner(ctx context.Context, refreshToken string) (uuid.UUID, error)
 }
 
+// ScopeAdmin is the access token scope required by the admin API. Only
+// IssueAdminToken hands it out.
+const ScopeAdmin = "admin"
+
 type Storage interface {
-	SaveSession(ctx context.Context, session domain.Session) error
-	GetSession(ctx context.Context, userID uuid.UUID) (domain.Session, error)
-	DeleteSession(ctx context.Context, userID uuid.UUID) error
+	// SaveSession stores a new session, atomically enforcing limit. It returns
+	// the sessions it evicted or domain.ErrSessionLimitReached.
+	SaveSession(ctx context.Context, session domain.Session, limit domain.SessionLimit) (uuid.UUID, []domain.Session, error)
+	GetSession(ctx context.Context, id uuid.UUID) (domain.Session, error)
+	// GetSessionByRefreshToken finds the session whose current or previous
+	// refresh token has the given hash.
+	GetSessionByRefreshToken(ctx context.Context, tokenHash string) (domain.Session, error)
+	ListUserSessions(ctx context.Context, userID uuid.UUID) ([]domain.Session, error)
+	// RotateSession replaces the session if its refresh token hash is still
+	// prevHash, and returns domain.ErrRefreshConflict otherwise.
+	RotateSession(ctx context.Context, session domain.Session, prevHash string) error
+	DeleteSession(ctx context.Context, id uuid.UUID) error
+	DeleteUserSessions(ctx context.Context, userID uuid.UUID) error
+}
+
+type Auditor interface {
+	Record(ctx context.Context, event string, userID uuid.UUID, ip string, details map[string]string)
 }
 
+type noopAuditor struct{}
+
+func (noopAuditor) Record(context.Context, string, uuid.UUID, string, map[string]string) {}
+
 type authService struct {
 	storage    Storage
 	log        *slog.Logger
+	auditor    Auditor
+	metrics    Metrics
+	lockout    LockoutGuard
+	policy     Policy
+	geo        GeoLocator
+	travel     geoip.TravelCheck
+	uaMatch    useragent.Strictness
+	admins     map[uuid.UUID]bool
+	adminTTL   time.Duration
 	jwtSecret  string
-	webhookURL string
+	keys       *jwtkeys.Set
+	webhooks   *webhook.Sender
 	accessTTL  time.Duration
 	refreshTTL time.Duration
+	// idleTimeout and maxLifetime are optional, see WithSessionLifetime.
+	idleTimeout time.Duration
+	maxLifetime time.Duration
+	// sessionLimit is optional, see WithSessionLimit.
+	sessionLimit domain.SessionLimit
+	// gracePeriod is optional, see WithRefreshGracePeriod.
+	gracePeriod time.Duration
+	// refreshTokenKey keys the refresh token hash, see WithRefreshTokenKey.
+	refreshTokenKey []byte
+	// requireBinding makes the access token mandatory on refresh, see
+	// WithAccessTokenBinding.
+	requireBinding bool
 }
 
-func NewAuthService(storage Storage, log *slog.Logger, jwtSecret, webhookURL string, accessTTL, refreshTTL time.Duration) AuthService {
-	return &authService{
+type Option func(*authService)
+
+// WithAuditor records security relevant events to the given audit log.
+func WithAuditor(auditor Auditor) Option {
+	return func(s *authService) {
+		s.auditor = auditor
+	}
+}
+
+// WithRefreshTokenKey sets the key of the refresh token hash. Changing it
+// invalidates all refresh tokens.
+func WithRefreshTokenKey(key string) Option {
+	return func(s *authService) {
+		if key != "" {
+			s.refreshTokenKey = []byte(key)
+		}
+	}
+}
+
+// WithAccessTokenBinding requires the access token of the session next to
+// the refresh token. Without it the access token is optional and only checked
+// when sent.
+func WithAccessTokenBinding(required bool) Option {
+	return func(s *authService) {
+		s.requireBinding = required
+	}
+}
+
+// WithSigningKeys signs and verifies access tokens with a key set instead of
+// the JWT secret alone.
+func WithSigningKeys(keys *jwtkeys.Set) Option {
+	return func(s *authService) {
+		s.keys = keys
+	}
+}
+
+// WithWebhookSender replaces the default sender for webhookURL, e.g. with one
+// that logs deliveries.
+func WithWebhookSender(sender *webhook.Sender) Option {
+	return func(s *authService) {
+		s.webhooks = sender
+	}
+}
+
+// WithAdmins lets IssueAdminToken issue admin tokens valid for tokenTTL to
+// the given users.
+func WithAdmins(userIDs []uuid.UUID, tokenTTL time.Duration) Option {
+	return func(s *authService) {
+		s.adminTTL = tokenTTL
+		s.admins = make(map[uuid.UUID]bool, len(userIDs))
+		for _, id := range userIDs {
+			s.admins[id] = true
+		}
+	}
+}
+
+func NewAuthService(storage Storage, log *slog.Logger, jwtSecret, webhookURL string, accessTTL, refreshTTL time.Duration, opts ...Option) AuthService {
+	s := &authService{
 		storage:    storage,
 		log:        log,
+		auditor:    noopAuditor{},
+		metrics:    noopMetrics{},
+		lockout:    noopLockout{},
+		policy:     policy.Default(),
+		geo:        noopLocator{},
+		uaMatch:    useragent.MatchExact,
 		jwtSecret:  jwtSecret,
-		webhookURL: webhookURL,
+		keys:       jwtkeys.NewSet(jwtSecret, nil),
+		webhooks:   webhook.NewSender(webhookURL, log),
 		accessTTL:  accessTTL,
 		refreshTTL: refreshTTL,
+		// Until a dedicated key is configured the JWT secret keys the hash.
+		refreshTokenKey: []byte(jwtSecret),
+	}
+
+	for _, opt := range opts {
+		opt(s)
 	}
+
+	return s
 }
 
-func (s *authService) CreateTokens(ctx context.Context, userID uuid.UUID, userAgent, ip string) (string, string, error) {
+func (s *authService) CreateTokens(ctx context.Context, userID uuid.UUID, userAgent string, ip netip.Addr) (string, string, error) {
 	const op = "service.auth.CreateTokens"
 
-	accessToken, err := s.createAccessToken(userID)
+	ctx, span := tracer.Start(ctx, op, trace.WithAttributes(attribute.String("user.id", userID.String())))
+	defer span.End()
+
+	refreshToken, refreshTokenHash, err := s.createRefreshToken()
 	if err != nil {
 		return "", "", fmt.Errorf("%s: %w", op, err)
 	}
 
-	refreshToken, err := s.createRefreshToken()
+	now := time.Now()
+	session := domain.Session{
+		UserID:           userID,
+		RefreshTokenHash: refreshTokenHash,
+		UserAgent:        userAgent,
+		Device:           useragent.Parse(userAgent),
+		IP:               ip,
+		Location:         s.geo.Lookup(ip),
+		ExpiresAt:        s.expiresAt(now, now),
+		LastUsedAt:       now,
+	}
+
+	sessionID, evicted, err := s.storage.SaveSession(ctx, session, s.sessionLimit)
 	if err != nil {
+		if errors.Is(err, domain.ErrSessionLimitReached) {
+			s.reportSessionLimit(ctx, userID, ip, session.Device.DeviceType)
+		}
 		return "", "", fmt.Errorf("%s: %w", op, err)
 	}
+	session.ID = sessionID
+	s.reportEvictions(ctx, evicted, session.ID, ip)
 
-	refreshTokenHash, err := bcrypt.GenerateFromPassword([]byte(refreshToken), bcrypt.DefaultCost)
+	accessToken, err := s.createAccessToken(userID, session.ID)
 	if err != nil {
 		return "", "", fmt.Errorf("%s: %w", op, err)
 	}
 
-	session := domain.Session{
-		UserID:           userID,
-		RefreshTokenHash: string(refreshTokenHash),
-		UserAgent:        userAgent,
-		IP:               ip,
-		ExpiresAt:        time.Now().Add(s.refreshTTL),
-	}
+	s.auditor.Record(ctx, domain.AuditSessionCreated, userID, ip.String(), map[string]string{
+		"session_id": session.ID.String(),
+		"user_agent": userAgent,
+	})
+	s.metrics.ObserveTokensIssued()
 
-	if err := s.storage.SaveSession(ctx, session); err != nil {
-		return "", "", fmt.Errorf("%s: %w", op, err)
+	return accessToken, refreshToken, nil
+}
+
+// RefreshTokens reports the outcome of refreshTokens to metrics and tracing.
+func (s *authService) RefreshTokens(ctx context.Context, accessToken, refreshToken, userAgent string, ip netip.Addr) (string, string, error) {
+	const op = "service.auth.RefreshTokens"
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	newAccessToken, newRefreshToken, err := s.refreshTokens(ctx, accessToken, refreshToken, userAgent, ip)
+	if err != nil {
+		reason := refreshFailureReason(err)
+		span.SetAttributes(attribute.String("refresh.failure_reason", reason))
+		tracing.RecordError(span, err)
+		s.metrics.ObserveRefreshFailed(reason)
+		return "", "", err
 	}
 
-	return accessToken, base64.StdEncoding.EncodeToString([]byte(refreshToken)), nil
+	s.metrics.ObserveTokensRefreshed()
+	return newAccessToken, newRefreshToken, nil
 }
 
-func (s *authService) RefreshTokens(ctx context.Context, accessToken, refreshToken, userAgent, ip string) (string, string, error) {
+func (s *authService) refreshTokens(ctx context.Context, accessToken, refreshToken, userAgent string, ip netip.Addr) (string, string, error) {
 	const op = "service.auth.RefreshTokens"
 
+	// Проверка блокировки IP после серии неудачных попыток
+	if err := s.checkLockout(ctx, ipLockoutKey(ip), true); err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
 	// Декодирование refresh token
 	decodedRefreshToken, err := base64.StdEncoding.DecodeString(refreshToken)
 	if err != nil {
+		s.registerFailure(ctx, uuid.Nil, ip)
 		return "", "", fmt.Errorf("%s: %w", op, domain.ErrInvalidRefreshToken)
 	}
 
-	// Парсинг access token для получения user_id
-	claims, err := s.parseAccessToken(accessToken)
+	// Access token необязателен, но если передан, должен относиться к той же сессии
+	var binding *tokenBinding
+	if accessToken != "" {
+		binding, err = s.parseBinding(accessToken)
+		if err != nil {
+			s.registerFailure(ctx, uuid.Nil, ip)
+			return "", "", fmt.Errorf("%s: %w", op, err)
+		}
+	} else if s.requireBinding {
+		s.registerFailure(ctx, uuid.Nil, ip)
+		return "", "", fmt.Errorf("%s: %w", op, domain.ErrInvalidAccessToken)
+	}
+
+	// Поиск сессии по хешу refresh токена
+	tokenHash := s.hashRefreshToken(decodedRefreshToken)
+	session, err := s.storage.GetSessionByRefreshToken(ctx, tokenHash)
+	if err == nil && binding != nil && (session.UserID != binding.userID || session.ID != binding.sessionID) {
+		err = domain.ErrSessionNotFound
+	}
 	if err != nil {
+		if errors.Is(err, domain.ErrSessionNotFound) {
+			failedUserID := uuid.Nil
+			if binding != nil {
+				failedUserID = binding.userID
+			}
+			s.auditor.Record(ctx, domain.AuditRefreshFailed, failedUserID, ip.String(), map[string]string{"reason": "invalid_refresh_token"})
+			s.registerFailure(ctx, failedUserID, ip)
+			return "", "", fmt.Errorf("%s: %w", op, &refreshFailure{reason: RefreshFailedNotFound, err: domain.ErrInvalidRefreshToken})
+		}
 		return "", "", fmt.Errorf("%s: %w", op, err)
 	}
-	userID, err := uuid.Parse(claims["sub"].(string))
-	if err != nil {
-		return "", "", fmt.Errorf("%s: invalid user id in token: %w", op, err)
+	userID := session.UserID
+
+	// Проверка блокировки пользователя
+	if err := s.checkLockout(ctx, userLockoutKey(userID), false); err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Проверка срока действия, простоя и максимального времени жизни сессии
+	if reason, err := s.checkLifetime(session, time.Now()); err != nil {
+		s.storage.DeleteSession(ctx, session.ID)
+		s.auditor.Record(ctx, domain.AuditRefreshFailed, userID, ip.String(), map[string]string{"reason": reason})
+		return "", "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	// Предъявлен предыдущий, уже заменённый refresh токен
+	if session.RefreshTokenHash != tokenHash {
+		// Токен только что заменён параллельным запросом того же клиента
+		if newAccessToken, newRefreshToken, ok := s.replayRotation(session, tokenHash, userAgent, ip); ok {
+			s.auditor.Record(ctx, domain.AuditSessionRefreshed, userID, ip.String(), map[string]string{
+				"session_id": session.ID.String(),
+				"replayed":   "true",
+			})
+			return newAccessToken, newRefreshToken, nil
+		}
+
+		// Повторное использование токена: сессия считается скомпрометированной
+		s.storage.DeleteSession(ctx, session.ID)
+		s.auditor.Record(ctx, domain.AuditRefreshFailed, userID, ip.String(), map[string]string{"reason": "refresh_token_reuse"})
+		s.registerFailure(ctx, userID, ip)
+		return "", "", fmt.Errorf("%s: %w", op, &refreshFailure{reason: RefreshFailedReused, err: domain.ErrInvalidRefreshToken})
+	}
+
+	// Проверка изменений User-Agent, IP и возраста токена по политике безопасности
+	if err := s.applyPolicy(ctx, session, userAgent, ip); err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
 	}
 
-	// Получение сессии из хранилища
-	session, err := s.storage.GetSession(ctx, userID)
+	// Ротация refresh токена в рамках той же сессии
+	newRefreshToken, newRefreshTokenHash, err := s.createRefreshToken()
 	if err != nil {
 		return "", "", fmt.Errorf("%s: %w", op, err)
 	}
 
-	// Проверка на несоответствие User-Agent
-	if session.UserAgent != userAgent {
-		s.log.Warn("user-agent mismatch on token refresh", slog.String("user_id", userID.String()))
-		s.storage.DeleteSession(ctx, userID) // Deauthorize user
-		return "", "", fmt.Errorf("%s: user-agent mismatch", op)
+	// Создание нового access токена
+	newAccessToken, err := s.createAccessToken(userID, session.ID)
+	if err != nil {
+		return "", "", fmt.Errorf("%s: %w", op, err)
 	}
 
-	// Проверка на изменение IP
-	if session.IP != ip {
-		s.log.Warn("ip address mismatch on token refresh", slog.String("user_id", userID.String()), slog.String("new_ip", ip))
-		s.sendIPMismatchWebhook(userID.String(), session.IP, ip)
+	now := time.Now()
+	prevHash := session.RefreshTokenHash
+	session.RefreshTokenHash = newRefreshTokenHash
+	session.UserAgent = userAgent
+	session.Device = useragent.Parse(userAgent)
+	session.IP = ip
+	session.Location = s.geo.Lookup(ip)
+	session.ExpiresAt = s.expiresAt(session.CreatedAt, now)
+	session.LastUsedAt = now
+	session.PrevRefreshTokenHash = prevHash
+	session.RotatedAt = now
+	session.GraceTokens = ""
+	session.GraceUntil = time.Time{}
+	if s.gracePeriod > 0 {
+		session.GraceUntil = now.Add(s.gracePeriod)
+		session.GraceTokens, err = s.sealGraceTokens(session.ID, graceTokens{
+			AccessToken:  newAccessToken,
+			RefreshToken: newRefreshToken,
+		})
+		if err != nil {
+			return "", "", fmt.Errorf("%s: %w", op, err)
+		}
 	}
 
-	// Проверка на истечение срока действия сессии
-	if time.Now().After(session.ExpiresAt) {
-		s.storage.DeleteSession(ctx, userID)
-		return "", "", fmt.Errorf("%s: %w", op, domain.ErrSessionExpired)
+	// Сравнение с хешем, прочитанным выше, защищает от параллельной ротации
+	if err := s.storage.RotateSession(ctx, session, prevHash); err != nil {
+		if errors.Is(err, domain.ErrRefreshConflict) {
+			if current, getErr := s.storage.GetSession(ctx, session.ID); getErr == nil {
+				if newAccessToken, newRefreshToken, ok := s.replayRotation(current, tokenHash, userAgent, ip); ok {
+					s.auditor.Record(ctx, domain.AuditSessionRefreshed, userID, ip.String(), map[string]string{
+						"session_id": session.ID.String(),
+						"replayed":   "true",
+					})
+					return newAccessToken, newRefreshToken, nil
+				}
+			}
+		}
+		return "", "", fmt.Errorf("%s: failed to rotate session: %w", op, err)
 	}
 
-	// Сравнение refresh токенов
-	if err := bcrypt.CompareHashAndPassword([]byte(session.RefreshTokenHash), decodedRefreshToken); err != nil {
-		s.storage.DeleteSession(ctx, userID)
-		return "", "", fmt.Errorf("%s: %w", op, domain.ErrInvalidRefreshToken)
+	s.auditor.Record(ctx, domain.AuditSessionRefreshed, userID, ip.String(), map[string]string{
+		"session_id": session.ID.String(),
+	})
+	s.resetFailures(ctx, userID)
+
+	return newAccessToken, newRefreshToken, nil
+}
+
+// RefreshTokenOwner lets the rate limiter count refresh requests per user,
+// they carry no other trace of the user.
+func (s *authService) RefreshTokenOwner(ctx context.Context, refreshToken string) (uuid.UUID, error) {
+	const op = "service.auth.RefreshTokenOwner"
+
+	decoded, err := base64.StdEncoding.DecodeString(refreshToken)
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%s: %w", op, domain.ErrInvalidRefreshToken)
 	}
 
-	// Удаление старой сессии для предотвращения повторного использования
-	if err := s.storage.DeleteSession(ctx, userID); err != nil {
-		return "", "", fmt.Errorf("%s: failed to delete old session: %w", op, err)
+	session, err := s.storage.GetSessionByRefreshToken(ctx, s.hashRefreshToken(decoded))
+	if err != nil {
+		return uuid.Nil, fmt.Errorf("%s: %w", op, err)
 	}
 
-	// Создание новых токенов
-	return s.CreateTokens(ctx, userID, userAgent, ip)
+	return session.UserID, nil
 }
 
 func (s *authService) parseAccessToken(tokenStr string) (jwt.MapClaims, error) {
-	token, err := jwt.Parse(tokenStr, func(token *jwt.Token) (interface{}, error) {
-		if _, ok := token.Method.(*jwt.SigningMethodHMAC); !ok {
-			return nil, fmt.Errorf("unexpected signing method: %v", token.Header["alg"])
-		}
-		return []byte(s.jwtSecret), nil
-	})
+	token, err := jwt.Parse(tokenStr, s.keys.Keyfunc)
 
 	if err != nil {
 		// Обработка ошибки истечения срока действия токена для возможности обновления
@@ -167,55 +437,204 @@ func (s *authService) parseAccessToken(tokenStr string) (jwt.MapClaims, error) {
 	return nil, domain.ErrInvalidAccessToken
 }
 
-func (s *authService) createAccessToken(userID uuid.UUID) (string, error) {
-	token := jwt.NewWithClaims(jwt.SigningMethodHS512, jwt.MapClaims{
+// sessionIDFromClaims reads the sid claim that binds an access token to its
+// session.
+func sessionIDFromClaims(claims jwt.MapClaims) (uuid.UUID, error) {
+	sid, ok := claims["sid"].(string)
+	if !ok {
+		return uuid.Nil, domain.ErrInvalidAccessToken
+	}
+
+	sessionID, err := uuid.Parse(sid)
+	if err != nil {
+		return uuid.Nil, domain.ErrInvalidAccessToken
+	}
+
+	return sessionID, nil
+}
+
+// tokenBinding ties a refresh request to the session of an access token.
+type tokenBinding struct {
+	userID    uuid.UUID
+	sessionID uuid.UUID
+}
+
+// parseBinding accepts expired access tokens, a refresh is what they are for.
+func (s *authService) parseBinding(accessToken string) (*tokenBinding, error) {
+	claims, err := s.parseAccessToken(accessToken)
+	if err != nil {
+		return nil, err
+	}
+
+	sub, _ := claims["sub"].(string)
+	userID, err := uuid.Parse(sub)
+	if err != nil {
+		return nil, domain.ErrInvalidAccessToken
+	}
+
+	sessionID, err := sessionIDFromClaims(claims)
+	if err != nil {
+		return nil, err
+	}
+
+	return &tokenBinding{userID: userID, sessionID: sessionID}, nil
+}
+
+func (s *authService) createAccessToken(userID, sessionID uuid.UUID) (string, error) {
+	claims := jwt.MapClaims{
 		"sub": userID.String(),
+		"sid": sessionID.String(),
 		"exp": time.Now().Add(s.accessTTL).Unix(),
+	}
+
+	return s.keys.Sign(claims)
+}
+
+func (s *authService) IssueAdminToken(ctx context.Context, userID uuid.UUID) (string, error) {
+	const op = "service.auth.IssueAdminToken"
+
+	if !s.admins[userID] {
+		return "", fmt.Errorf("%s: %w", op, domain.ErrNotAdmin)
+	}
+
+	// The token belongs to no session, so logging out cannot end it. It is
+	// short lived instead.
+	token, err := s.keys.Sign(jwt.MapClaims{
+		"sub":   userID.String(),
+		"sid":   uuid.Nil.String(),
+		"scope": ScopeAdmin,
+		"exp":   time.Now().Add(s.adminTTL).Unix(),
 	})
-	return token.SignedString([]byte(s.jwtSecret))
+	if err != nil {
+		return "", fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.auditor.Record(ctx, domain.AuditAdminTokenIssued, userID, "", map[string]string{
+		"expires_in": s.adminTTL.String(),
+	})
+
+	return token, nil
 }
 
-func (s *authService) createRefreshToken() (string, error) {
+// createRefreshToken returns the refresh token as given to the client and
+// the hash stored in the session.
+func (s *authService) createRefreshToken() (string, string, error) {
 	b := make([]byte, 32)
 	if _, err := rand.Read(b); err != nil {
-		return "", err
+		return "", "", err
 	}
-	return fmt.Sprintf("%x", b), nil
+	refreshToken := fmt.Sprintf("%x", b)
+
+	return base64.StdEncoding.EncodeToString([]byte(refreshToken)), s.hashRefreshToken([]byte(refreshToken)), nil
 }
 
-func (s *authService) sendIPMismatchWebhook(userID, oldIP, newIP string) {
-	const op = "service.auth.sendIPMismatchWebhook"
+// hashRefreshToken is a keyed SHA-256 of the decoded refresh token. Refresh
+// tokens carry 256 random bits, so unlike passwords they need no slow hash,
+// and a deterministic one lets storage find the session by an index. The key
+// keeps a leaked sessions table from being usable to check guessed tokens.
+func (s *authService) hashRefreshToken(refreshToken []byte) string {
+	mac := hmac.New(sha256.New, s.refreshTokenKey)
+	mac.Write(refreshToken)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// sendWebhook queues the payload for delivery within the trace of ctx, but
+// not cancelled with it: the notification should go out even if the client
+// has gone away.
+func (s *authService) sendWebhook(ctx context.Context, payload map[string]string) {
+	const op = "service.auth.sendWebhook"
 
-	payload := map[string]string{
-		"user_id": userID,
-		"old_ip":  oldIP,
-		"new_ip":  newIP,
-		"message": "A token refresh attempt was made from a new IP address.",
-	}
 	payloadBytes, err := json.Marshal(payload)
 	if err != nil {
 		s.log.Error("failed to marshal webhook payload", slog.String("op", op), "error", err)
 		return
 	}
 
-	resp, err := http.Post(s.webhookURL, "application/json", bytes.NewBuffer(payloadBytes))
+	event := payload["event"]
+	err = s.webhooks.Enqueue(context.WithoutCancel(ctx), payloadBytes, func(err error) {
+		s.metrics.ObserveWebhook(event, err == nil)
+	})
 	if err != nil {
-		s.log.Error("failed to send webhook", slog.String("op", op), "error", err)
-		return
+		s.log.Error("failed to queue webhook", slog.String("op", op), "event", event, "error", err)
+		s.metrics.ObserveWebhook(event, false)
 	}
-	defer resp.Body.Close()
+}
+
+func (s *authService) Logout(ctx context.Context, userID, sessionID uuid.UUID) error {
+	const op = "service.auth.Logout"
 
-	if resp.StatusCode != http.StatusOK {
-		s.log.Error("webhook returned non-200 status", slog.String("op", op), "status", resp.Status)
+	ctx, span := tracer.Start(ctx, op, trace.WithAttributes(attribute.String("user.id", userID.String())))
+	defer span.End()
+
+	if err := s.RevokeSession(ctx, userID, sessionID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
 	}
+
+	return nil
 }
 
-func (s *authService) Logout(ctx context.Context, userID uuid.UUID) error {
-	const op = "service.auth.Logout"
+func (s *authService) LogoutAll(ctx context.Context, userID uuid.UUID) error {
+	const op = "service.auth.LogoutAll"
 
-	if err := s.storage.DeleteSession(ctx, userID); err != nil {
+	ctx, span := tracer.Start(ctx, op, trace.WithAttributes(attribute.String("user.id", userID.String())))
+	defer span.End()
+
+	if err := s.storage.DeleteUserSessions(ctx, userID); err != nil {
 		return fmt.Errorf("%s: %w", op, err)
 	}
 
+	s.auditor.Record(ctx, domain.AuditLogout, userID, "", map[string]string{"scope": "all"})
+
+	return nil
+}
+
+// ListSessions returns the user's sessions that have not expired yet, most
+// recently used first.
+func (s *authService) ListSessions(ctx context.Context, userID uuid.UUID) ([]domain.Session, error) {
+	const op = "service.auth.ListSessions"
+
+	ctx, span := tracer.Start(ctx, op, trace.WithAttributes(attribute.String("user.id", userID.String())))
+	defer span.End()
+
+	sessions, err := s.storage.ListUserSessions(ctx, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	now := time.Now()
+	active := sessions[:0]
+	for _, session := range sessions {
+		if now.Before(session.ExpiresAt) {
+			active = append(active, session)
+		}
+	}
+
+	return active, nil
+}
+
+// RevokeSession deletes one of the user's sessions. Sessions of other users
+// are reported as not found.
+func (s *authService) RevokeSession(ctx context.Context, userID, sessionID uuid.UUID) error {
+	const op = "service.auth.RevokeSession"
+
+	ctx, span := tracer.Start(ctx, op, trace.WithAttributes(attribute.String("user.id", userID.String())))
+	defer span.End()
+
+	session, err := s.storage.GetSession(ctx, sessionID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if session.UserID != userID {
+		return fmt.Errorf("%s: %w", op, domain.ErrSessionNotFound)
+	}
+
+	if err := s.storage.DeleteSession(ctx, sessionID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	s.auditor.Record(ctx, domain.AuditLogout, userID, "", map[string]string{
+		"session_id": sessionID.String(),
+	})
+
 	return nil
 }
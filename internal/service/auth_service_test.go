@@ -0,0 +1,329 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log/slog"
+	"net/netip"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"test2auth/domain"
+
+	"github.com/google/uuid"
+)
+
+const testUserAgent = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36"
+
+var testIP = netip.MustParseAddr("203.0.113.7")
+
+// fakeStorage keeps sessions in a map. Like the database, it assigns IDs, sets
+// CreatedAt when a session is saved and rotates only the current token.
+type fakeStorage struct {
+	mu       sync.Mutex
+	sessions map[uuid.UUID]domain.Session
+	// beforeRotate runs once at the start of the next RotateSession, to
+	// interleave a concurrent request.
+	beforeRotate func()
+}
+
+func newFakeStorage() *fakeStorage {
+	return &fakeStorage{sessions: make(map[uuid.UUID]domain.Session)}
+}
+
+func (f *fakeStorage) SaveSession(_ context.Context, session domain.Session, limit domain.SessionLimit) (uuid.UUID, []domain.Session, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var evicted []domain.Session
+	if !limit.IsZero() {
+		var active []domain.Session
+		for _, s := range f.sessions {
+			if s.UserID == session.UserID {
+				active = append(active, s)
+			}
+		}
+
+		var err error
+		evicted, err = limit.Admit(active, session, session.LastUsedAt)
+		if err != nil {
+			return uuid.Nil, nil, err
+		}
+		for _, s := range evicted {
+			delete(f.sessions, s.ID)
+		}
+	}
+
+	session.ID = uuid.New()
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = time.Now()
+	}
+	f.sessions[session.ID] = session
+	return session.ID, evicted, nil
+}
+
+func (f *fakeStorage) GetSession(_ context.Context, id uuid.UUID) (domain.Session, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	session, ok := f.sessions[id]
+	if !ok {
+		return domain.Session{}, domain.ErrSessionNotFound
+	}
+	return session, nil
+}
+
+func (f *fakeStorage) GetSessionByRefreshToken(_ context.Context, tokenHash string) (domain.Session, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, session := range f.sessions {
+		if session.RefreshTokenHash == tokenHash || session.PrevRefreshTokenHash == tokenHash {
+			return session, nil
+		}
+	}
+	return domain.Session{}, domain.ErrSessionNotFound
+}
+
+func (f *fakeStorage) ListUserSessions(_ context.Context, userID uuid.UUID) ([]domain.Session, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	var sessions []domain.Session
+	for _, session := range f.sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, session)
+		}
+	}
+	slices.SortFunc(sessions, func(a, b domain.Session) int {
+		return b.LastUsedAt.Compare(a.LastUsedAt)
+	})
+	return sessions, nil
+}
+
+func (f *fakeStorage) RotateSession(_ context.Context, session domain.Session, prevHash string) error {
+	f.mu.Lock()
+	beforeRotate := f.beforeRotate
+	f.beforeRotate = nil
+	f.mu.Unlock()
+
+	if beforeRotate != nil {
+		beforeRotate()
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	current, ok := f.sessions[session.ID]
+	if !ok {
+		return domain.ErrSessionNotFound
+	}
+	if current.RefreshTokenHash != prevHash {
+		return domain.ErrRefreshConflict
+	}
+	f.sessions[session.ID] = session
+	return nil
+}
+
+func (f *fakeStorage) DeleteSession(_ context.Context, id uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	delete(f.sessions, id)
+	return nil
+}
+
+func (f *fakeStorage) DeleteUserSessions(_ context.Context, userID uuid.UUID) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for id, session := range f.sessions {
+		if session.UserID == userID {
+			delete(f.sessions, id)
+		}
+	}
+	return nil
+}
+
+// put stores session as it is, bypassing the checks of the service.
+func (f *fakeStorage) put(session domain.Session) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	f.sessions[session.ID] = session
+}
+
+func (f *fakeStorage) len() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	return len(f.sessions)
+}
+
+// newTestService returns a service on a fake storage. Webhooks go to a closed
+// port and fail without effect.
+func newTestService(t *testing.T, opts ...Option) (*authService, *fakeStorage) {
+	t.Helper()
+
+	storage := newFakeStorage()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := NewAuthService(storage, log, "test-secret", "http://127.0.0.1:0", time.Minute, time.Hour, opts...).(*authService)
+	return s, storage
+}
+
+func TestRefreshTokensRotates(t *testing.T) {
+	ctx := context.Background()
+	s, storage := newTestService(t)
+	userID := uuid.New()
+
+	accessToken, refreshToken, err := s.CreateTokens(ctx, userID, testUserAgent, testIP)
+	if err != nil {
+		t.Fatalf("CreateTokens: %v", err)
+	}
+
+	newAccessToken, newRefreshToken, err := s.RefreshTokens(ctx, accessToken, refreshToken, testUserAgent, testIP)
+	if err != nil {
+		t.Fatalf("RefreshTokens: %v", err)
+	}
+	if newRefreshToken == refreshToken {
+		t.Error("refresh token was not rotated")
+	}
+
+	// The old refresh token is spent.
+	_, _, err = s.RefreshTokens(ctx, newAccessToken, refreshToken, testUserAgent, testIP)
+	if !errors.Is(err, domain.ErrInvalidRefreshToken) {
+		t.Errorf("refresh with the old token: %v, want %v", err, domain.ErrInvalidRefreshToken)
+	}
+	if n := storage.len(); n != 0 {
+		t.Errorf("%d sessions left after a reused token, want 0", n)
+	}
+}
+
+func TestRefreshWithoutAccessToken(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService(t)
+
+	_, refreshToken, err := s.CreateTokens(ctx, uuid.New(), testUserAgent, testIP)
+	if err != nil {
+		t.Fatalf("CreateTokens: %v", err)
+	}
+	_, refreshToken, err = s.RefreshTokens(ctx, "", refreshToken, testUserAgent, testIP)
+	if err != nil {
+		t.Fatalf("RefreshTokens without an access token: %v", err)
+	}
+
+	// The access token of another session does not match the refresh token.
+	otherAccessToken, _, err := s.CreateTokens(ctx, uuid.New(), testUserAgent, testIP)
+	if err != nil {
+		t.Fatalf("CreateTokens: %v", err)
+	}
+	_, _, err = s.RefreshTokens(ctx, otherAccessToken, refreshToken, testUserAgent, testIP)
+	if !errors.Is(err, domain.ErrInvalidRefreshToken) {
+		t.Errorf("refresh with the access token of another session: %v, want %v", err, domain.ErrInvalidRefreshToken)
+	}
+
+	strict, _ := newTestService(t, WithAccessTokenBinding(true))
+	_, refreshToken, err = strict.CreateTokens(ctx, uuid.New(), testUserAgent, testIP)
+	if err != nil {
+		t.Fatalf("CreateTokens: %v", err)
+	}
+	_, _, err = strict.RefreshTokens(ctx, "", refreshToken, testUserAgent, testIP)
+	if !errors.Is(err, domain.ErrInvalidAccessToken) {
+		t.Errorf("refresh without an access token under binding: %v, want %v", err, domain.ErrInvalidAccessToken)
+	}
+}
+
+func TestListSessions(t *testing.T) {
+	ctx := context.Background()
+	s, storage := newTestService(t)
+	userID := uuid.New()
+
+	for range 2 {
+		if _, _, err := s.CreateTokens(ctx, userID, testUserAgent, testIP); err != nil {
+			t.Fatalf("CreateTokens: %v", err)
+		}
+	}
+	if _, _, err := s.CreateTokens(ctx, uuid.New(), testUserAgent, testIP); err != nil {
+		t.Fatalf("CreateTokens: %v", err)
+	}
+	expired := domain.Session{UserID: userID, ExpiresAt: time.Now().Add(-time.Minute)}
+	if _, _, err := storage.SaveSession(ctx, expired, domain.SessionLimit{}); err != nil {
+		t.Fatalf("SaveSession: %v", err)
+	}
+
+	sessions, err := s.ListSessions(ctx, userID)
+	if err != nil {
+		t.Fatalf("ListSessions: %v", err)
+	}
+	if len(sessions) != 2 {
+		t.Fatalf("ListSessions returned %d sessions, want the 2 active ones of the user", len(sessions))
+	}
+	if sessions[0].LastUsedAt.Before(sessions[1].LastUsedAt) {
+		t.Error("sessions are not sorted by last use, most recent first")
+	}
+}
+
+func TestRevokeSession(t *testing.T) {
+	ctx := context.Background()
+	s, _ := newTestService(t)
+	userID := uuid.New()
+
+	accessToken, refreshToken, err := s.CreateTokens(ctx, userID, testUserAgent, testIP)
+	if err != nil {
+		t.Fatalf("CreateTokens: %v", err)
+	}
+	otherAccessToken, otherRefreshToken, err := s.CreateTokens(ctx, userID, testUserAgent, testIP)
+	if err != nil {
+		t.Fatalf("CreateTokens: %v", err)
+	}
+	sessions, err := s.ListSessions(ctx, userID)
+	if err != nil || len(sessions) != 2 {
+		t.Fatalf("ListSessions = %v, %v, want 2 sessions", sessions, err)
+	}
+	claims, err := s.parseAccessToken(accessToken)
+	if err != nil {
+		t.Fatalf("parseAccessToken: %v", err)
+	}
+	sessionID, err := sessionIDFromClaims(claims)
+	if err != nil {
+		t.Fatalf("sessionIDFromClaims: %v", err)
+	}
+
+	if err := s.RevokeSession(ctx, uuid.New(), sessionID); !errors.Is(err, domain.ErrSessionNotFound) {
+		t.Errorf("revoking a session of another user: %v, want %v", err, domain.ErrSessionNotFound)
+	}
+	if err := s.RevokeSession(ctx, userID, sessionID); err != nil {
+		t.Fatalf("RevokeSession: %v", err)
+	}
+
+	_, _, err = s.RefreshTokens(ctx, accessToken, refreshToken, testUserAgent, testIP)
+	if !errors.Is(err, domain.ErrInvalidRefreshToken) {
+		t.Errorf("refresh of the revoked session: %v, want %v", err, domain.ErrInvalidRefreshToken)
+	}
+	// The other device is not affected.
+	if _, _, err := s.RefreshTokens(ctx, otherAccessToken, otherRefreshToken, testUserAgent, testIP); err != nil {
+		t.Errorf("refresh of the other session: %v", err)
+	}
+}
+
+func TestLogoutAll(t *testing.T) {
+	ctx := context.Background()
+	s, storage := newTestService(t)
+	userID := uuid.New()
+
+	for _, id := range []uuid.UUID{userID, userID, uuid.New()} {
+		if _, _, err := s.CreateTokens(ctx, id, testUserAgent, testIP); err != nil {
+			t.Fatalf("CreateTokens: %v", err)
+		}
+	}
+
+	if err := s.LogoutAll(ctx, userID); err != nil {
+		t.Fatalf("LogoutAll: %v", err)
+	}
+	if n := storage.len(); n != 1 {
+		t.Errorf("%d sessions left, want only the one of the other user", n)
+	}
+}
@@ -0,0 +1,24 @@
+package service
+
+import (
+	"net/netip"
+	"test2auth/domain"
+	"test2auth/internal/geoip"
+)
+
+type GeoLocator interface {
+	Lookup(ip netip.Addr) domain.Location
+}
+
+type noopLocator struct{}
+
+func (noopLocator) Lookup(netip.Addr) domain.Location { return domain.Location{} }
+
+// WithGeoIP stores the location of the client on the session and detects
+// ASN, country and impossible travel changes on refresh.
+func WithGeoIP(locator GeoLocator, travel geoip.TravelCheck) Option {
+	return func(s *authService) {
+		s.geo = locator
+		s.travel = travel
+	}
+}
@@ -0,0 +1,70 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+
+	"test2auth/domain"
+	"test2auth/internal/geoip"
+	"test2auth/internal/policy"
+
+	"github.com/google/uuid"
+)
+
+type fakeLocator map[netip.Addr]domain.Location
+
+func (f fakeLocator) Lookup(ip netip.Addr) domain.Location { return f[ip] }
+
+func TestImpossibleTravel(t *testing.T) {
+	berlin := netip.MustParseAddr("198.51.100.1")
+	potsdam := netip.MustParseAddr("198.51.100.2")
+	sydney := netip.MustParseAddr("192.0.2.1")
+	locator := fakeLocator{
+		berlin:  {Country: "DE", City: "Berlin", Latitude: 52.52, Longitude: 13.405},
+		potsdam: {Country: "DE", City: "Potsdam", Latitude: 52.39, Longitude: 13.065},
+		sydney:  {Country: "AU", City: "Sydney", Latitude: -33.87, Longitude: 151.21},
+	}
+	engine := policy.NewEngine(map[policy.Signal]policy.Action{
+		policy.SignalImpossibleTravel: policy.ActionDeny,
+	}, 0)
+
+	tests := []struct {
+		name    string
+		ip      netip.Addr
+		wantErr error
+	}{
+		{name: "same place", ip: berlin},
+		{name: "short distance", ip: potsdam},
+		{name: "other continent right away", ip: sydney, wantErr: domain.ErrRefreshDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s, storage := newTestService(t,
+				WithPolicy(engine),
+				WithGeoIP(locator, geoip.TravelCheck{MaxSpeedKmh: 1000, MinDistanceKm: 100}),
+			)
+			userID := uuid.New()
+
+			accessToken, refreshToken, err := s.CreateTokens(ctx, userID, testUserAgent, berlin)
+			if err != nil {
+				t.Fatalf("CreateTokens: %v", err)
+			}
+			sessions, err := storage.ListUserSessions(ctx, userID)
+			if err != nil || len(sessions) != 1 {
+				t.Fatalf("ListUserSessions = %v, %v, want one session", sessions, err)
+			}
+			if sessions[0].Location.City != "Berlin" {
+				t.Errorf("session location = %+v, want Berlin", sessions[0].Location)
+			}
+
+			_, _, err = s.RefreshTokens(ctx, accessToken, refreshToken, testUserAgent, tt.ip)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("RefreshTokens: %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
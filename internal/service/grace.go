@@ -0,0 +1,118 @@
+package service
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"net/netip"
+	"test2auth/domain"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// WithRefreshGracePeriod lets the refresh token that was just rotated away
+// fetch the same new pair again for the given period, so that two tabs
+// refreshing at once both end up with working tokens instead of one of them
+// tripping token reuse detection. Zero disables it.
+func WithRefreshGracePeriod(period time.Duration) Option {
+	return func(s *authService) {
+		s.gracePeriod = period
+	}
+}
+
+type graceTokens struct {
+	AccessToken  string `json:"a"`
+	RefreshToken string `json:"r"`
+}
+
+// replayRotation returns the pair issued by the last rotation of session if
+// tokenHash is the hash of the token it replaced and the request comes from
+// the same client within the grace period.
+func (s *authService) replayRotation(session domain.Session, tokenHash string, userAgent string, ip netip.Addr) (string, string, bool) {
+	if s.gracePeriod <= 0 || session.GraceTokens == "" || session.PrevRefreshTokenHash != tokenHash {
+		return "", "", false
+	}
+	if time.Now().After(session.GraceUntil) {
+		return "", "", false
+	}
+	if session.IP != ip || !s.uaMatch.Matches(session.UserAgent, userAgent) {
+		return "", "", false
+	}
+	tokens, err := s.openGraceTokens(session.ID, session.GraceTokens)
+	if err != nil {
+		s.log.Error("failed to open grace tokens", "error", err)
+		return "", "", false
+	}
+
+	return tokens.AccessToken, tokens.RefreshToken, true
+}
+
+// sealGraceTokens encrypts the new pair for storage in the session. The
+// session ID is authenticated as well, so a sealed pair cannot be moved to
+// another session.
+func (s *authService) sealGraceTokens(sessionID uuid.UUID, tokens graceTokens) (string, error) {
+	aead, err := s.graceCipher()
+	if err != nil {
+		return "", err
+	}
+
+	plaintext, err := json.Marshal(tokens)
+	if err != nil {
+		return "", err
+	}
+
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+
+	sealed := aead.Seal(nonce, nonce, plaintext, []byte(sessionID.String()))
+	return base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func (s *authService) openGraceTokens(sessionID uuid.UUID, sealed string) (graceTokens, error) {
+	aead, err := s.graceCipher()
+	if err != nil {
+		return graceTokens{}, err
+	}
+
+	data, err := base64.StdEncoding.DecodeString(sealed)
+	if err != nil {
+		return graceTokens{}, err
+	}
+	if len(data) < aead.NonceSize() {
+		return graceTokens{}, errors.New("sealed grace tokens too short")
+	}
+
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, []byte(sessionID.String()))
+	if err != nil {
+		return graceTokens{}, err
+	}
+
+	var tokens graceTokens
+	if err := json.Unmarshal(plaintext, &tokens); err != nil {
+		return graceTokens{}, err
+	}
+	return tokens, nil
+}
+
+// graceCipher derives its key from the refresh token key, so that the JWT
+// secret alone does not open the refresh tokens kept in sessions. Changing
+// the key invalidates refresh tokens anyway.
+func (s *authService) graceCipher() (cipher.AEAD, error) {
+	mac := hmac.New(sha256.New, s.refreshTokenKey)
+	mac.Write([]byte("refresh grace tokens"))
+
+	block, err := aes.NewCipher(mac.Sum(nil))
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
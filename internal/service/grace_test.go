@@ -0,0 +1,130 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"net/netip"
+	"testing"
+	"time"
+
+	"test2auth/domain"
+
+	"github.com/google/uuid"
+)
+
+// TestRotationConflict interleaves a second refresh with the same token
+// between reading and rotating the session. Only one of them may rotate it;
+// the other gets the winner's pair within the grace period and fails without
+// one.
+func TestRotationConflict(t *testing.T) {
+	tests := []struct {
+		name        string
+		gracePeriod time.Duration
+		wantErr     error
+	}{
+		{name: "without grace period", wantErr: domain.ErrRefreshConflict},
+		{name: "within grace period", gracePeriod: time.Minute},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s, storage := newTestService(t, WithRefreshGracePeriod(tt.gracePeriod))
+
+			accessToken, refreshToken, err := s.CreateTokens(ctx, uuid.New(), testUserAgent, testIP)
+			if err != nil {
+				t.Fatalf("CreateTokens: %v", err)
+			}
+
+			var winnerAccessToken, winnerRefreshToken string
+			storage.beforeRotate = func() {
+				var err error
+				winnerAccessToken, winnerRefreshToken, err = s.RefreshTokens(ctx, accessToken, refreshToken, testUserAgent, testIP)
+				if err != nil {
+					t.Errorf("concurrent RefreshTokens: %v", err)
+				}
+			}
+
+			gotAccessToken, gotRefreshToken, err := s.RefreshTokens(ctx, accessToken, refreshToken, testUserAgent, testIP)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("RefreshTokens: %v, want %v", err, tt.wantErr)
+			}
+			if err == nil && (gotAccessToken != winnerAccessToken || gotRefreshToken != winnerRefreshToken) {
+				t.Error("the request that lost the race got another pair than the winner")
+			}
+
+			// The winner's pair is valid either way.
+			if _, _, err := s.RefreshTokens(ctx, winnerAccessToken, winnerRefreshToken, testUserAgent, testIP); err != nil {
+				t.Errorf("refresh with the winner's pair: %v", err)
+			}
+		})
+	}
+}
+
+// TestGraceReplay presents the previous refresh token again after a
+// rotation. Only the same client within the grace period gets the new pair
+// again, anything else is token reuse and ends the session.
+func TestGraceReplay(t *testing.T) {
+	const otherUserAgent = "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0"
+	otherIP := netip.MustParseAddr("198.51.100.1")
+
+	tests := []struct {
+		name        string
+		gracePeriod time.Duration
+		expired     bool
+		userAgent   string
+		ip          netip.Addr
+		wantReplay  bool
+	}{
+		{name: "same client", gracePeriod: time.Minute, userAgent: testUserAgent, ip: testIP, wantReplay: true},
+		{name: "grace period disabled", userAgent: testUserAgent, ip: testIP},
+		{name: "grace period over", gracePeriod: time.Minute, expired: true, userAgent: testUserAgent, ip: testIP},
+		{name: "other IP", gracePeriod: time.Minute, userAgent: testUserAgent, ip: otherIP},
+		{name: "other user agent", gracePeriod: time.Minute, userAgent: otherUserAgent, ip: testIP},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s, storage := newTestService(t, WithRefreshGracePeriod(tt.gracePeriod))
+			userID := uuid.New()
+
+			accessToken, refreshToken, err := s.CreateTokens(ctx, userID, testUserAgent, testIP)
+			if err != nil {
+				t.Fatalf("CreateTokens: %v", err)
+			}
+			newAccessToken, newRefreshToken, err := s.RefreshTokens(ctx, accessToken, refreshToken, testUserAgent, testIP)
+			if err != nil {
+				t.Fatalf("RefreshTokens: %v", err)
+			}
+
+			if tt.expired {
+				sessions, _ := storage.ListUserSessions(ctx, userID)
+				session := sessions[0]
+				session.GraceUntil = time.Now().Add(-time.Second)
+				storage.put(session)
+			}
+
+			gotAccessToken, gotRefreshToken, err := s.RefreshTokens(ctx, accessToken, refreshToken, tt.userAgent, tt.ip)
+			if !tt.wantReplay {
+				if !errors.Is(err, domain.ErrInvalidRefreshToken) {
+					t.Errorf("replay: %v, want %v", err, domain.ErrInvalidRefreshToken)
+				}
+				if n := storage.len(); n != 0 {
+					t.Errorf("%d sessions left after token reuse, want 0", n)
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatalf("replay: %v", err)
+			}
+			if gotAccessToken != newAccessToken || gotRefreshToken != newRefreshToken {
+				t.Error("replay returned another pair than the rotation")
+			}
+			if n := storage.len(); n != 1 {
+				t.Errorf("%d sessions left after the replay, want 1", n)
+			}
+		})
+	}
+}
@@ -0,0 +1,45 @@
+package service
+
+import (
+	"test2auth/domain"
+	"time"
+)
+
+// WithSessionLifetime limits how long a session lives. idleTimeout ends a
+// session that has not been refreshed for that long, maxLifetime ends it that
+// long after the first login no matter how often it is refreshed. Zero
+// disables the respective limit.
+func WithSessionLifetime(idleTimeout, maxLifetime time.Duration) Option {
+	return func(s *authService) {
+		s.idleTimeout = idleTimeout
+		s.maxLifetime = maxLifetime
+	}
+}
+
+// checkLifetime reports why the session can no longer be refreshed, if it
+// cannot. The absolute lifetime is checked first since it cannot be extended.
+func (s *authService) checkLifetime(session domain.Session, now time.Time) (string, error) {
+	if s.maxLifetime > 0 && !session.CreatedAt.IsZero() && now.After(session.CreatedAt.Add(s.maxLifetime)) {
+		return "max_lifetime", domain.ErrSessionLifetimeExceeded
+	}
+	if s.idleTimeout > 0 && !session.LastUsedAt.IsZero() && now.After(session.LastUsedAt.Add(s.idleTimeout)) {
+		return "idle_timeout", domain.ErrSessionIdleTimeout
+	}
+	if now.After(session.ExpiresAt) {
+		return "expired", domain.ErrSessionExpired
+	}
+	return "", nil
+}
+
+// expiresAt is the earliest moment any of the limits ends a session that was
+// created at createdAt and last used at now.
+func (s *authService) expiresAt(createdAt, now time.Time) time.Time {
+	expiresAt := now.Add(s.refreshTTL)
+	if s.idleTimeout > 0 && now.Add(s.idleTimeout).Before(expiresAt) {
+		expiresAt = now.Add(s.idleTimeout)
+	}
+	if s.maxLifetime > 0 && createdAt.Add(s.maxLifetime).Before(expiresAt) {
+		expiresAt = createdAt.Add(s.maxLifetime)
+	}
+	return expiresAt
+}
@@ -0,0 +1,123 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"test2auth/domain"
+
+	"github.com/google/uuid"
+)
+
+func TestCheckLifetime(t *testing.T) {
+	s, _ := newTestService(t, WithSessionLifetime(time.Hour, 24*time.Hour))
+	now := time.Now()
+
+	tests := []struct {
+		name       string
+		createdAt  time.Time
+		lastUsedAt time.Time
+		expiresAt  time.Time
+		wantReason string
+		wantErr    error
+	}{
+		{
+			name:       "active",
+			createdAt:  now.Add(-time.Hour),
+			lastUsedAt: now.Add(-time.Minute),
+			expiresAt:  now.Add(time.Minute),
+		},
+		{
+			name:       "expired",
+			createdAt:  now.Add(-time.Hour),
+			lastUsedAt: now.Add(-time.Minute),
+			expiresAt:  now.Add(-time.Second),
+			wantReason: "expired",
+			wantErr:    domain.ErrSessionExpired,
+		},
+		{
+			name:       "idle timeout before expiry",
+			createdAt:  now.Add(-3 * time.Hour),
+			lastUsedAt: now.Add(-2 * time.Hour),
+			expiresAt:  now.Add(-time.Second),
+			wantReason: "idle_timeout",
+			wantErr:    domain.ErrSessionIdleTimeout,
+		},
+		{
+			name:       "max lifetime before idle timeout",
+			createdAt:  now.Add(-25 * time.Hour),
+			lastUsedAt: now.Add(-2 * time.Hour),
+			expiresAt:  now.Add(-time.Second),
+			wantReason: "max_lifetime",
+			wantErr:    domain.ErrSessionLifetimeExceeded,
+		},
+		{
+			name:       "max lifetime of a session in use",
+			createdAt:  now.Add(-25 * time.Hour),
+			lastUsedAt: now.Add(-time.Minute),
+			expiresAt:  now.Add(time.Minute),
+			wantReason: "max_lifetime",
+			wantErr:    domain.ErrSessionLifetimeExceeded,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			session := domain.Session{CreatedAt: tt.createdAt, LastUsedAt: tt.lastUsedAt, ExpiresAt: tt.expiresAt}
+			reason, err := s.checkLifetime(session, now)
+			if reason != tt.wantReason || !errors.Is(err, tt.wantErr) {
+				t.Errorf("checkLifetime = %q, %v, want %q, %v", reason, err, tt.wantReason, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestExpiresAt(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name        string
+		idleTimeout time.Duration
+		maxLifetime time.Duration
+		createdAt   time.Time
+		want        time.Time
+	}{
+		{name: "refresh TTL", createdAt: now, want: now.Add(time.Hour)},
+		{name: "idle timeout", idleTimeout: time.Minute, createdAt: now, want: now.Add(time.Minute)},
+		{name: "max lifetime", maxLifetime: 2 * time.Hour, createdAt: now.Add(-90 * time.Minute), want: now.Add(30 * time.Minute)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s, _ := newTestService(t, WithSessionLifetime(tt.idleTimeout, tt.maxLifetime))
+			if got := s.expiresAt(tt.createdAt, now); !got.Equal(tt.want) {
+				t.Errorf("expiresAt = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRefreshAfterIdleTimeout(t *testing.T) {
+	ctx := context.Background()
+	s, storage := newTestService(t, WithSessionLifetime(time.Hour, 0))
+	userID := uuid.New()
+
+	accessToken, refreshToken, err := s.CreateTokens(ctx, userID, testUserAgent, testIP)
+	if err != nil {
+		t.Fatalf("CreateTokens: %v", err)
+	}
+	sessions, _ := storage.ListUserSessions(ctx, userID)
+	session := sessions[0]
+	session.LastUsedAt = session.LastUsedAt.Add(-2 * time.Hour)
+	storage.put(session)
+
+	_, _, err = s.RefreshTokens(ctx, accessToken, refreshToken, testUserAgent, testIP)
+	if !errors.Is(err, domain.ErrSessionIdleTimeout) {
+		t.Errorf("RefreshTokens: %v, want %v", err, domain.ErrSessionIdleTimeout)
+	}
+	if n := storage.len(); n != 0 {
+		t.Errorf("%d sessions left, want the idle one deleted", n)
+	}
+}
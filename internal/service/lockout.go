@@ -0,0 +1,106 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+	"test2auth/domain"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type LockoutGuard interface {
+	LockedUntil(ctx context.Context, key string) (time.Time, error)
+	RegisterFailure(ctx context.Context, key string) (lockedUntil time.Time, err error)
+	Reset(ctx context.Context, key string) error
+}
+
+type noopLockout struct{}
+
+func (noopLockout) LockedUntil(context.Context, string) (time.Time, error) { return time.Time{}, nil }
+
+func (noopLockout) RegisterFailure(context.Context, string) (time.Time, error) {
+	return time.Time{}, nil
+}
+
+func (noopLockout) Reset(context.Context, string) error { return nil }
+
+// WithLockout temporarily locks out users and IP addresses after repeated
+// failed refresh attempts.
+func WithLockout(guard LockoutGuard) Option {
+	return func(s *authService) {
+		s.lockout = guard
+	}
+}
+
+func userLockoutKey(userID uuid.UUID) string {
+	return "user:" + userID.String()
+}
+
+func ipLockoutKey(ip netip.Addr) string {
+	return "ip:" + ip.String()
+}
+
+// checkLockout fails open: if the lockout store is unavailable the request
+// goes on and the error is only logged.
+func (s *authService) checkLockout(ctx context.Context, key string, byIP bool) error {
+	const op = "service.auth.checkLockout"
+
+	until, err := s.lockout.LockedUntil(ctx, key)
+	if err != nil {
+		s.log.Error("failed to check lockout", slog.String("op", op), "error", err)
+		return nil
+	}
+
+	if !until.IsZero() {
+		return &domain.LockoutError{Until: until, ByIP: byIP}
+	}
+
+	return nil
+}
+
+// registerFailure counts a failed refresh for the client address and, if it
+// is known, for the user. A lockout triggered by the failure is audited and
+// reported via webhook.
+func (s *authService) registerFailure(ctx context.Context, userID uuid.UUID, ip netip.Addr) {
+	const op = "service.auth.registerFailure"
+
+	keys := []string{ipLockoutKey(ip)}
+	if userID != uuid.Nil {
+		keys = append(keys, userLockoutKey(userID))
+	}
+
+	for _, key := range keys {
+		until, err := s.lockout.RegisterFailure(ctx, key)
+		if err != nil {
+			s.log.Error("failed to register failed attempt", slog.String("op", op), "error", err)
+			continue
+		}
+		if until.IsZero() {
+			continue
+		}
+
+		s.log.Warn("lockout triggered", slog.String("key", key), slog.Time("until", until))
+		s.auditor.Record(ctx, domain.AuditLockout, userID, ip.String(), map[string]string{
+			"key":          key,
+			"locked_until": until.UTC().Format(time.RFC3339),
+		})
+		s.sendWebhook(ctx, map[string]string{
+			"event":        "lockout",
+			"user_id":      userID.String(),
+			"ip":           ip.String(),
+			"key":          key,
+			"locked_until": until.UTC().Format(time.RFC3339),
+			"message":      "Too many failed token refresh attempts.",
+		})
+	}
+}
+
+func (s *authService) resetFailures(ctx context.Context, userID uuid.UUID) {
+	const op = "service.auth.resetFailures"
+
+	if err := s.lockout.Reset(ctx, userLockoutKey(userID)); err != nil {
+		s.log.Error("failed to reset failed attempts", slog.String("op", op), "error", err)
+	}
+}
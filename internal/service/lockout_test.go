@@ -0,0 +1,109 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"test2auth/domain"
+
+	"github.com/google/uuid"
+)
+
+// fakeLockout locks a key once it has failed limit times. If err is set,
+// every call fails with it.
+type fakeLockout struct {
+	mu       sync.Mutex
+	limit    int
+	failures map[string]int
+	err      error
+}
+
+func newFakeLockout(limit int) *fakeLockout {
+	return &fakeLockout{limit: limit, failures: make(map[string]int)}
+}
+
+func (f *fakeLockout) LockedUntil(_ context.Context, key string) (time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err != nil {
+		return time.Time{}, f.err
+	}
+	if f.failures[key] >= f.limit {
+		return time.Now().Add(time.Minute), nil
+	}
+	return time.Time{}, nil
+}
+
+func (f *fakeLockout) RegisterFailure(_ context.Context, key string) (time.Time, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err != nil {
+		return time.Time{}, f.err
+	}
+	f.failures[key]++
+	if f.failures[key] >= f.limit {
+		return time.Now().Add(time.Minute), nil
+	}
+	return time.Time{}, nil
+}
+
+func (f *fakeLockout) Reset(_ context.Context, key string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	if f.err != nil {
+		return f.err
+	}
+	delete(f.failures, key)
+	return nil
+}
+
+func TestLockoutAfterFailures(t *testing.T) {
+	ctx := context.Background()
+	guard := newFakeLockout(2)
+	s, _ := newTestService(t, WithLockout(guard))
+
+	for i := range 2 {
+		_, _, err := s.RefreshTokens(ctx, "", "not base64!", testUserAgent, testIP)
+		if !errors.Is(err, domain.ErrInvalidRefreshToken) {
+			t.Fatalf("attempt %d: %v, want %v", i+1, err, domain.ErrInvalidRefreshToken)
+		}
+	}
+
+	accessToken, refreshToken, err := s.CreateTokens(ctx, uuid.New(), testUserAgent, testIP)
+	if err != nil {
+		t.Fatalf("CreateTokens: %v", err)
+	}
+	_, _, err = s.RefreshTokens(ctx, accessToken, refreshToken, testUserAgent, testIP)
+	var lockout *domain.LockoutError
+	if !errors.As(err, &lockout) || !lockout.ByIP {
+		t.Errorf("refresh from a locked IP: %v, want an IP lockout", err)
+	}
+}
+
+// TestLockoutFailsOpen checks that an unavailable lockout store neither blocks
+// refreshes nor hides why one failed.
+func TestLockoutFailsOpen(t *testing.T) {
+	ctx := context.Background()
+	guard := newFakeLockout(1)
+	guard.err = errors.New("lockout store is down")
+	s, _ := newTestService(t, WithLockout(guard))
+
+	accessToken, refreshToken, err := s.CreateTokens(ctx, uuid.New(), testUserAgent, testIP)
+	if err != nil {
+		t.Fatalf("CreateTokens: %v", err)
+	}
+	if _, _, err := s.RefreshTokens(ctx, accessToken, refreshToken, testUserAgent, testIP); err != nil {
+		t.Errorf("RefreshTokens: %v, want it to fail open", err)
+	}
+
+	_, _, err = s.RefreshTokens(ctx, accessToken, "not base64!", testUserAgent, testIP)
+	if !errors.Is(err, domain.ErrInvalidRefreshToken) {
+		t.Errorf("refresh with a bad token: %v, want %v", err, domain.ErrInvalidRefreshToken)
+	}
+}
@@ -0,0 +1,85 @@
+package service
+
+import (
+	"errors"
+	"test2auth/domain"
+)
+
+// Reasons a refresh failed, as reported to Metrics.
+const (
+	RefreshFailedExpired    = "expired"
+	RefreshFailedInvalid    = "invalid"
+	RefreshFailedUAMismatch = "ua_mismatch"
+	RefreshFailedNotFound   = "not_found"
+	RefreshFailedReused     = "reused"
+	RefreshFailedLocked     = "locked"
+	RefreshFailedPolicy     = "policy"
+	RefreshFailedConflict   = "conflict"
+	RefreshFailedError      = "error"
+)
+
+type Metrics interface {
+	ObserveTokensIssued()
+	ObserveTokensRefreshed()
+	ObserveRefreshFailed(reason string)
+	// ObserveWebhook reports a webhook by its event, e.g. ip_mismatch.
+	ObserveWebhook(event string, delivered bool)
+}
+
+type noopMetrics struct{}
+
+func (noopMetrics) ObserveTokensIssued()        {}
+func (noopMetrics) ObserveTokensRefreshed()     {}
+func (noopMetrics) ObserveRefreshFailed(string) {}
+func (noopMetrics) ObserveWebhook(string, bool) {}
+
+// WithMetrics reports issued and refreshed tokens, refresh failures and sent
+// webhooks.
+func WithMetrics(metrics Metrics) Option {
+	return func(s *authService) {
+		s.metrics = metrics
+	}
+}
+
+// refreshFailure tags an error with a reason the error itself does not tell,
+// e.g. an unknown refresh token reads as an invalid one to the client. It
+// reads and matches like the wrapped error.
+type refreshFailure struct {
+	reason string
+	err    error
+}
+
+func (e *refreshFailure) Error() string {
+	return e.err.Error()
+}
+
+func (e *refreshFailure) Unwrap() error {
+	return e.err
+}
+
+// refreshFailureReason maps an error of RefreshTokens to its metrics reason.
+func refreshFailureReason(err error) string {
+	var failure *refreshFailure
+	switch {
+	case errors.As(err, &failure):
+		return failure.reason
+	case errors.Is(err, domain.ErrSessionExpired),
+		errors.Is(err, domain.ErrSessionIdleTimeout),
+		errors.Is(err, domain.ErrSessionLifetimeExceeded):
+		return RefreshFailedExpired
+	case errors.Is(err, domain.ErrInvalidRefreshToken),
+		errors.Is(err, domain.ErrInvalidAccessToken):
+		return RefreshFailedInvalid
+	case errors.Is(err, domain.ErrSessionNotFound):
+		return RefreshFailedNotFound
+	case errors.Is(err, domain.ErrAccountLocked):
+		return RefreshFailedLocked
+	case errors.Is(err, domain.ErrSessionRevoked),
+		errors.Is(err, domain.ErrRefreshDenied),
+		errors.Is(err, domain.ErrStepUpRequired):
+		return RefreshFailedPolicy
+	case errors.Is(err, domain.ErrRefreshConflict):
+		return RefreshFailedConflict
+	}
+	return RefreshFailedError
+}
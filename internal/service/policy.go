@@ -0,0 +1,150 @@
+package service
+
+import (
+	"context"
+	"log/slog"
+	"net/netip"
+	"strconv"
+	"test2auth/domain"
+	"test2auth/internal/geoip"
+	"test2auth/internal/policy"
+	"test2auth/internal/useragent"
+	"time"
+)
+
+type Policy interface {
+	Evaluate(obs policy.Observation) policy.Decision
+}
+
+// WithPolicy replaces the default reactions to a changed user agent, IP
+// address or an old token on refresh.
+func WithPolicy(p Policy) Option {
+	return func(s *authService) {
+		s.policy = p
+	}
+}
+
+// WithUserAgentMatch sets how much a user agent may change between refreshes
+// before it counts as a user agent change.
+func WithUserAgentMatch(strictness useragent.Strictness) Option {
+	return func(s *authService) {
+		s.uaMatch = strictness
+	}
+}
+
+// applyPolicy evaluates the refresh request against the stored session and
+// carries out the decision. It returns an error if the refresh must not go on.
+func (s *authService) applyPolicy(ctx context.Context, session domain.Session, userAgent string, ip netip.Addr) error {
+	const op = "service.auth.applyPolicy"
+
+	oldLoc := session.Location
+	newLoc := s.geo.Lookup(ip)
+	travel, impossible := s.travel.Impossible(oldLoc, newLoc, time.Since(session.LastUsedAt))
+
+	// The refresh token was issued by the last rotation, or at login if the
+	// session was never refreshed.
+	issuedAt := session.RotatedAt
+	if issuedAt.IsZero() {
+		issuedAt = session.CreatedAt
+	}
+
+	obs := policy.Observation{
+		UserAgentChanged: !s.uaMatch.Matches(session.UserAgent, userAgent),
+		IPChanged:        session.IP != ip,
+		ASNChanged:       oldLoc.ASN != 0 && newLoc.ASN != 0 && oldLoc.ASN != newLoc.ASN,
+		GeoChanged:       oldLoc.Country != "" && newLoc.Country != "" && oldLoc.Country != newLoc.Country,
+		ImpossibleTravel: impossible,
+		TokenAge:         time.Since(issuedAt),
+	}
+	obs.SubnetChanged = obs.IPChanged && !policy.SameSubnet(session.IP, ip)
+
+	decision := s.policy.Evaluate(obs)
+	if len(decision.Signals) == 0 {
+		return nil
+	}
+
+	userID := session.UserID
+	s.log.Warn("refresh anomaly detected",
+		slog.String("op", op),
+		slog.String("user_id", userID.String()),
+		slog.String("signals", decision.SignalNames()),
+		slog.String("action", string(decision.Action)),
+	)
+	details := map[string]string{
+		"action":         string(decision.Action),
+		"signals":        decision.SignalNames(),
+		"old_ip":         session.IP.String(),
+		"old_user_agent": session.UserAgent,
+		"new_user_agent": userAgent,
+	}
+	addLocationDetails(details, oldLoc, newLoc, travel)
+	s.auditor.Record(ctx, domain.AuditPolicyDecision, userID, ip.String(), details)
+
+	if decision.Notify {
+		s.sendAnomalyWebhook(ctx, session, decision, ip, newLoc, travel)
+	}
+
+	var err error
+	switch decision.Action {
+	case policy.ActionRevoke:
+		s.storage.DeleteSession(ctx, session.ID) // Deauthorize user
+		s.auditor.Record(ctx, domain.AuditSessionRevoked, userID, ip.String(), map[string]string{
+			"session_id": session.ID.String(),
+			"reason":     decision.SignalNames(),
+		})
+		err = domain.ErrSessionRevoked
+	case policy.ActionDeny:
+		err = domain.ErrRefreshDenied
+	case policy.ActionStepUp:
+		err = domain.ErrStepUpRequired
+	}
+
+	if err != nil && obs.UserAgentChanged {
+		return &refreshFailure{reason: RefreshFailedUAMismatch, err: err}
+	}
+	return err
+}
+
+func (s *authService) sendAnomalyWebhook(ctx context.Context, session domain.Session, decision policy.Decision, ip netip.Addr, newLoc domain.Location, travel geoip.Travel) {
+	payload := map[string]string{
+		"event":   "refresh_anomaly",
+		"user_id": session.UserID.String(),
+		"signals": decision.SignalNames(),
+		"action":  string(decision.Action),
+		"message": "A token refresh attempt was made from a changed environment.",
+	}
+
+	// Receivers of the original IP mismatch notification keep working.
+	if session.IP != ip {
+		payload["event"] = "ip_mismatch"
+		payload["old_ip"] = session.IP.String()
+		payload["new_ip"] = ip.String()
+		payload["message"] = "A token refresh attempt was made from a new IP address."
+	}
+	addLocationDetails(payload, session.Location, newLoc, travel)
+
+	s.sendWebhook(ctx, payload)
+}
+
+// addLocationDetails adds whatever GeoIP knows about both ends of a refresh.
+func addLocationDetails(details map[string]string, oldLoc, newLoc domain.Location, travel geoip.Travel) {
+	for prefix, loc := range map[string]domain.Location{"old_": oldLoc, "new_": newLoc} {
+		if loc.Country != "" {
+			details[prefix+"country"] = loc.Country
+		}
+		if loc.City != "" {
+			details[prefix+"city"] = loc.City
+		}
+		if loc.ASN != 0 {
+			details[prefix+"asn"] = strconv.FormatUint(uint64(loc.ASN), 10)
+			details[prefix+"as_org"] = loc.ASOrg
+		}
+	}
+
+	if travel.DistanceKm > 0 {
+		details["distance_km"] = strconv.FormatFloat(travel.DistanceKm, 'f', 0, 64)
+	}
+	if travel.SpeedKmh > 0 {
+		details["speed_kmh"] = strconv.FormatFloat(travel.SpeedKmh, 'f', 0, 64)
+	}
+}
@@ -0,0 +1,90 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"test2auth/domain"
+	"test2auth/internal/policy"
+	"test2auth/internal/useragent"
+
+	"github.com/google/uuid"
+)
+
+func TestUserAgentMatch(t *testing.T) {
+	const updatedUserAgent = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/127.0.6533.72 Safari/537.36"
+
+	tests := []struct {
+		name         string
+		strictness   useragent.Strictness
+		wantErr      error
+		wantSessions int
+	}{
+		{name: "exact revokes on a browser update", strictness: useragent.MatchExact, wantErr: domain.ErrSessionRevoked},
+		{name: "family and OS tolerate a browser update", strictness: useragent.MatchFamilyOS, wantSessions: 1},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s, storage := newTestService(t, WithUserAgentMatch(tt.strictness))
+
+			accessToken, refreshToken, err := s.CreateTokens(ctx, uuid.New(), testUserAgent, testIP)
+			if err != nil {
+				t.Fatalf("CreateTokens: %v", err)
+			}
+
+			_, _, err = s.RefreshTokens(ctx, accessToken, refreshToken, updatedUserAgent, testIP)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("RefreshTokens: %v, want %v", err, tt.wantErr)
+			}
+			if n := storage.len(); n != tt.wantSessions {
+				t.Errorf("%d sessions left, want %d", n, tt.wantSessions)
+			}
+		})
+	}
+}
+
+func TestTokenAgeCountsFromTheLastRotation(t *testing.T) {
+	now := time.Now()
+
+	tests := []struct {
+		name      string
+		createdAt time.Time
+		rotatedAt time.Time
+		wantErr   error
+	}{
+		{name: "never refreshed", createdAt: now.Add(-2 * time.Hour), wantErr: domain.ErrRefreshDenied},
+		{name: "refreshed recently", createdAt: now.Add(-2 * time.Hour), rotatedAt: now.Add(-10 * time.Minute)},
+		{name: "refreshed long ago", createdAt: now.Add(-3 * time.Hour), rotatedAt: now.Add(-2 * time.Hour), wantErr: domain.ErrRefreshDenied},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			engine := policy.NewEngine(map[policy.Signal]policy.Action{policy.SignalTokenAge: policy.ActionDeny}, time.Hour)
+			s, storage := newTestService(t, WithPolicy(engine))
+			userID := uuid.New()
+
+			accessToken, refreshToken, err := s.CreateTokens(ctx, userID, testUserAgent, testIP)
+			if err != nil {
+				t.Fatalf("CreateTokens: %v", err)
+			}
+			sessions, err := s.ListSessions(ctx, userID)
+			if err != nil || len(sessions) != 1 {
+				t.Fatalf("ListSessions = %v, %v, want 1 session", sessions, err)
+			}
+			session := sessions[0]
+			session.CreatedAt = tt.createdAt
+			session.RotatedAt = tt.rotatedAt
+			storage.put(session)
+
+			_, _, err = s.RefreshTokens(ctx, accessToken, refreshToken, testUserAgent, testIP)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("RefreshTokens: %v, want %v", err, tt.wantErr)
+			}
+		})
+	}
+}
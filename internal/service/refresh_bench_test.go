@@ -0,0 +1,114 @@
+package service
+
+import (
+	"context"
+	"encoding/base64"
+	"io"
+	"log/slog"
+	"testing"
+	"time"
+
+	"test2auth/domain"
+
+	"github.com/google/uuid"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func newBenchService(b *testing.B) (*authService, *fakeStorage) {
+	b.Helper()
+
+	storage := newFakeStorage()
+	log := slog.New(slog.NewTextHandler(io.Discard, nil))
+	s := NewAuthService(storage, log, "bench-secret", "http://127.0.0.1:0", time.Minute, time.Hour).(*authService)
+	return s, storage
+}
+
+// BenchmarkRefreshTokens compares a rotation with refresh tokens stored as
+// keyed SHA-256, looked up by their hash, to the bcrypt path it replaced,
+// which had to load the session by ID and compare and generate a bcrypt hash
+// on every refresh.
+func BenchmarkRefreshTokens(b *testing.B) {
+	ctx := context.Background()
+
+	b.Run("sha256", func(b *testing.B) {
+		s, _ := newBenchService(b)
+
+		accessToken, refreshToken, err := s.CreateTokens(ctx, uuid.New(), testUserAgent, testIP)
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.ResetTimer()
+		for range b.N {
+			accessToken, refreshToken, err = s.RefreshTokens(ctx, accessToken, refreshToken, testUserAgent, testIP)
+			if err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+
+	b.Run("bcrypt", func(b *testing.B) {
+		s, storage := newBenchService(b)
+
+		refreshToken, hash, err := bcryptRefreshToken()
+		if err != nil {
+			b.Fatal(err)
+		}
+		now := time.Now()
+		sessionID, _, err := storage.SaveSession(ctx, domain.Session{
+			UserID:           uuid.New(),
+			RefreshTokenHash: hash,
+			UserAgent:        testUserAgent,
+			IP:               testIP,
+			ExpiresAt:        now.Add(time.Hour),
+			CreatedAt:        now,
+			LastUsedAt:       now,
+		}, domain.SessionLimit{})
+		if err != nil {
+			b.Fatal(err)
+		}
+
+		b.ResetTimer()
+		for range b.N {
+			decoded, err := base64.StdEncoding.DecodeString(refreshToken)
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			session, err := storage.GetSession(ctx, sessionID)
+			if err != nil {
+				b.Fatal(err)
+			}
+			if err := bcrypt.CompareHashAndPassword([]byte(session.RefreshTokenHash), decoded); err != nil {
+				b.Fatal(err)
+			}
+
+			var newHash string
+			refreshToken, newHash, err = bcryptRefreshToken()
+			if err != nil {
+				b.Fatal(err)
+			}
+			if _, err := s.createAccessToken(session.UserID, session.ID); err != nil {
+				b.Fatal(err)
+			}
+
+			prevHash := session.RefreshTokenHash
+			session.RefreshTokenHash = newHash
+			session.LastUsedAt = time.Now()
+			if err := storage.RotateSession(ctx, session, prevHash); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
+
+// bcryptRefreshToken issues a refresh token the way the service did before
+// the keyed SHA-256 hash.
+func bcryptRefreshToken() (string, string, error) {
+	refreshToken := uuid.NewString()
+	hash, err := bcrypt.GenerateFromPassword([]byte(refreshToken), bcrypt.DefaultCost)
+	if err != nil {
+		return "", "", err
+	}
+	return base64.StdEncoding.EncodeToString([]byte(refreshToken)), string(hash), nil
+}
@@ -0,0 +1,52 @@
+package service
+
+import (
+	"context"
+	"net/netip"
+	"test2auth/domain"
+
+	"github.com/google/uuid"
+)
+
+// WithSessionLimit caps the number of active sessions per user. Depending on
+// the limit's policy a login over the cap is rejected or evicts older
+// sessions.
+func WithSessionLimit(limit domain.SessionLimit) Option {
+	return func(s *authService) {
+		s.sessionLimit = limit
+	}
+}
+
+func (s *authService) reportSessionLimit(ctx context.Context, userID uuid.UUID, ip netip.Addr, deviceType string) {
+	s.auditor.Record(ctx, domain.AuditSessionLimit, userID, ip.String(), map[string]string{
+		"device_type": deviceType,
+		"policy":      string(s.sessionLimit.Policy),
+	})
+	s.sendWebhook(ctx, map[string]string{
+		"event":       "session_limit_reached",
+		"user_id":     userID.String(),
+		"ip":          ip.String(),
+		"device_type": deviceType,
+		"message":     "A login was rejected because the user has too many active sessions.",
+	})
+}
+
+func (s *authService) reportEvictions(ctx context.Context, evicted []domain.Session, newSessionID uuid.UUID, ip netip.Addr) {
+	for _, session := range evicted {
+		s.auditor.Record(ctx, domain.AuditSessionEvicted, session.UserID, ip.String(), map[string]string{
+			"session_id":     session.ID.String(),
+			"new_session_id": newSessionID.String(),
+			"device_type":    session.Device.DeviceType,
+			"policy":         string(s.sessionLimit.Policy),
+		})
+		s.sendWebhook(ctx, map[string]string{
+			"event":       "session_evicted",
+			"user_id":     session.UserID.String(),
+			"session_id":  session.ID.String(),
+			"ip":          session.IP.String(),
+			"user_agent":  session.UserAgent,
+			"device_type": session.Device.DeviceType,
+			"message":     "A session was ended because the user logged in on another device.",
+		})
+	}
+}
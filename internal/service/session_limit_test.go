@@ -0,0 +1,56 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"test2auth/domain"
+
+	"github.com/google/uuid"
+)
+
+func TestSessionLimit(t *testing.T) {
+	tests := []struct {
+		name         string
+		policy       domain.SessionLimitPolicy
+		wantErr      error
+		wantFirstErr error
+	}{
+		{name: "reject", policy: domain.SessionLimitReject, wantErr: domain.ErrSessionLimitReached},
+		{name: "evict oldest", policy: domain.SessionLimitEvictOldest, wantFirstErr: domain.ErrInvalidRefreshToken},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			ctx := context.Background()
+			s, storage := newTestService(t, WithSessionLimit(domain.SessionLimit{MaxPerUser: 2, Policy: tt.policy}))
+			userID := uuid.New()
+
+			firstAccessToken, firstRefreshToken, err := s.CreateTokens(ctx, userID, testUserAgent, testIP)
+			if err != nil {
+				t.Fatalf("CreateTokens: %v", err)
+			}
+			if _, _, err := s.CreateTokens(ctx, userID, testUserAgent, testIP); err != nil {
+				t.Fatalf("CreateTokens: %v", err)
+			}
+			// Other users do not count.
+			if _, _, err := s.CreateTokens(ctx, uuid.New(), testUserAgent, testIP); err != nil {
+				t.Fatalf("CreateTokens: %v", err)
+			}
+
+			_, _, err = s.CreateTokens(ctx, userID, testUserAgent, testIP)
+			if !errors.Is(err, tt.wantErr) {
+				t.Fatalf("login over the limit: %v, want %v", err, tt.wantErr)
+			}
+			if n := storage.len(); n != 3 {
+				t.Errorf("%d sessions, want 3", n)
+			}
+
+			_, _, err = s.RefreshTokens(ctx, firstAccessToken, firstRefreshToken, testUserAgent, testIP)
+			if !errors.Is(err, tt.wantFirstErr) {
+				t.Errorf("refresh of the first session: %v, want %v", err, tt.wantFirstErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,49 @@
+package memory
+
+import (
+	"context"
+	"maps"
+	"test2auth/domain"
+)
+
+func (s *Storage) AppendAuditRecord(_ context.Context, record domain.AuditRecord, seal func(prevHash string, record domain.AuditRecord) string) error {
+	s.auditMu.Lock()
+	defer s.auditMu.Unlock()
+
+	var prevHash string
+	if len(s.audit) > 0 {
+		prevHash = s.audit[len(s.audit)-1].Hash
+	}
+
+	record.ID = int64(len(s.audit)) + 1
+	record.Details = maps.Clone(record.Details)
+	record.PrevHash = prevHash
+	record.Hash = seal(prevHash, record)
+	s.audit = append(s.audit, record)
+
+	return nil
+}
+
+func (s *Storage) ListAuditRecords(_ context.Context, afterID int64, limit int) ([]domain.AuditRecord, error) {
+	s.auditMu.Lock()
+	defer s.auditMu.Unlock()
+
+	if afterID < 0 {
+		afterID = 0
+	}
+	if afterID >= int64(len(s.audit)) {
+		return nil, nil
+	}
+
+	records := s.audit[afterID:]
+	if limit > 0 && len(records) > limit {
+		records = records[:limit]
+	}
+
+	out := make([]domain.AuditRecord, len(records))
+	for i, record := range records {
+		record.Details = maps.Clone(record.Details)
+		out[i] = record
+	}
+	return out, nil
+}
@@ -0,0 +1,271 @@
+// Package memory keeps sessions and the audit log in process memory. It has
+// the same semantics as the postgres storage and suits tests and single node
+// development; everything is lost on restart.
+package memory
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"sync"
+	"test2auth/domain"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+type Storage struct {
+	mu       sync.RWMutex
+	sessions map[uuid.UUID]domain.Session
+	// byToken and byPrevToken index sessions by their current and previous
+	// refresh token hash.
+	byToken     map[string]uuid.UUID
+	byPrevToken map[string]uuid.UUID
+
+	auditMu sync.Mutex
+	audit   []domain.AuditRecord
+}
+
+func New() *Storage {
+	return &Storage{
+		sessions:    map[uuid.UUID]domain.Session{},
+		byToken:     map[string]uuid.UUID{},
+		byPrevToken: map[string]uuid.UUID{},
+	}
+}
+
+func (s *Storage) SaveSession(_ context.Context, session domain.Session, limit domain.SessionLimit) (uuid.UUID, []domain.Session, error) {
+	const op = "storage.memory.SaveSession"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.byToken[session.RefreshTokenHash]; ok {
+		return uuid.Nil, nil, fmt.Errorf("%s: duplicate refresh token", op)
+	}
+
+	var evicted []domain.Session
+	if !limit.IsZero() {
+		var active []domain.Session
+		for _, existing := range s.sessions {
+			if existing.UserID == session.UserID && existing.ExpiresAt.After(session.LastUsedAt) {
+				active = append(active, existing)
+			}
+		}
+
+		var err error
+		evicted, err = limit.Admit(active, session, session.LastUsedAt)
+		if err != nil {
+			return uuid.Nil, nil, fmt.Errorf("%s: %w", op, err)
+		}
+		for _, e := range evicted {
+			s.delete(e.ID)
+		}
+	}
+
+	session.ID = uuid.New()
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = time.Now()
+	}
+	s.put(session)
+
+	return session.ID, evicted, nil
+}
+
+func (s *Storage) GetSession(_ context.Context, id uuid.UUID) (domain.Session, error) {
+	const op = "storage.memory.GetSession"
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	session, ok := s.sessions[id]
+	if !ok {
+		return domain.Session{}, fmt.Errorf("%s: %w", op, domain.ErrSessionNotFound)
+	}
+
+	return session, nil
+}
+
+func (s *Storage) GetSessionByRefreshToken(_ context.Context, tokenHash string) (domain.Session, error) {
+	const op = "storage.memory.GetSessionByRefreshToken"
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	id, ok := s.byToken[tokenHash]
+	if !ok {
+		id, ok = s.byPrevToken[tokenHash]
+	}
+	if !ok {
+		return domain.Session{}, fmt.Errorf("%s: %w", op, domain.ErrSessionNotFound)
+	}
+
+	return s.sessions[id], nil
+}
+
+func (s *Storage) ListUserSessions(_ context.Context, userID uuid.UUID) ([]domain.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var sessions []domain.Session
+	for _, session := range s.sessions {
+		if session.UserID == userID {
+			sessions = append(sessions, session)
+		}
+	}
+
+	slices.SortFunc(sessions, func(a, b domain.Session) int {
+		return b.LastUsedAt.Compare(a.LastUsedAt)
+	})
+
+	return sessions, nil
+}
+
+// RotateSession stores a rotated session under its existing ID if its refresh
+// token hash is still prevHash. The user and the creation time never change.
+func (s *Storage) RotateSession(_ context.Context, session domain.Session, prevHash string) error {
+	const op = "storage.memory.RotateSession"
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	current, ok := s.sessions[session.ID]
+	if !ok {
+		return fmt.Errorf("%s: %w", op, domain.ErrSessionNotFound)
+	}
+	if current.RefreshTokenHash != prevHash {
+		return fmt.Errorf("%s: %w", op, domain.ErrRefreshConflict)
+	}
+	if id, ok := s.byToken[session.RefreshTokenHash]; ok && id != session.ID {
+		return fmt.Errorf("%s: duplicate refresh token", op)
+	}
+
+	session.UserID = current.UserID
+	session.CreatedAt = current.CreatedAt
+
+	s.delete(session.ID)
+	s.put(session)
+
+	return nil
+}
+
+func (s *Storage) DeleteSession(_ context.Context, id uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.delete(id)
+
+	return nil
+}
+
+func (s *Storage) DeleteUserSessions(_ context.Context, userID uuid.UUID) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, session := range s.sessions {
+		if session.UserID == userID {
+			s.delete(id)
+		}
+	}
+
+	return nil
+}
+
+func (s *Storage) FindSessions(_ context.Context, filter domain.SessionFilter) ([]domain.Session, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var sessions []domain.Session
+	for _, session := range s.sessions {
+		if filter.Matches(session) {
+			sessions = append(sessions, session)
+		}
+	}
+
+	slices.SortFunc(sessions, func(a, b domain.Session) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	if filter.Limit > 0 && len(sessions) > filter.Limit {
+		sessions = sessions[:filter.Limit]
+	}
+
+	return sessions, nil
+}
+
+func (s *Storage) DeleteSessions(_ context.Context, filter domain.SessionFilter) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for id, session := range s.sessions {
+		if filter.Matches(session) {
+			s.delete(id)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+// ClearGraceTokens drops the sealed token pairs of at most limit sessions
+// whose grace period ended before now.
+func (s *Storage) ClearGraceTokens(_ context.Context, now time.Time, limit int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var cleared int64
+	for id, session := range s.sessions {
+		if cleared == int64(limit) {
+			break
+		}
+		if session.GraceTokens != "" && session.GraceUntil.Before(now) {
+			session.GraceTokens = ""
+			session.GraceUntil = time.Time{}
+			s.sessions[id] = session
+			cleared++
+		}
+	}
+
+	return cleared, nil
+}
+
+// DeleteExpiredSessions drops at most limit sessions that expired before now.
+func (s *Storage) DeleteExpiredSessions(_ context.Context, now time.Time, limit int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for id, session := range s.sessions {
+		if deleted == int64(limit) {
+			break
+		}
+		if session.ExpiresAt.Before(now) {
+			s.delete(id)
+			deleted++
+		}
+	}
+
+	return deleted, nil
+}
+
+// put and delete keep the token indexes in sync. The caller holds mu.
+func (s *Storage) put(session domain.Session) {
+	s.sessions[session.ID] = session
+	s.byToken[session.RefreshTokenHash] = session.ID
+	if session.PrevRefreshTokenHash != "" {
+		s.byPrevToken[session.PrevRefreshTokenHash] = session.ID
+	}
+}
+
+func (s *Storage) delete(id uuid.UUID) {
+	session, ok := s.sessions[id]
+	if !ok {
+		return
+	}
+
+	delete(s.sessions, id)
+	delete(s.byToken, session.RefreshTokenHash)
+	if s.byPrevToken[session.PrevRefreshTokenHash] == id {
+		delete(s.byPrevToken, session.PrevRefreshTokenHash)
+	}
+}
@@ -0,0 +1,15 @@
+package memory_test
+
+import (
+	"testing"
+
+	"test2auth/internal/service"
+	"test2auth/internal/storage/memory"
+	"test2auth/internal/storage/storagetest"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) service.Storage {
+		return memory.New()
+	})
+}
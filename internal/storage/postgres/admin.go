@@ -0,0 +1,74 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"test2auth/domain"
+
+	"github.com/google/uuid"
+)
+
+func (s *Storage) FindSessions(ctx context.Context, filter domain.SessionFilter) ([]domain.Session, error) {
+	const op = "storage.postgres.FindSessions"
+
+	where, args := sessionFilterClause(filter)
+	query := `SELECT ` + sessionColumns + ` FROM sessions` + where + ` ORDER BY created_at DESC`
+	if filter.Limit > 0 {
+		args = append(args, filter.Limit)
+		query += " LIMIT $" + strconv.Itoa(len(args))
+	}
+
+	sessions, err := querySessions(ctx, s.pool, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sessions, nil
+}
+
+func (s *Storage) DeleteSessions(ctx context.Context, filter domain.SessionFilter) (int64, error) {
+	const op = "storage.postgres.DeleteSessions"
+
+	where, args := sessionFilterClause(filter)
+
+	tag, err := s.pool.Exec(ctx, `DELETE FROM sessions`+where, args...)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+func sessionFilterClause(filter domain.SessionFilter) (string, []any) {
+	var (
+		conds []string
+		args  []any
+	)
+	add := func(cond string, arg any) {
+		args = append(args, arg)
+		conds = append(conds, strings.ReplaceAll(cond, "?", "$"+strconv.Itoa(len(args))))
+	}
+
+	if filter.UserID != uuid.Nil {
+		add("user_id = ?", filter.UserID)
+	}
+	if filter.IPRange.IsValid() {
+		add("CASE WHEN ip = '' THEN false ELSE ip::inet <<= ?::inet END", filter.IPRange.String())
+	}
+	if filter.UserAgent != "" {
+		add("strpos(lower(user_agent), lower(?)) > 0", filter.UserAgent)
+	}
+	if !filter.CreatedAfter.IsZero() {
+		add("created_at >= ?", filter.CreatedAfter)
+	}
+	if !filter.CreatedBefore.IsZero() {
+		add("created_at < ?", filter.CreatedBefore)
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
@@ -0,0 +1,95 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"test2auth/domain"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// auditLockID serializes appends to audit_log across all replicas: every
+// record is chained to the one before it, so two appends must not read the
+// same tail. It is one lock for the whole database, next to the class
+// constants of the session limit and janitor locks.
+const auditLockID = 7263001
+
+// AppendAuditRecord takes the audit lock in a transaction of its own, which
+// reads the tail, seals the record in memory and inserts it, so the lock is
+// held for two statements. Records are appended after the change they
+// describe has been committed, never inside its transaction.
+func (s *Storage) AppendAuditRecord(ctx context.Context, record domain.AuditRecord, seal func(prevHash string, record domain.AuditRecord) string) error {
+	const op = "storage.postgres.AppendAuditRecord"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", auditLockID); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	var prevHash string
+	err = tx.QueryRow(ctx, "SELECT hash FROM audit_log ORDER BY id DESC LIMIT 1").Scan(&prevHash)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	record.PrevHash = prevHash
+	record.Hash = seal(prevHash, record)
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO audit_log (event, user_id, ip, details, created_at, prev_hash, hash)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)`,
+		record.Event, record.UserID, record.IP, record.Details, record.CreatedAt, record.PrevHash, record.Hash,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) ListAuditRecords(ctx context.Context, afterID int64, limit int) ([]domain.AuditRecord, error) {
+	const op = "storage.postgres.ListAuditRecords"
+
+	rows, err := s.pool.Query(ctx,
+		`SELECT id, event, user_id, ip, details, created_at, prev_hash, hash
+		 FROM audit_log WHERE id > $1 ORDER BY id LIMIT $2`,
+		afterID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var records []domain.AuditRecord
+	for rows.Next() {
+		var record domain.AuditRecord
+		if err := rows.Scan(
+			&record.ID,
+			&record.Event,
+			&record.UserID,
+			&record.IP,
+			&record.Details,
+			&record.CreatedAt,
+			&record.PrevHash,
+			&record.Hash,
+		); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return records, nil
+}
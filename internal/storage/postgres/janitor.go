@@ -0,0 +1,83 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// janitorLockClass namespaces the advisory lock that keeps the janitor to one
+// replica at a time.
+const janitorLockClass = 7263003
+
+// TryJanitorLock takes a session-level advisory lock on a dedicated
+// connection, which is held until release.
+func (s *Storage) TryJanitorLock(ctx context.Context) (func(), bool, error) {
+	const op = "storage.postgres.TryJanitorLock"
+
+	conn, err := s.pool.Acquire(ctx)
+	if err != nil {
+		return nil, false, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var ok bool
+	if err := conn.QueryRow(ctx, `SELECT pg_try_advisory_lock($1, 0)`, janitorLockClass).Scan(&ok); err != nil {
+		conn.Release()
+		return nil, false, fmt.Errorf("%s: %w", op, err)
+	}
+	if !ok {
+		conn.Release()
+		return nil, false, nil
+	}
+
+	release := func() {
+		// ctx may already be cancelled on shutdown, the unlock must still run.
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+
+		if _, err := conn.Exec(ctx, `SELECT pg_advisory_unlock($1, 0)`, janitorLockClass); err != nil {
+			// A connection going back to the pool must not keep the lock.
+			conn.Conn().Close(ctx)
+		}
+		conn.Release()
+	}
+
+	return release, true, nil
+}
+
+func (s *Storage) DeleteExpiredSessions(ctx context.Context, now time.Time, limit int) (int64, error) {
+	const op = "storage.postgres.DeleteExpiredSessions"
+
+	tag, err := s.pool.Exec(ctx,
+		`DELETE FROM sessions
+		 WHERE id IN (SELECT id FROM sessions WHERE expires_at < $1 ORDER BY expires_at LIMIT $2)`,
+		now, limit,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// ClearGraceTokens drops the sealed token pairs of at most limit sessions
+// whose grace period ended before now. They are of no use after it.
+func (s *Storage) ClearGraceTokens(ctx context.Context, now time.Time, limit int) (int64, error) {
+	const op = "storage.postgres.ClearGraceTokens"
+
+	tag, err := s.pool.Exec(ctx,
+		`UPDATE sessions SET grace_tokens = '', grace_until = NULL
+		 WHERE id IN (
+		     SELECT id FROM sessions
+		     WHERE grace_tokens <> '' AND grace_until < $1
+		     ORDER BY grace_until
+		     LIMIT $2
+		 )`,
+		now, limit,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,72 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"test2auth/internal/jwtkeys"
+	"time"
+)
+
+func (s *Storage) ListSigningKeys(ctx context.Context) ([]jwtkeys.Record, error) {
+	const op = "storage.postgres.ListSigningKeys"
+
+	rows, err := s.pool.Query(ctx,
+		`SELECT id, sealed_secret, created_at, activate_at, retired_at FROM signing_keys ORDER BY created_at`,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var records []jwtkeys.Record
+	for rows.Next() {
+		var (
+			record    jwtkeys.Record
+			retiredAt *time.Time
+		)
+		if err := rows.Scan(&record.ID, &record.SealedSecret, &record.CreatedAt, &record.ActivateAt, &retiredAt); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if retiredAt != nil {
+			record.RetiredAt = *retiredAt
+		}
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return records, nil
+}
+
+func (s *Storage) SaveSigningKey(ctx context.Context, record jwtkeys.Record) error {
+	const op = "storage.postgres.SaveSigningKey"
+
+	_, err := s.pool.Exec(ctx,
+		`INSERT INTO signing_keys (id, sealed_secret, created_at, activate_at, retired_at)
+		 VALUES ($1, $2, $3, $4, $5)`,
+		record.ID, record.SealedSecret, record.CreatedAt, record.ActivateAt, nullTime(record.RetiredAt),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) RetireSigningKey(ctx context.Context, id string, at time.Time) error {
+	const op = "storage.postgres.RetireSigningKey"
+
+	tag, err := s.pool.Exec(ctx,
+		`UPDATE signing_keys SET retired_at = $2 WHERE id = $1 AND retired_at IS NULL`,
+		id, at,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, jwtkeys.ErrKeyNotFound)
+	}
+
+	return nil
+}
@@ -0,0 +1,126 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"test2auth/internal/lockout"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+func (s *Storage) GetLockoutState(ctx context.Context, key string) (lockout.State, error) {
+	const op = "storage.postgres.GetLockoutState"
+
+	state, err := getLockoutState(s.pool.QueryRow(ctx,
+		"SELECT failures, last_failure_at, locked_until FROM lockouts WHERE key = $1",
+		key,
+	))
+	if err != nil {
+		return lockout.State{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return state, nil
+}
+
+func (s *Storage) RegisterLockoutFailure(ctx context.Context, key string, policy lockout.Policy) (lockout.State, error) {
+	const op = "storage.postgres.RegisterLockoutFailure"
+
+	tx, err := s.pool.Begin(ctx)
+	if err != nil {
+		return lockout.State{}, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback(ctx)
+
+	var now time.Time
+	if err := tx.QueryRow(ctx, "SELECT NOW()").Scan(&now); err != nil {
+		return lockout.State{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	state, err := getLockoutState(tx.QueryRow(ctx,
+		"SELECT failures, last_failure_at, locked_until FROM lockouts WHERE key = $1 FOR UPDATE",
+		key,
+	))
+	if err != nil {
+		return lockout.State{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	state = policy.Fail(state, now)
+
+	var lockedUntil *time.Time
+	if !state.LockedUntil.IsZero() {
+		lockedUntil = &state.LockedUntil
+	}
+
+	_, err = tx.Exec(ctx,
+		`INSERT INTO lockouts (key, failures, last_failure_at, locked_until) VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (key) DO UPDATE
+		 SET failures = EXCLUDED.failures, last_failure_at = EXCLUDED.last_failure_at, locked_until = EXCLUDED.locked_until`,
+		key, state.Failures, state.LastFailureAt, lockedUntil,
+	)
+	if err != nil {
+		return lockout.State{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return lockout.State{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return state, nil
+}
+
+func (s *Storage) ResetLockoutState(ctx context.Context, key string) error {
+	const op = "storage.postgres.ResetLockoutState"
+
+	_, err := s.pool.Exec(ctx, "DELETE FROM lockouts WHERE key = $1", key)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func getLockoutState(row pgx.Row) (lockout.State, error) {
+	var (
+		state       lockout.State
+		lockedUntil *time.Time
+	)
+
+	err := row.Scan(&state.Failures, &state.LastFailureAt, &lockedUntil)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return lockout.State{}, nil
+		}
+		return lockout.State{}, err
+	}
+
+	if lockedUntil != nil {
+		state.LockedUntil = *lockedUntil
+	}
+
+	return state, nil
+}
+
+func (s *Storage) DeleteStaleLockouts(ctx context.Context, now time.Time, window time.Duration, limit int) (int64, error) {
+	const op = "storage.postgres.DeleteStaleLockouts"
+
+	// Like lockout.Memory's sweep: the window starts after the last failure
+	// and after the end of the last lockout.
+	cutoff := now.Add(-window)
+	tag, err := s.pool.Exec(ctx,
+		`DELETE FROM lockouts
+		 WHERE key IN (
+		     SELECT key FROM lockouts
+		     WHERE last_failure_at < $1 AND (locked_until IS NULL OR locked_until < $1)
+		     ORDER BY last_failure_at
+		     LIMIT $2
+		 )`,
+		cutoff, limit,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tag.RowsAffected(), nil
+}
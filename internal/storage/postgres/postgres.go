@@ -4,7 +4,9 @@ import (
 	"context"
 	"errors"
 	"fmt"
+	"net/netip"
 	"test2auth/domain"
+	"time"
 
 	"github.com/google/uuid"
 	"github.com/jackc/pgx/v5"
@@ -18,7 +20,13 @@ type Storage struct {
 func New(storageURL string) (*Storage, error) {
 	const op = "storage.postgres.New"
 
-	pool, err := pgxpool.New(context.Background(), storageURL)
+	config, err := pgxpool.ParseConfig(storageURL)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	config.ConnConfig.Tracer = queryTracer{}
+
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
 	if err != nil {
 		return nil, fmt.Errorf("%s: %w", op, err)
 	}
@@ -26,37 +34,118 @@ func New(storageURL string) (*Storage, error) {
 	return &Storage{pool: pool}, nil
 }
 
-func (s *Storage) SaveSession(ctx context.Context, session domain.Session) error {
+// PoolStat reports the state of the connection pool for metrics.
+func (s *Storage) PoolStat() *pgxpool.Stat {
+	return s.pool.Stat()
+}
+
+// sessionLimitLockClass namespaces the per-user advisory locks taken while
+// enforcing session limits.
+const sessionLimitLockClass = 7263002
+
+const sessionColumns = `id, user_id, refresh_token, user_agent, ip, expires_at, created_at, last_used_at,
+	country, city, latitude, longitude, asn, as_org,
+	browser_family, browser_major, os, device_type,
+	prev_refresh_token, rotated_at, grace_tokens, grace_until`
+
+// SaveSession inserts a new session, first enforcing limit on the user's
+// active sessions. A per-user advisory lock serializes concurrent logins of
+// the same user. It returns the sessions evicted to make room.
+func (s *Storage) SaveSession(ctx context.Context, session domain.Session, limit domain.SessionLimit) (uuid.UUID, []domain.Session, error) {
 	const op = "storage.postgres.SaveSession"
 
-	_, err := s.pool.Exec(ctx,
-		`INSERT INTO sessions (user_id, refresh_token, user_agent, ip, expires_at) 
-		 VALUES ($1, $2, $3, $4, $5)`,
-		session.UserID, session.RefreshTokenHash, session.UserAgent, session.IP, session.ExpiresAt,
-	)
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	tx, err := s.pool.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf("%s: %w", op, err)
+		return uuid.Nil, nil, fmt.Errorf("%s: %w", op, err)
 	}
+	defer tx.Rollback(ctx)
 
-	return nil
+	var evicted []domain.Session
+	if !limit.IsZero() {
+		if _, err := tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1, hashtext($2))`, sessionLimitLockClass, session.UserID.String()); err != nil {
+			return uuid.Nil, nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		active, err := querySessions(ctx, tx,
+			`SELECT `+sessionColumns+` FROM sessions WHERE user_id = $1 AND expires_at > $2`,
+			session.UserID, session.LastUsedAt,
+		)
+		if err != nil {
+			return uuid.Nil, nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		evicted, err = limit.Admit(active, session, session.LastUsedAt)
+		if err != nil {
+			return uuid.Nil, nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		for _, e := range evicted {
+			if _, err := tx.Exec(ctx, "DELETE FROM sessions WHERE id = $1", e.ID); err != nil {
+				return uuid.Nil, nil, fmt.Errorf("%s: %w", op, err)
+			}
+		}
+	}
+
+	var id uuid.UUID
+	err = tx.QueryRow(ctx,
+		`INSERT INTO sessions (user_id, refresh_token, user_agent, ip, expires_at, last_used_at,
+		                       country, city, latitude, longitude, asn, as_org,
+		                       browser_family, browser_major, os, device_type)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+		 RETURNING id`,
+		session.UserID, session.RefreshTokenHash, session.UserAgent, formatIP(session.IP), session.ExpiresAt, session.LastUsedAt,
+		session.Location.Country, session.Location.City, session.Location.Latitude, session.Location.Longitude,
+		int64(session.Location.ASN), session.Location.ASOrg,
+		session.Device.BrowserFamily, session.Device.BrowserMajor, session.Device.OS, session.Device.DeviceType,
+	).Scan(&id)
+	if err != nil {
+		return uuid.Nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return uuid.Nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, evicted, nil
 }
 
-func (s *Storage) GetSession(ctx context.Context, userID uuid.UUID) (domain.Session, error) {
+func (s *Storage) GetSession(ctx context.Context, id uuid.UUID) (domain.Session, error) {
 	const op = "storage.postgres.GetSession"
 
-	var session domain.Session
-	err := s.pool.QueryRow(ctx,
-		`SELECT user_id, refresh_token, user_agent, ip, expires_at, created_at 
-		 FROM sessions WHERE user_id = $1`,
-		userID,
-	).Scan(
-		&session.UserID,
-		&session.RefreshTokenHash,
-		&session.UserAgent,
-		&session.IP,
-		&session.ExpiresAt,
-		&session.CreatedAt,
-	)
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	session, err := scanSession(s.pool.QueryRow(ctx,
+		`SELECT `+sessionColumns+` FROM sessions WHERE id = $1`,
+		id,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.Session{}, fmt.Errorf("%s: %w", op, domain.ErrSessionNotFound)
+		}
+		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return session, nil
+}
+
+func (s *Storage) GetSessionByRefreshToken(ctx context.Context, tokenHash string) (domain.Session, error) {
+	const op = "storage.postgres.GetSessionByRefreshToken"
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	// Both columns are indexed; a UNION keeps each branch on its index.
+	session, err := scanSession(s.pool.QueryRow(ctx,
+		`SELECT `+sessionColumns+` FROM sessions WHERE refresh_token = $1
+		 UNION ALL
+		 SELECT `+sessionColumns+` FROM sessions WHERE prev_refresh_token = $1
+		 LIMIT 1`,
+		tokenHash,
+	))
 	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return domain.Session{}, fmt.Errorf("%s: %w", op, domain.ErrSessionNotFound)
@@ -67,9 +156,83 @@ func (s *Storage) GetSession(ctx context.Context, userID uuid.UUID) (domain.Sess
 	return session, nil
 }
 
-func (s *Storage) DeleteSession(ctx context.Context, userID uuid.UUID) error {
+func (s *Storage) ListUserSessions(ctx context.Context, userID uuid.UUID) ([]domain.Session, error) {
+	const op = "storage.postgres.ListUserSessions"
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	sessions, err := querySessions(ctx, s.pool,
+		`SELECT `+sessionColumns+` FROM sessions WHERE user_id = $1 ORDER BY last_used_at DESC`,
+		userID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sessions, nil
+}
+
+// RotateSession stores a rotated session under its existing ID if its refresh
+// token hash is still prevHash. The user and the creation time never change.
+// It returns domain.ErrRefreshConflict if another refresh got there first.
+func (s *Storage) RotateSession(ctx context.Context, session domain.Session, prevHash string) error {
+	const op = "storage.postgres.RotateSession"
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	tag, err := s.pool.Exec(ctx,
+		`UPDATE sessions
+		 SET refresh_token = $3, user_agent = $4, ip = $5, expires_at = $6, last_used_at = $7,
+		     country = $8, city = $9, latitude = $10, longitude = $11, asn = $12, as_org = $13,
+		     browser_family = $14, browser_major = $15, os = $16, device_type = $17,
+		     prev_refresh_token = $18, rotated_at = $19, grace_tokens = $20, grace_until = $21
+		 WHERE id = $1 AND refresh_token = $2`,
+		session.ID, prevHash,
+		session.RefreshTokenHash, session.UserAgent, formatIP(session.IP), session.ExpiresAt, session.LastUsedAt,
+		session.Location.Country, session.Location.City, session.Location.Latitude, session.Location.Longitude,
+		int64(session.Location.ASN), session.Location.ASOrg,
+		session.Device.BrowserFamily, session.Device.BrowserMajor, session.Device.OS, session.Device.DeviceType,
+		session.PrevRefreshTokenHash, nullTime(session.RotatedAt), session.GraceTokens, nullTime(session.GraceUntil),
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		var exists bool
+		if err := s.pool.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM sessions WHERE id = $1)`, session.ID).Scan(&exists); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if !exists {
+			return fmt.Errorf("%s: %w", op, domain.ErrSessionNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, domain.ErrRefreshConflict)
+	}
+
+	return nil
+}
+
+func (s *Storage) DeleteSession(ctx context.Context, id uuid.UUID) error {
 	const op = "storage.postgres.DeleteSession"
 
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
+	_, err := s.pool.Exec(ctx, "DELETE FROM sessions WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) DeleteUserSessions(ctx context.Context, userID uuid.UUID) error {
+	const op = "storage.postgres.DeleteUserSessions"
+
+	ctx, span := tracer.Start(ctx, op)
+	defer span.End()
+
 	_, err := s.pool.Exec(ctx, "DELETE FROM sessions WHERE user_id = $1", userID)
 	if err != nil {
 		return fmt.Errorf("%s: %w", op, err)
@@ -77,3 +240,106 @@ func (s *Storage) DeleteSession(ctx context.Context, userID uuid.UUID) error {
 
 	return nil
 }
+
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+}
+
+func querySessions(ctx context.Context, q querier, sql string, args ...any) ([]domain.Session, error) {
+	rows, err := q.Query(ctx, sql, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []domain.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+func scanSession(row pgx.Row) (domain.Session, error) {
+	var (
+		session    domain.Session
+		ip         string
+		asn        int64
+		rotatedAt  *time.Time
+		graceUntil *time.Time
+	)
+
+	err := row.Scan(
+		&session.ID,
+		&session.UserID,
+		&session.RefreshTokenHash,
+		&session.UserAgent,
+		&ip,
+		&session.ExpiresAt,
+		&session.CreatedAt,
+		&session.LastUsedAt,
+		&session.Location.Country,
+		&session.Location.City,
+		&session.Location.Latitude,
+		&session.Location.Longitude,
+		&asn,
+		&session.Location.ASOrg,
+		&session.Device.BrowserFamily,
+		&session.Device.BrowserMajor,
+		&session.Device.OS,
+		&session.Device.DeviceType,
+		&session.PrevRefreshTokenHash,
+		&rotatedAt,
+		&session.GraceTokens,
+		&graceUntil,
+	)
+	if err != nil {
+		return domain.Session{}, err
+	}
+
+	if rotatedAt != nil {
+		session.RotatedAt = *rotatedAt
+	}
+	if graceUntil != nil {
+		session.GraceUntil = *graceUntil
+	}
+
+	session.IP = parseIP(ip)
+	session.Location.ASN = uint(asn)
+
+	return session, nil
+}
+
+func nullTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+	return &t
+}
+
+func formatIP(ip netip.Addr) string {
+	if !ip.IsValid() {
+		return ""
+	}
+	return ip.String()
+}
+
+// parseIP also accepts "host:port" values written before client addresses
+// were normalized.
+func parseIP(s string) netip.Addr {
+	if addrPort, err := netip.ParseAddrPort(s); err == nil {
+		return addrPort.Addr().Unmap()
+	}
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
@@ -0,0 +1,100 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"test2auth/internal/ratelimit"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// refilledTokens is the content of bucket b refilled up to now, with the
+// burst as $2 and the rate per second as $3.
+const refilledTokens = `LEAST($2::float8, b.tokens + EXTRACT(EPOCH FROM NOW() - b.updated_at) * $3::float8)`
+
+// TakeRateLimitToken keeps token buckets in the rate_limits table so that all
+// replicas share them. The database clock is used to refill buckets. Taking a
+// token is a single upsert, which only changes the row if a token is left;
+// full_at records when the bucket will have refilled, so the janitor can drop
+// it after that.
+func (s *Storage) TakeRateLimitToken(ctx context.Context, key string, limit ratelimit.Limit) (ratelimit.Result, error) {
+	const op = "storage.postgres.TakeRateLimitToken"
+
+	var tokens float64
+	err := s.pool.QueryRow(ctx,
+		`INSERT INTO rate_limits AS b (key, tokens, updated_at, full_at)
+		 VALUES ($1, $2::float8 - 1, NOW(), NOW() + make_interval(secs => 1 / $3::float8))
+		 ON CONFLICT (key) DO UPDATE SET
+		     tokens = `+refilledTokens+` - 1,
+		     updated_at = NOW(),
+		     full_at = NOW() + make_interval(secs => ($2::float8 - `+refilledTokens+` + 1) / $3::float8)
+		 WHERE `+refilledTokens+` >= 1
+		 RETURNING tokens`,
+		key, float64(limit.Burst), limit.Rate,
+	).Scan(&tokens)
+	if err == nil {
+		return ratelimit.Result{Allowed: true}, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return ratelimit.Result{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// The bucket is empty and stays as it is, only the wait is computed.
+	var elapsed float64
+	err = s.pool.QueryRow(ctx,
+		`SELECT tokens, EXTRACT(EPOCH FROM (NOW() - updated_at))::float8 FROM rate_limits WHERE key = $1`,
+		key,
+	).Scan(&tokens, &elapsed)
+	if err != nil {
+		return ratelimit.Result{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, res := limit.Take(tokens, time.Duration(elapsed*float64(time.Second)))
+	return res, nil
+}
+
+// ReturnRateLimitToken puts a token back into the bucket, which is then full
+// that much sooner.
+func (s *Storage) ReturnRateLimitToken(ctx context.Context, key string, limit ratelimit.Limit) error {
+	const op = "storage.postgres.ReturnRateLimitToken"
+
+	_, err := s.pool.Exec(ctx,
+		`UPDATE rate_limits
+		 SET tokens = LEAST($2::float8, tokens + 1),
+		     full_at = GREATEST(updated_at, full_at - make_interval(secs => 1 / $3::float8))
+		 WHERE key = $1`,
+		key, float64(limit.Burst), limit.Rate,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// DeleteFullRateLimits deletes at most limit buckets that have refilled
+// completely by now. They behave exactly like missing ones, and keys are
+// client addresses and user IDs, so they would otherwise pile up. full_at is
+// set by the database clock, so now only tells how far back from NOW() to
+// look: the clock of the replica running the janitor may be off.
+func (s *Storage) DeleteFullRateLimits(ctx context.Context, now time.Time, limit int) (int64, error) {
+	const op = "storage.postgres.DeleteFullRateLimits"
+
+	tag, err := s.pool.Exec(ctx,
+		`DELETE FROM rate_limits
+		 WHERE key IN (
+		     SELECT key FROM rate_limits
+		     WHERE full_at < NOW() - make_interval(secs => $1::float8)
+		     ORDER BY full_at
+		     LIMIT $2
+		 )`,
+		time.Since(now).Seconds(), limit,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tag.RowsAffected(), nil
+}
@@ -0,0 +1,128 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"test2auth/domain"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const webhookDeliveryColumns = `id, url, payload, status, attempts, last_error, created_at, updated_at`
+
+func (s *Storage) SaveWebhookDelivery(ctx context.Context, delivery domain.WebhookDelivery) (int64, error) {
+	const op = "storage.postgres.SaveWebhookDelivery"
+
+	var id int64
+	err := s.pool.QueryRow(ctx,
+		`INSERT INTO webhook_deliveries (url, payload, status, attempts, last_error, created_at, updated_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		 RETURNING id`,
+		delivery.URL, delivery.Payload, delivery.Status, delivery.Attempts, delivery.LastError, delivery.CreatedAt, delivery.UpdatedAt,
+	).Scan(&id)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, nil
+}
+
+func (s *Storage) UpdateWebhookDelivery(ctx context.Context, delivery domain.WebhookDelivery) error {
+	const op = "storage.postgres.UpdateWebhookDelivery"
+
+	tag, err := s.pool.Exec(ctx,
+		`UPDATE webhook_deliveries
+		 SET url = $2, status = $3, attempts = $4, last_error = $5, updated_at = $6
+		 WHERE id = $1`,
+		delivery.ID, delivery.URL, delivery.Status, delivery.Attempts, delivery.LastError, delivery.UpdatedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("%s: %w", op, domain.ErrWebhookDeliveryNotFound)
+	}
+
+	return nil
+}
+
+func (s *Storage) GetWebhookDelivery(ctx context.Context, id int64) (domain.WebhookDelivery, error) {
+	const op = "storage.postgres.GetWebhookDelivery"
+
+	delivery, err := scanWebhookDelivery(s.pool.QueryRow(ctx,
+		`SELECT `+webhookDeliveryColumns+` FROM webhook_deliveries WHERE id = $1`,
+		id,
+	))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return domain.WebhookDelivery{}, fmt.Errorf("%s: %w", op, domain.ErrWebhookDeliveryNotFound)
+		}
+		return domain.WebhookDelivery{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return delivery, nil
+}
+
+func (s *Storage) ListWebhookDeliveries(ctx context.Context, failedOnly bool, limit int) ([]domain.WebhookDelivery, error) {
+	const op = "storage.postgres.ListWebhookDeliveries"
+
+	query := `SELECT ` + webhookDeliveryColumns + ` FROM webhook_deliveries`
+	args := []any{limit}
+	if failedOnly {
+		query += ` WHERE status = $2`
+		args = append(args, domain.WebhookFailed)
+	}
+	query += ` ORDER BY id DESC LIMIT $1`
+
+	rows, err := s.pool.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var deliveries []domain.WebhookDelivery
+	for rows.Next() {
+		delivery, err := scanWebhookDelivery(rows)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		deliveries = append(deliveries, delivery)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return deliveries, nil
+}
+
+func (s *Storage) DeleteWebhookDeliveries(ctx context.Context, before time.Time, limit int) (int64, error) {
+	const op = "storage.postgres.DeleteWebhookDeliveries"
+
+	tag, err := s.pool.Exec(ctx,
+		`DELETE FROM webhook_deliveries
+		 WHERE id IN (SELECT id FROM webhook_deliveries WHERE created_at < $1 ORDER BY created_at LIMIT $2)`,
+		before, limit,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+func scanWebhookDelivery(row pgx.Row) (domain.WebhookDelivery, error) {
+	var delivery domain.WebhookDelivery
+	err := row.Scan(
+		&delivery.ID,
+		&delivery.URL,
+		&delivery.Payload,
+		&delivery.Status,
+		&delivery.Attempts,
+		&delivery.LastError,
+		&delivery.CreatedAt,
+		&delivery.UpdatedAt,
+	)
+	return delivery, err
+}
@@ -0,0 +1,83 @@
+package redis
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+	"test2auth/domain"
+
+	"github.com/google/uuid"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// FindSessions scans every session, which is fine for the occasional admin
+// query but nothing to call per request.
+func (s *Storage) FindSessions(ctx context.Context, filter domain.SessionFilter) ([]domain.Session, error) {
+	const op = "storage.redis.FindSessions"
+
+	sessions, err := s.scanSessions(ctx, filter)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	slices.SortFunc(sessions, func(a, b domain.Session) int {
+		return b.CreatedAt.Compare(a.CreatedAt)
+	})
+	if filter.Limit > 0 && len(sessions) > filter.Limit {
+		sessions = sessions[:filter.Limit]
+	}
+
+	return sessions, nil
+}
+
+func (s *Storage) DeleteSessions(ctx context.Context, filter domain.SessionFilter) (int64, error) {
+	const op = "storage.redis.DeleteSessions"
+
+	sessions, err := s.scanSessions(ctx, filter)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = s.client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		for _, session := range sessions {
+			deleteSession(ctx, pipe, session)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return int64(len(sessions)), nil
+}
+
+func (s *Storage) scanSessions(ctx context.Context, filter domain.SessionFilter) ([]domain.Session, error) {
+	var sessions []domain.Session
+
+	iter := s.client.Scan(ctx, 0, sessionPattern(), 500).Iterator()
+	for iter.Next(ctx) {
+		id, err := uuid.Parse(strings.TrimPrefix(iter.Val(), prefix+"session:"))
+		if err != nil {
+			continue
+		}
+
+		session, err := getSession(ctx, s.client, id)
+		if errors.Is(err, domain.ErrSessionNotFound) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		if filter.Matches(session) {
+			sessions = append(sessions, session)
+		}
+	}
+	if err := iter.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
@@ -0,0 +1,83 @@
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"test2auth/domain"
+
+	goredis "github.com/redis/go-redis/v9"
+)
+
+// auditKey is a list of JSON records; a record's ID is its position plus one.
+const auditKey = prefix + "audit_log"
+
+// AppendAuditRecord reads the tail and appends in an optimistic transaction
+// on the list, so concurrent appends from several replicas stay chained.
+func (s *Storage) AppendAuditRecord(ctx context.Context, record domain.AuditRecord, seal func(prevHash string, record domain.AuditRecord) string) error {
+	const op = "storage.redis.AppendAuditRecord"
+
+	txf := func(tx *goredis.Tx) error {
+		var prevHash string
+		tail, err := tx.LIndex(ctx, auditKey, -1).Bytes()
+		if err != nil && !errors.Is(err, goredis.Nil) {
+			return err
+		}
+		if err == nil {
+			var prev domain.AuditRecord
+			if err := json.Unmarshal(tail, &prev); err != nil {
+				return err
+			}
+			prevHash = prev.Hash
+		}
+
+		record.PrevHash = prevHash
+		record.Hash = seal(prevHash, record)
+
+		data, err := json.Marshal(record)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+			pipe.RPush(ctx, auditKey, data)
+			return nil
+		})
+		return err
+	}
+
+	var err error
+	for range maxTxRetries {
+		err = s.client.Watch(ctx, txf, auditKey)
+		if !errors.Is(err, goredis.TxFailedErr) {
+			break
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) ListAuditRecords(ctx context.Context, afterID int64, limit int) ([]domain.AuditRecord, error) {
+	const op = "storage.redis.ListAuditRecords"
+
+	items, err := s.client.LRange(ctx, auditKey, afterID, afterID+int64(limit)-1).Result()
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	records := make([]domain.AuditRecord, 0, len(items))
+	for i, item := range items {
+		var record domain.AuditRecord
+		if err := json.Unmarshal([]byte(item), &record); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		record.ID = afterID + int64(i) + 1
+		records = append(records, record)
+	}
+
+	return records, nil
+}
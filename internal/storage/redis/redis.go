@@ -0,0 +1,400 @@
+// Package redis keeps sessions in Redis. Every session key expires at the
+// session's ExpiresAt, so Redis drops expired sessions by itself.
+//
+// Keys, all under the "auth:" prefix:
+//
+//	session:{id}          hash with the session as JSON ("data") and its
+//	                      current refresh token hash ("token")
+//	token:{hash}          session ID by current refresh token hash
+//	prevtoken:{hash}      session ID by previous refresh token hash
+//	grace:{id}            sealed grace tokens of the last rotation, expiring
+//	                      at the end of the grace period
+//	user:{id}:sessions    set of the user's session IDs, expiring with the
+//	                      last of them
+//
+// Only a single Redis server, optionally with replicas or Sentinel, is
+// supported, not Redis Cluster. The rotation script and the transactions
+// touch the keys of a session, its token hashes and its user together, and
+// token hashes are looked up without knowing the user, so no hash tag can put
+// them into one slot.
+package redis
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"test2auth/domain"
+
+	"github.com/google/uuid"
+	goredis "github.com/redis/go-redis/v9"
+)
+
+const prefix = "auth:"
+
+// maxTxRetries bounds optimistic transactions that keep losing to
+// concurrent writers.
+const maxTxRetries = 16
+
+type Storage struct {
+	client *goredis.Client
+}
+
+func New(storageURL string) (*Storage, error) {
+	const op = "storage.redis.New"
+
+	opts, err := goredis.ParseURL(storageURL)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	client := goredis.NewClient(opts)
+	if err := client.Ping(context.Background()).Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Storage{client: client}, nil
+}
+
+func sessionKey(id uuid.UUID) string  { return prefix + "session:" + id.String() }
+func tokenKey(hash string) string     { return prefix + "token:" + hash }
+func prevTokenKey(hash string) string { return prefix + "prevtoken:" + hash }
+func graceKey(id uuid.UUID) string    { return prefix + "grace:" + id.String() }
+func userKey(userID uuid.UUID) string { return prefix + "user:" + userID.String() + ":sessions" }
+func sessionPattern() string          { return prefix + "session:*" }
+
+// SaveSession inserts a new session. With a limit the user's session set is
+// watched, so a concurrent login or logout of the same user makes the
+// transaction start over with fresh data.
+func (s *Storage) SaveSession(ctx context.Context, session domain.Session, limit domain.SessionLimit) (uuid.UUID, []domain.Session, error) {
+	const op = "storage.redis.SaveSession"
+
+	id := uuid.New()
+	session.ID = id
+	if session.CreatedAt.IsZero() {
+		session.CreatedAt = session.LastUsedAt
+	}
+
+	if limit.IsZero() {
+		_, err := s.client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+			return putSession(ctx, pipe, session)
+		})
+		if err != nil {
+			return uuid.Nil, nil, fmt.Errorf("%s: %w", op, err)
+		}
+		return id, nil, nil
+	}
+
+	var (
+		evicted []domain.Session
+		err     error
+	)
+	txf := func(tx *goredis.Tx) error {
+		active, err := s.userSessions(ctx, tx, session.UserID)
+		if err != nil {
+			return err
+		}
+
+		evicted, err = limit.Admit(active, session, session.LastUsedAt)
+		if err != nil {
+			return err
+		}
+
+		_, err = tx.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+			for _, e := range evicted {
+				deleteSession(ctx, pipe, e)
+			}
+			return putSession(ctx, pipe, session)
+		})
+		return err
+	}
+
+	for range maxTxRetries {
+		err = s.client.Watch(ctx, txf, userKey(session.UserID))
+		if !errors.Is(err, goredis.TxFailedErr) {
+			break
+		}
+	}
+	if err != nil {
+		return uuid.Nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, evicted, nil
+}
+
+func (s *Storage) GetSession(ctx context.Context, id uuid.UUID) (domain.Session, error) {
+	const op = "storage.redis.GetSession"
+
+	session, err := getSession(ctx, s.client, id)
+	if err != nil {
+		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return session, nil
+}
+
+func (s *Storage) GetSessionByRefreshToken(ctx context.Context, tokenHash string) (domain.Session, error) {
+	const op = "storage.redis.GetSessionByRefreshToken"
+
+	for _, key := range []string{tokenKey(tokenHash), prevTokenKey(tokenHash)} {
+		value, err := s.client.Get(ctx, key).Result()
+		if errors.Is(err, goredis.Nil) {
+			continue
+		}
+		if err != nil {
+			return domain.Session{}, fmt.Errorf("%s: %w", op, err)
+		}
+		id, err := uuid.Parse(value)
+		if err != nil {
+			return domain.Session{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		session, err := getSession(ctx, s.client, id)
+		if errors.Is(err, domain.ErrSessionNotFound) {
+			continue
+		}
+		if err != nil {
+			return domain.Session{}, fmt.Errorf("%s: %w", op, err)
+		}
+
+		// Index keys are not removed on every rotation, check they are current.
+		if session.RefreshTokenHash == tokenHash || session.PrevRefreshTokenHash == tokenHash {
+			return session, nil
+		}
+	}
+
+	return domain.Session{}, fmt.Errorf("%s: %w", op, domain.ErrSessionNotFound)
+}
+
+func (s *Storage) ListUserSessions(ctx context.Context, userID uuid.UUID) ([]domain.Session, error) {
+	const op = "storage.redis.ListUserSessions"
+
+	sessions, err := s.userSessions(ctx, s.client, userID)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	slices.SortFunc(sessions, func(a, b domain.Session) int {
+		return b.LastUsedAt.Compare(a.LastUsedAt)
+	})
+
+	return sessions, nil
+}
+
+// expireUserSet defines expire_user_set, which moves the expiry of a user's
+// session set to at, in Unix milliseconds, unless the set already outlives
+// it. Every write of a member's ExpiresAt goes through it, so the set expires
+// with its last session.
+const expireUserSet = `
+local function expire_user_set(key, at)
+	local ttl = redis.call('PTTL', key)
+	if ttl >= 0 then
+		local now = redis.call('TIME')
+		if tonumber(now[1]) * 1000 + math.floor(tonumber(now[2]) / 1000) + ttl >= at then
+			return 0
+		end
+	end
+	redis.call('PEXPIREAT', key, at)
+	return 1
+end
+`
+
+var userExpiryScript = goredis.NewScript(expireUserSet + `
+return expire_user_set(KEYS[1], tonumber(ARGV[1]))
+`)
+
+// rotateScript swaps the session if its token is still the expected one.
+// It returns 0 if the session is gone and -1 on a conflict.
+var rotateScript = goredis.NewScript(expireUserSet + `
+local current = redis.call('HGET', KEYS[1], 'token')
+if not current then
+	return 0
+end
+if current ~= ARGV[1] then
+	return -1
+end
+
+redis.call('HSET', KEYS[1], 'token', ARGV[2], 'data', ARGV[3])
+redis.call('PEXPIREAT', KEYS[1], ARGV[4])
+redis.call('DEL', KEYS[2])
+redis.call('SET', KEYS[3], ARGV[5])
+redis.call('PEXPIREAT', KEYS[3], ARGV[4])
+redis.call('SET', KEYS[4], ARGV[5])
+redis.call('PEXPIREAT', KEYS[4], ARGV[4])
+if ARGV[6] ~= '' then
+	redis.call('SET', KEYS[5], ARGV[6])
+	redis.call('PEXPIREAT', KEYS[5], ARGV[7])
+else
+	redis.call('DEL', KEYS[5])
+end
+expire_user_set(KEYS[6], tonumber(ARGV[4]))
+return 1
+`)
+
+// RotateSession stores a rotated session under its existing ID if its refresh
+// token hash is still prevHash. The user and the creation time never change.
+// The grace tokens go to their own key, so Redis drops them after GraceUntil.
+func (s *Storage) RotateSession(ctx context.Context, session domain.Session, prevHash string) error {
+	const op = "storage.redis.RotateSession"
+
+	graceTokens := session.GraceTokens
+	session.GraceTokens = ""
+	data, err := json.Marshal(session)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	res, err := rotateScript.Run(ctx, s.client,
+		[]string{
+			sessionKey(session.ID),
+			tokenKey(prevHash),
+			tokenKey(session.RefreshTokenHash),
+			prevTokenKey(prevHash),
+			graceKey(session.ID),
+			userKey(session.UserID),
+		},
+		prevHash, session.RefreshTokenHash, data, session.ExpiresAt.UnixMilli(), session.ID.String(),
+		graceTokens, session.GraceUntil.UnixMilli(),
+	).Int()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	switch res {
+	case 0:
+		return fmt.Errorf("%s: %w", op, domain.ErrSessionNotFound)
+	case -1:
+		return fmt.Errorf("%s: %w", op, domain.ErrRefreshConflict)
+	}
+
+	return nil
+}
+
+func (s *Storage) DeleteSession(ctx context.Context, id uuid.UUID) error {
+	const op = "storage.redis.DeleteSession"
+
+	session, err := getSession(ctx, s.client, id)
+	if errors.Is(err, domain.ErrSessionNotFound) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = s.client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		deleteSession(ctx, pipe, session)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) DeleteUserSessions(ctx context.Context, userID uuid.UUID) error {
+	const op = "storage.redis.DeleteUserSessions"
+
+	sessions, err := s.userSessions(ctx, s.client, userID)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = s.client.TxPipelined(ctx, func(pipe goredis.Pipeliner) error {
+		for _, session := range sessions {
+			deleteSession(ctx, pipe, session)
+		}
+		pipe.Del(ctx, userKey(userID))
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+// userSessions loads the sessions in the user's set and drops IDs whose
+// session key has already expired.
+func (s *Storage) userSessions(ctx context.Context, c goredis.Cmdable, userID uuid.UUID) ([]domain.Session, error) {
+	members, err := c.SMembers(ctx, userKey(userID)).Result()
+	if err != nil {
+		return nil, err
+	}
+
+	var (
+		sessions []domain.Session
+		stale    []any
+	)
+	for _, member := range members {
+		id, err := uuid.Parse(member)
+		if err != nil {
+			return nil, err
+		}
+
+		session, err := getSession(ctx, c, id)
+		if errors.Is(err, domain.ErrSessionNotFound) {
+			stale = append(stale, member)
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+
+	if len(stale) > 0 {
+		// Best effort. In a watched transaction this touches the watched set,
+		// so the transaction starts over once without the stale IDs.
+		s.client.SRem(ctx, userKey(userID), stale...)
+	}
+
+	return sessions, nil
+}
+
+func getSession(ctx context.Context, c goredis.Cmdable, id uuid.UUID) (domain.Session, error) {
+	data, err := c.HGet(ctx, sessionKey(id), "data").Bytes()
+	if errors.Is(err, goredis.Nil) {
+		return domain.Session{}, domain.ErrSessionNotFound
+	}
+	if err != nil {
+		return domain.Session{}, err
+	}
+
+	var session domain.Session
+	if err := json.Unmarshal(data, &session); err != nil {
+		return domain.Session{}, err
+	}
+
+	session.GraceTokens, err = c.Get(ctx, graceKey(id)).Result()
+	if err != nil && !errors.Is(err, goredis.Nil) {
+		return domain.Session{}, err
+	}
+
+	return session, nil
+}
+
+func putSession(ctx context.Context, pipe goredis.Pipeliner, session domain.Session) error {
+	data, err := json.Marshal(session)
+	if err != nil {
+		return err
+	}
+
+	key := sessionKey(session.ID)
+	pipe.HSet(ctx, key, "token", session.RefreshTokenHash, "data", data)
+	pipe.PExpireAt(ctx, key, session.ExpiresAt)
+	pipe.Set(ctx, tokenKey(session.RefreshTokenHash), session.ID.String(), 0)
+	pipe.PExpireAt(ctx, tokenKey(session.RefreshTokenHash), session.ExpiresAt)
+	pipe.SAdd(ctx, userKey(session.UserID), session.ID.String())
+	userExpiryScript.Eval(ctx, pipe, []string{userKey(session.UserID)}, session.ExpiresAt.UnixMilli())
+	return nil
+}
+
+func deleteSession(ctx context.Context, pipe goredis.Pipeliner, session domain.Session) {
+	pipe.Del(ctx, sessionKey(session.ID), tokenKey(session.RefreshTokenHash), graceKey(session.ID))
+	if session.PrevRefreshTokenHash != "" {
+		pipe.Del(ctx, prevTokenKey(session.PrevRefreshTokenHash))
+	}
+	pipe.SRem(ctx, userKey(session.UserID), session.ID.String())
+}
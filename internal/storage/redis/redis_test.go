@@ -0,0 +1,97 @@
+package redis_test
+
+import (
+	"context"
+	"net/netip"
+	"os"
+	"testing"
+	"time"
+
+	"test2auth/domain"
+	"test2auth/internal/service"
+	"test2auth/internal/storage/redis"
+	"test2auth/internal/storage/storagetest"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/google/uuid"
+)
+
+// newStorage connects to the Redis in TEST_REDIS_URL, e.g.
+// redis://localhost:6379/15, or to an in-process miniredis if it is unset.
+func newStorage(t *testing.T) (*redis.Storage, *miniredis.Miniredis) {
+	t.Helper()
+
+	url := os.Getenv("TEST_REDIS_URL")
+	var m *miniredis.Miniredis
+	if url == "" {
+		m = miniredis.RunT(t)
+		url = "redis://" + m.Addr()
+	}
+
+	storage, err := redis.New(url)
+	if err != nil {
+		t.Fatalf("redis.New: %v", err)
+	}
+	return storage, m
+}
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) service.Storage {
+		storage, _ := newStorage(t)
+		return storage
+	})
+}
+
+func TestUserSessionsExpireWithTheLastSession(t *testing.T) {
+	storage, m := newStorage(t)
+	if m == nil {
+		t.Skip("needs miniredis to read the TTL")
+	}
+	ctx := context.Background()
+	userID := uuid.New()
+	userKey := "auth:user:" + userID.String() + ":sessions"
+	now := time.Now()
+
+	wantTTL := func(want time.Duration) {
+		t.Helper()
+		if got := m.TTL(userKey); got < want-time.Second || got > want+time.Second {
+			t.Errorf("TTL of the user's session set = %s, want %s", got, want)
+		}
+	}
+
+	save := func(expiresIn time.Duration) domain.Session {
+		t.Helper()
+		session := domain.Session{
+			UserID:           userID,
+			RefreshTokenHash: uuid.NewString(),
+			IP:               netip.MustParseAddr("203.0.113.7"),
+			ExpiresAt:        now.Add(expiresIn),
+			CreatedAt:        now,
+			LastUsedAt:       now,
+		}
+		id, _, err := storage.SaveSession(ctx, session, domain.SessionLimit{})
+		if err != nil {
+			t.Fatalf("SaveSession: %v", err)
+		}
+		session.ID = id
+		return session
+	}
+
+	short := save(time.Hour)
+	wantTTL(time.Hour)
+
+	save(3 * time.Hour)
+	wantTTL(3 * time.Hour)
+
+	// A session expiring before the others does not shorten the set.
+	save(2 * time.Hour)
+	wantTTL(3 * time.Hour)
+
+	prevHash := short.RefreshTokenHash
+	short.RefreshTokenHash = uuid.NewString()
+	short.ExpiresAt = now.Add(5 * time.Hour)
+	if err := storage.RotateSession(ctx, short, prevHash); err != nil {
+		t.Fatalf("RotateSession: %v", err)
+	}
+	wantTTL(5 * time.Hour)
+}
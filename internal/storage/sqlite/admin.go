@@ -0,0 +1,96 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"test2auth/domain"
+
+	"github.com/google/uuid"
+)
+
+// FindSessions narrows the query by user and creation time in SQL and applies
+// the rest of the filter, which SQLite cannot express, in Go.
+func (s *Storage) FindSessions(ctx context.Context, filter domain.SessionFilter) ([]domain.Session, error) {
+	const op = "storage.sqlite.FindSessions"
+
+	where, args := sessionFilterClause(filter)
+	candidates, err := querySessions(ctx, s.db,
+		`SELECT `+sessionColumns+` FROM sessions`+where+` ORDER BY created_at DESC`,
+		args...,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var sessions []domain.Session
+	for _, session := range candidates {
+		if !filter.Matches(session) {
+			continue
+		}
+		sessions = append(sessions, session)
+		if filter.Limit > 0 && len(sessions) == filter.Limit {
+			break
+		}
+	}
+
+	return sessions, nil
+}
+
+func (s *Storage) DeleteSessions(ctx context.Context, filter domain.SessionFilter) (int64, error) {
+	const op = "storage.sqlite.DeleteSessions"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	where, args := sessionFilterClause(filter)
+	candidates, err := querySessions(ctx, tx, `SELECT `+sessionColumns+` FROM sessions`+where, args...)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	var deleted int64
+	for _, session := range candidates {
+		if !filter.Matches(session) {
+			continue
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM sessions WHERE id = ?", session.ID.String()); err != nil {
+			return 0, fmt.Errorf("%s: %w", op, err)
+		}
+		deleted++
+	}
+
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return deleted, nil
+}
+
+func sessionFilterClause(filter domain.SessionFilter) (string, []any) {
+	var (
+		conds []string
+		args  []any
+	)
+
+	if filter.UserID != uuid.Nil {
+		conds = append(conds, "user_id = ?")
+		args = append(args, filter.UserID.String())
+	}
+	if !filter.CreatedAfter.IsZero() {
+		conds = append(conds, "created_at >= ?")
+		args = append(args, toMicro(filter.CreatedAfter))
+	}
+	if !filter.CreatedBefore.IsZero() {
+		conds = append(conds, "created_at < ?")
+		args = append(args, toMicro(filter.CreatedBefore))
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
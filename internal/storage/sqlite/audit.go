@@ -0,0 +1,104 @@
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"test2auth/domain"
+
+	"github.com/google/uuid"
+)
+
+// AppendAuditRecord reads the tail and inserts in one transaction; with the
+// single connection no other append can interleave.
+func (s *Storage) AppendAuditRecord(ctx context.Context, record domain.AuditRecord, seal func(prevHash string, record domain.AuditRecord) string) error {
+	const op = "storage.sqlite.AppendAuditRecord"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var prevHash string
+	err = tx.QueryRowContext(ctx, "SELECT hash FROM audit_log ORDER BY id DESC LIMIT 1").Scan(&prevHash)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	record.PrevHash = prevHash
+	record.Hash = seal(prevHash, record)
+
+	details, err := json.Marshal(record.Details)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO audit_log (event, user_id, ip, details, created_at, prev_hash, hash)
+		 VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		record.Event, record.UserID.String(), record.IP, string(details), toMicro(record.CreatedAt), record.PrevHash, record.Hash,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) ListAuditRecords(ctx context.Context, afterID int64, limit int) ([]domain.AuditRecord, error) {
+	const op = "storage.sqlite.ListAuditRecords"
+
+	rows, err := s.db.QueryContext(ctx,
+		`SELECT id, event, user_id, ip, details, created_at, prev_hash, hash
+		 FROM audit_log WHERE id > ? ORDER BY id LIMIT ?`,
+		afterID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer rows.Close()
+
+	var records []domain.AuditRecord
+	for rows.Next() {
+		var (
+			record    domain.AuditRecord
+			userID    string
+			details   string
+			createdAt int64
+		)
+		if err := rows.Scan(
+			&record.ID,
+			&record.Event,
+			&userID,
+			&record.IP,
+			&details,
+			&createdAt,
+			&record.PrevHash,
+			&record.Hash,
+		); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		if record.UserID, err = uuid.Parse(userID); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		if err := json.Unmarshal([]byte(details), &record.Details); err != nil {
+			return nil, fmt.Errorf("%s: %w", op, err)
+		}
+		record.CreatedAt = fromMicro(createdAt).UTC()
+
+		records = append(records, record)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return records, nil
+}
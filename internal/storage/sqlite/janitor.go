@@ -0,0 +1,54 @@
+package sqlite
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+func (s *Storage) DeleteExpiredSessions(ctx context.Context, now time.Time, limit int) (int64, error) {
+	const op = "storage.sqlite.DeleteExpiredSessions"
+
+	res, err := s.db.ExecContext(ctx,
+		`DELETE FROM sessions
+		 WHERE id IN (SELECT id FROM sessions WHERE expires_at < ? ORDER BY expires_at LIMIT ?)`,
+		toMicro(now), limit,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	deleted, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return deleted, nil
+}
+
+// ClearGraceTokens drops the sealed token pairs of at most limit sessions
+// whose grace period ended before now.
+func (s *Storage) ClearGraceTokens(ctx context.Context, now time.Time, limit int) (int64, error) {
+	const op = "storage.sqlite.ClearGraceTokens"
+
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE sessions SET grace_tokens = '', grace_until = 0
+		 WHERE id IN (
+		     SELECT id FROM sessions
+		     WHERE grace_tokens <> '' AND grace_until < ?
+		     ORDER BY grace_until
+		     LIMIT ?
+		 )`,
+		toMicro(now), limit,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	cleared, err := res.RowsAffected()
+	if err != nil {
+		return 0, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return cleared, nil
+}
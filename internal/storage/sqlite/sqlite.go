@@ -0,0 +1,339 @@
+// Package sqlite keeps sessions in a SQLite database through a pure Go
+// driver, for single node deployments where Postgres is overkill.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/netip"
+	"strings"
+	"test2auth/domain"
+	"time"
+
+	"github.com/google/uuid"
+	_ "modernc.org/sqlite" // registers the "sqlite" driver
+)
+
+type Storage struct {
+	db *sql.DB
+}
+
+// New opens the database at path, creating it if needed.
+func New(path string) (*Storage, error) {
+	const op = "storage.sqlite.New"
+
+	dsn := "file:" + path + "?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)"
+	db, err := sql.Open("sqlite", dsn)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	// A single connection serializes writers, which is what SQLite does
+	// anyway, and makes every transaction below exclusive.
+	db.SetMaxOpenConns(1)
+
+	if err := db.Ping(); err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return &Storage{db: db}, nil
+}
+
+const sessionColumns = `id, user_id, refresh_token, user_agent, ip, expires_at, created_at, last_used_at,
+	country, city, latitude, longitude, asn, as_org,
+	browser_family, browser_major, os, device_type,
+	prev_refresh_token, rotated_at, grace_tokens, grace_until`
+
+// SaveSession inserts a new session, first enforcing limit on the user's
+// active sessions. It returns the sessions evicted to make room.
+func (s *Storage) SaveSession(ctx context.Context, session domain.Session, limit domain.SessionLimit) (uuid.UUID, []domain.Session, error) {
+	const op = "storage.sqlite.SaveSession"
+
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return uuid.Nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+	defer tx.Rollback()
+
+	var evicted []domain.Session
+	if !limit.IsZero() {
+		active, err := querySessions(ctx, tx,
+			`SELECT `+sessionColumns+` FROM sessions WHERE user_id = ? AND expires_at > ?`,
+			session.UserID.String(), toMicro(session.LastUsedAt),
+		)
+		if err != nil {
+			return uuid.Nil, nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		evicted, err = limit.Admit(active, session, session.LastUsedAt)
+		if err != nil {
+			return uuid.Nil, nil, fmt.Errorf("%s: %w", op, err)
+		}
+
+		for _, e := range evicted {
+			if _, err := tx.ExecContext(ctx, "DELETE FROM sessions WHERE id = ?", e.ID.String()); err != nil {
+				return uuid.Nil, nil, fmt.Errorf("%s: %w", op, err)
+			}
+		}
+	}
+
+	createdAt := session.CreatedAt
+	if createdAt.IsZero() {
+		createdAt = time.Now()
+	}
+
+	id := uuid.New()
+	_, err = tx.ExecContext(ctx,
+		`INSERT INTO sessions (id, user_id, refresh_token, user_agent, ip, expires_at, created_at, last_used_at,
+		                       country, city, latitude, longitude, asn, as_org,
+		                       browser_family, browser_major, os, device_type)
+		 VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		id.String(), session.UserID.String(), session.RefreshTokenHash, session.UserAgent, formatIP(session.IP),
+		toMicro(session.ExpiresAt), toMicro(createdAt), toMicro(session.LastUsedAt),
+		session.Location.Country, session.Location.City, session.Location.Latitude, session.Location.Longitude,
+		int64(session.Location.ASN), session.Location.ASOrg,
+		session.Device.BrowserFamily, session.Device.BrowserMajor, session.Device.OS, session.Device.DeviceType,
+	)
+	if err != nil {
+		return uuid.Nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	if err := tx.Commit(); err != nil {
+		return uuid.Nil, nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return id, evicted, nil
+}
+
+func (s *Storage) GetSession(ctx context.Context, id uuid.UUID) (domain.Session, error) {
+	const op = "storage.sqlite.GetSession"
+
+	session, err := scanSession(s.db.QueryRowContext(ctx,
+		`SELECT `+sessionColumns+` FROM sessions WHERE id = ?`,
+		id.String(),
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.Session{}, fmt.Errorf("%s: %w", op, domain.ErrSessionNotFound)
+		}
+		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return session, nil
+}
+
+func (s *Storage) GetSessionByRefreshToken(ctx context.Context, tokenHash string) (domain.Session, error) {
+	const op = "storage.sqlite.GetSessionByRefreshToken"
+
+	session, err := scanSession(s.db.QueryRowContext(ctx,
+		`SELECT `+sessionColumns+` FROM sessions WHERE refresh_token = ?1
+		 UNION ALL
+		 SELECT `+sessionColumns+` FROM sessions WHERE prev_refresh_token = ?1
+		 LIMIT 1`,
+		tokenHash,
+	))
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return domain.Session{}, fmt.Errorf("%s: %w", op, domain.ErrSessionNotFound)
+		}
+		return domain.Session{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return session, nil
+}
+
+func (s *Storage) ListUserSessions(ctx context.Context, userID uuid.UUID) ([]domain.Session, error) {
+	const op = "storage.sqlite.ListUserSessions"
+
+	sessions, err := querySessions(ctx, s.db,
+		`SELECT `+sessionColumns+` FROM sessions WHERE user_id = ? ORDER BY last_used_at DESC`,
+		userID.String(),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return sessions, nil
+}
+
+// RotateSession stores a rotated session under its existing ID if its refresh
+// token hash is still prevHash. The user and the creation time never change.
+// It returns domain.ErrRefreshConflict if another refresh got there first.
+func (s *Storage) RotateSession(ctx context.Context, session domain.Session, prevHash string) error {
+	const op = "storage.sqlite.RotateSession"
+
+	res, err := s.db.ExecContext(ctx,
+		`UPDATE sessions
+		 SET refresh_token = ?, user_agent = ?, ip = ?, expires_at = ?, last_used_at = ?,
+		     country = ?, city = ?, latitude = ?, longitude = ?, asn = ?, as_org = ?,
+		     browser_family = ?, browser_major = ?, os = ?, device_type = ?,
+		     prev_refresh_token = ?, rotated_at = ?, grace_tokens = ?, grace_until = ?
+		 WHERE id = ? AND refresh_token = ?`,
+		session.RefreshTokenHash, session.UserAgent, formatIP(session.IP), toMicro(session.ExpiresAt), toMicro(session.LastUsedAt),
+		session.Location.Country, session.Location.City, session.Location.Latitude, session.Location.Longitude,
+		int64(session.Location.ASN), session.Location.ASOrg,
+		session.Device.BrowserFamily, session.Device.BrowserMajor, session.Device.OS, session.Device.DeviceType,
+		session.PrevRefreshTokenHash, toMicro(session.RotatedAt), session.GraceTokens, toMicro(session.GraceUntil),
+		session.ID.String(), prevHash,
+	)
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	affected, err := res.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+	if affected == 0 {
+		var exists bool
+		if err := s.db.QueryRowContext(ctx, `SELECT EXISTS (SELECT 1 FROM sessions WHERE id = ?)`, session.ID.String()).Scan(&exists); err != nil {
+			return fmt.Errorf("%s: %w", op, err)
+		}
+		if !exists {
+			return fmt.Errorf("%s: %w", op, domain.ErrSessionNotFound)
+		}
+		return fmt.Errorf("%s: %w", op, domain.ErrRefreshConflict)
+	}
+
+	return nil
+}
+
+func (s *Storage) DeleteSession(ctx context.Context, id uuid.UUID) error {
+	const op = "storage.sqlite.DeleteSession"
+
+	_, err := s.db.ExecContext(ctx, "DELETE FROM sessions WHERE id = ?", id.String())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+func (s *Storage) DeleteUserSessions(ctx context.Context, userID uuid.UUID) error {
+	const op = "storage.sqlite.DeleteUserSessions"
+
+	_, err := s.db.ExecContext(ctx, "DELETE FROM sessions WHERE user_id = ?", userID.String())
+	if err != nil {
+		return fmt.Errorf("%s: %w", op, err)
+	}
+
+	return nil
+}
+
+type querier interface {
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+}
+
+func querySessions(ctx context.Context, q querier, query string, args ...any) ([]domain.Session, error) {
+	rows, err := q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []domain.Session
+	for rows.Next() {
+		session, err := scanSession(rows)
+		if err != nil {
+			return nil, err
+		}
+		sessions = append(sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+type row interface {
+	Scan(dest ...any) error
+}
+
+func scanSession(r row) (domain.Session, error) {
+	var (
+		session                                               domain.Session
+		id, userID, ip                                        string
+		asn                                                   int64
+		expiresAt, createdAt, lastUsedAt, rotated, graceUntil int64
+	)
+
+	err := r.Scan(
+		&id,
+		&userID,
+		&session.RefreshTokenHash,
+		&session.UserAgent,
+		&ip,
+		&expiresAt,
+		&createdAt,
+		&lastUsedAt,
+		&session.Location.Country,
+		&session.Location.City,
+		&session.Location.Latitude,
+		&session.Location.Longitude,
+		&asn,
+		&session.Location.ASOrg,
+		&session.Device.BrowserFamily,
+		&session.Device.BrowserMajor,
+		&session.Device.OS,
+		&session.Device.DeviceType,
+		&session.PrevRefreshTokenHash,
+		&rotated,
+		&session.GraceTokens,
+		&graceUntil,
+	)
+	if err != nil {
+		return domain.Session{}, err
+	}
+
+	session.ID, err = uuid.Parse(id)
+	if err != nil {
+		return domain.Session{}, err
+	}
+	session.UserID, err = uuid.Parse(userID)
+	if err != nil {
+		return domain.Session{}, err
+	}
+	session.IP = parseIP(ip)
+	session.Location.ASN = uint(asn)
+	session.ExpiresAt = fromMicro(expiresAt)
+	session.CreatedAt = fromMicro(createdAt)
+	session.LastUsedAt = fromMicro(lastUsedAt)
+	session.RotatedAt = fromMicro(rotated)
+	session.GraceUntil = fromMicro(graceUntil)
+
+	return session, nil
+}
+
+// toMicro and fromMicro convert between time.Time and the Unix microseconds
+// stored in the database. The zero time is stored as 0.
+func toMicro(t time.Time) int64 {
+	if t.IsZero() {
+		return 0
+	}
+	return t.UnixMicro()
+}
+
+func fromMicro(us int64) time.Time {
+	if us == 0 {
+		return time.Time{}
+	}
+	return time.UnixMicro(us)
+}
+
+func formatIP(ip netip.Addr) string {
+	if !ip.IsValid() {
+		return ""
+	}
+	return ip.String()
+}
+
+func parseIP(s string) netip.Addr {
+	addr, err := netip.ParseAddr(strings.TrimSpace(s))
+	if err != nil {
+		return netip.Addr{}
+	}
+	return addr.Unmap()
+}
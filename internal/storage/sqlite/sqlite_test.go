@@ -0,0 +1,23 @@
+package sqlite_test
+
+import (
+	"path/filepath"
+	"testing"
+
+	"test2auth/internal/service"
+	"test2auth/internal/storage/sqlite"
+	"test2auth/internal/storage/storagetest"
+)
+
+func TestStorage(t *testing.T) {
+	storagetest.Run(t, func(t *testing.T) service.Storage {
+		path := filepath.Join(t.TempDir(), "auth.db")
+		storagetest.Migrate(t, "sqlite://"+path, "sqlite")
+
+		storage, err := sqlite.New(path)
+		if err != nil {
+			t.Fatalf("sqlite.New: %v", err)
+		}
+		return storage
+	})
+}
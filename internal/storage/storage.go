@@ -0,0 +1,41 @@
+// Package storage opens the storage backend named by a storage URL.
+package storage
+
+import (
+	"log/slog"
+	"strings"
+
+	"test2auth/internal/audit"
+	"test2auth/internal/service"
+	"test2auth/internal/storage/memory"
+	"test2auth/internal/storage/postgres"
+	"test2auth/internal/storage/redis"
+	"test2auth/internal/storage/sqlite"
+)
+
+// Storage is what a storage backend has to provide to run the service.
+// Backend specific features, such as signing keys or shared rate limits, are
+// discovered by type assertion.
+type Storage interface {
+	service.Storage
+	service.AdminStorage
+	audit.Storage
+	audit.Reader
+}
+
+// Open picks the backend by the scheme of storageURL: memory:// keeps
+// everything in process memory, redis:// and rediss:// use Redis, sqlite://
+// a SQLite file, anything else is a postgres URL.
+func Open(storageURL string, log *slog.Logger) (Storage, error) {
+	switch {
+	case strings.HasPrefix(storageURL, "memory://"):
+		log.Warn("using in-memory storage, sessions are lost on restart")
+		return memory.New(), nil
+	case strings.HasPrefix(storageURL, "redis://"), strings.HasPrefix(storageURL, "rediss://"):
+		return redis.New(storageURL)
+	case strings.HasPrefix(storageURL, "sqlite://"):
+		return sqlite.New(strings.TrimPrefix(storageURL, "sqlite://"))
+	}
+
+	return postgres.New(storageURL)
+}
@@ -0,0 +1,34 @@
+package storagetest
+
+import (
+	"errors"
+	"testing"
+
+	"test2auth/migrations"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	_ "github.com/golang-migrate/migrate/v4/database/sqlite"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+)
+
+// Migrate applies the embedded migrations in dir, "." for Postgres or
+// "sqlite", to the database at storageURL.
+func Migrate(t *testing.T, storageURL, dir string) {
+	t.Helper()
+
+	source, err := iofs.New(migrations.FS, dir)
+	if err != nil {
+		t.Fatalf("migrations: %v", err)
+	}
+
+	m, err := migrate.NewWithSourceInstance("iofs", source, storageURL)
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	defer m.Close()
+
+	if err := m.Up(); err != nil && !errors.Is(err, migrate.ErrNoChange) {
+		t.Fatalf("migrate up: %v", err)
+	}
+}
@@ -0,0 +1,492 @@
+// Package storagetest checks that a storage backend behaves the way the auth
+// service expects. Every backend runs the same suite from its own tests:
+//
+//	func TestStorage(t *testing.T) {
+//		storagetest.Run(t, func(t *testing.T) service.Storage { ... })
+//	}
+//
+// Backends shared between tests, such as a Postgres database, are fine: the
+// suite only touches sessions of users it makes up.
+package storagetest
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"net/netip"
+	"slices"
+	"sync"
+	"testing"
+	"time"
+
+	"test2auth/domain"
+	"test2auth/internal/janitor"
+	"test2auth/internal/service"
+
+	"github.com/google/uuid"
+)
+
+// Run runs the suite against the storage returned by newStorage, which is
+// called once per test.
+func Run(t *testing.T, newStorage func(t *testing.T) service.Storage) {
+	tests := []struct {
+		name string
+		test func(t *testing.T, s service.Storage)
+	}{
+		{"SaveAndGet", testSaveAndGet},
+		{"NotFound", testNotFound},
+		{"Rotate", testRotate},
+		{"RotateConflict", testRotateConflict},
+		{"Expiry", testExpiry},
+		{"SessionLimitEviction", testSessionLimitEviction},
+		{"SessionLimitReject", testSessionLimitReject},
+		{"SessionLimitConcurrent", testSessionLimitConcurrent},
+		{"DeleteUserSessions", testDeleteUserSessions},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.test(t, newStorage(t))
+		})
+	}
+}
+
+// now is truncated to what every backend stores.
+func now() time.Time {
+	return time.Now().UTC().Truncate(time.Microsecond)
+}
+
+func newHash(t *testing.T) string {
+	t.Helper()
+
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+func newSession(t *testing.T, userID uuid.UUID, createdAt time.Time) domain.Session {
+	t.Helper()
+
+	return domain.Session{
+		UserID:           userID,
+		RefreshTokenHash: newHash(t),
+		UserAgent:        "Mozilla/5.0 (X11; Linux x86_64) Firefox/128.0",
+		Device: domain.Device{
+			BrowserFamily: "Firefox",
+			BrowserMajor:  "128",
+			OS:            "Linux",
+			DeviceType:    "desktop",
+		},
+		IP: netip.MustParseAddr("203.0.113.7"),
+		Location: domain.Location{
+			Country:   "NL",
+			City:      "Amsterdam",
+			Latitude:  52.37,
+			Longitude: 4.89,
+			ASN:       64500,
+			ASOrg:     "Example Net",
+		},
+		ExpiresAt:  createdAt.Add(time.Hour),
+		CreatedAt:  createdAt,
+		LastUsedAt: createdAt,
+	}
+}
+
+func save(t *testing.T, s service.Storage, session domain.Session) domain.Session {
+	t.Helper()
+
+	id, _, err := s.SaveSession(context.Background(), session, domain.SessionLimit{})
+	if err != nil {
+		t.Fatalf("SaveSession: %v", err)
+	}
+	session.ID = id
+	return session
+}
+
+// get loads the session and fails the test unless it exists.
+func get(t *testing.T, s service.Storage, id uuid.UUID) domain.Session {
+	t.Helper()
+
+	session, err := s.GetSession(context.Background(), id)
+	if err != nil {
+		t.Fatalf("GetSession(%s): %v", id, err)
+	}
+	return session
+}
+
+func wantNotFound(t *testing.T, what string, err error) {
+	t.Helper()
+
+	if !errors.Is(err, domain.ErrSessionNotFound) {
+		t.Errorf("%s: error %v, want %v", what, err, domain.ErrSessionNotFound)
+	}
+}
+
+func sessionIDs(sessions []domain.Session) []uuid.UUID {
+	ids := make([]uuid.UUID, 0, len(sessions))
+	for _, session := range sessions {
+		ids = append(ids, session.ID)
+	}
+	slices.SortFunc(ids, func(a, b uuid.UUID) int { return slices.Compare(a[:], b[:]) })
+	return ids
+}
+
+func testSaveAndGet(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	want := save(t, s, newSession(t, uuid.New(), now()))
+
+	got := get(t, s, want.ID)
+	if got.UserID != want.UserID || got.RefreshTokenHash != want.RefreshTokenHash ||
+		got.UserAgent != want.UserAgent || got.Device != want.Device ||
+		got.IP != want.IP || got.Location != want.Location {
+		t.Errorf("GetSession = %+v, want %+v", got, want)
+	}
+	if !got.ExpiresAt.Equal(want.ExpiresAt) || !got.LastUsedAt.Equal(want.LastUsedAt) {
+		t.Errorf("GetSession times: expires %s, last used %s, want %s, %s",
+			got.ExpiresAt, got.LastUsedAt, want.ExpiresAt, want.LastUsedAt)
+	}
+
+	byToken, err := s.GetSessionByRefreshToken(ctx, want.RefreshTokenHash)
+	if err != nil {
+		t.Fatalf("GetSessionByRefreshToken: %v", err)
+	}
+	if byToken.ID != want.ID {
+		t.Errorf("GetSessionByRefreshToken: session %s, want %s", byToken.ID, want.ID)
+	}
+
+	sessions, err := s.ListUserSessions(ctx, want.UserID)
+	if err != nil {
+		t.Fatalf("ListUserSessions: %v", err)
+	}
+	if len(sessions) != 1 || sessions[0].ID != want.ID {
+		t.Errorf("ListUserSessions = %v, want [%s]", sessionIDs(sessions), want.ID)
+	}
+}
+
+func testNotFound(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+
+	_, err := s.GetSession(ctx, uuid.New())
+	wantNotFound(t, "GetSession", err)
+
+	_, err = s.GetSessionByRefreshToken(ctx, newHash(t))
+	wantNotFound(t, "GetSessionByRefreshToken", err)
+
+	missing := newSession(t, uuid.New(), now())
+	missing.ID = uuid.New()
+	err = s.RotateSession(ctx, missing, missing.RefreshTokenHash)
+	wantNotFound(t, "RotateSession", err)
+
+	sessions, err := s.ListUserSessions(ctx, uuid.New())
+	if err != nil || len(sessions) != 0 {
+		t.Errorf("ListUserSessions of an unknown user = %v, %v, want none", sessionIDs(sessions), err)
+	}
+
+	// Deleting twice is what a logout racing a revocation does.
+	if err := s.DeleteSession(ctx, uuid.New()); err != nil {
+		t.Errorf("DeleteSession of a missing session: %v", err)
+	}
+}
+
+func testRotate(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	session := save(t, s, newSession(t, uuid.New(), now().Add(-time.Minute)))
+
+	prevHash := session.RefreshTokenHash
+	rotatedAt := now()
+	session.RefreshTokenHash = newHash(t)
+	session.PrevRefreshTokenHash = prevHash
+	session.RotatedAt = rotatedAt
+	session.LastUsedAt = rotatedAt
+	session.ExpiresAt = rotatedAt.Add(time.Hour)
+	session.IP = netip.MustParseAddr("2001:db8::1")
+	session.GraceTokens = "sealed"
+	session.GraceUntil = rotatedAt.Add(10 * time.Second)
+	if err := s.RotateSession(ctx, session, prevHash); err != nil {
+		t.Fatalf("RotateSession: %v", err)
+	}
+
+	got := get(t, s, session.ID)
+	if got.RefreshTokenHash != session.RefreshTokenHash || got.PrevRefreshTokenHash != prevHash {
+		t.Errorf("RotateSession: hashes %q, %q, want %q, %q",
+			got.RefreshTokenHash, got.PrevRefreshTokenHash, session.RefreshTokenHash, prevHash)
+	}
+	if got.IP != session.IP || !got.RotatedAt.Equal(rotatedAt) || !got.LastUsedAt.Equal(rotatedAt) {
+		t.Errorf("RotateSession: ip %s, rotated %s, last used %s, want %s, %s, %s",
+			got.IP, got.RotatedAt, got.LastUsedAt, session.IP, rotatedAt, rotatedAt)
+	}
+	if got.GraceTokens != session.GraceTokens || !got.GraceUntil.Equal(session.GraceUntil) {
+		t.Errorf("RotateSession: grace %q until %s, want %q until %s",
+			got.GraceTokens, got.GraceUntil, session.GraceTokens, session.GraceUntil)
+	}
+
+	// The previous token still finds the session, so reuse can be detected.
+	for _, hash := range []string{session.RefreshTokenHash, prevHash} {
+		byToken, err := s.GetSessionByRefreshToken(ctx, hash)
+		if err != nil {
+			t.Fatalf("GetSessionByRefreshToken: %v", err)
+		}
+		if byToken.ID != session.ID {
+			t.Errorf("GetSessionByRefreshToken: session %s, want %s", byToken.ID, session.ID)
+		}
+	}
+
+	// A second rotation forgets the oldest token.
+	oldest := prevHash
+	prevHash = session.RefreshTokenHash
+	session.RefreshTokenHash = newHash(t)
+	session.PrevRefreshTokenHash = prevHash
+	if err := s.RotateSession(ctx, session, prevHash); err != nil {
+		t.Fatalf("RotateSession: %v", err)
+	}
+	_, err := s.GetSessionByRefreshToken(ctx, oldest)
+	wantNotFound(t, "GetSessionByRefreshToken of a token two rotations old", err)
+}
+
+func testRotateConflict(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	session := save(t, s, newSession(t, uuid.New(), now()))
+	prevHash := session.RefreshTokenHash
+
+	const refreshes = 8
+	hashes := make([]string, refreshes)
+	errs := make([]error, refreshes)
+
+	var wg sync.WaitGroup
+	for i := range refreshes {
+		hashes[i] = newHash(t)
+		rotated := session
+		rotated.RefreshTokenHash = hashes[i]
+		rotated.PrevRefreshTokenHash = prevHash
+		rotated.RotatedAt = now()
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs[i] = s.RotateSession(ctx, rotated, prevHash)
+		}()
+	}
+	wg.Wait()
+
+	winner := -1
+	for i, err := range errs {
+		switch {
+		case err == nil && winner == -1:
+			winner = i
+		case err == nil:
+			t.Errorf("refreshes %d and %d both rotated the session", winner, i)
+		case !errors.Is(err, domain.ErrRefreshConflict):
+			t.Errorf("refresh %d: error %v, want %v", i, err, domain.ErrRefreshConflict)
+		}
+	}
+	if winner == -1 {
+		t.Fatal("no refresh rotated the session")
+	}
+
+	if got := get(t, s, session.ID); got.RefreshTokenHash != hashes[winner] {
+		t.Errorf("session has token %q, want the winner's %q", got.RefreshTokenHash, hashes[winner])
+	}
+	for i, hash := range hashes {
+		if i == winner {
+			continue
+		}
+		_, err := s.GetSessionByRefreshToken(ctx, hash)
+		wantNotFound(t, "GetSessionByRefreshToken of a losing token", err)
+	}
+}
+
+// testExpiry checks that expired sessions go away: Redis expires them itself,
+// the other backends when the janitor purges them. Until then the service
+// checks ExpiresAt on its own.
+func testExpiry(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	expired := newSession(t, userID, now().Add(-2*time.Hour))
+	expired = save(t, s, expired)
+	live := save(t, s, newSession(t, userID, now()))
+
+	if store, ok := s.(janitor.Store); ok {
+		if _, err := store.DeleteExpiredSessions(ctx, time.Now(), 1000); err != nil {
+			t.Fatalf("DeleteExpiredSessions: %v", err)
+		}
+	}
+
+	_, err := s.GetSession(ctx, expired.ID)
+	wantNotFound(t, "GetSession of an expired session", err)
+	_, err = s.GetSessionByRefreshToken(ctx, expired.RefreshTokenHash)
+	wantNotFound(t, "GetSessionByRefreshToken of an expired session", err)
+
+	sessions, err := s.ListUserSessions(ctx, userID)
+	if err != nil {
+		t.Fatalf("ListUserSessions: %v", err)
+	}
+	if want := []uuid.UUID{live.ID}; !slices.Equal(sessionIDs(sessions), want) {
+		t.Errorf("ListUserSessions = %v, want %v", sessionIDs(sessions), want)
+	}
+
+	// An expired session does not count against the limit either.
+	limit := domain.SessionLimit{MaxPerUser: 1, Policy: domain.SessionLimitReject}
+	other := uuid.New()
+	save(t, s, newSession(t, other, now().Add(-2*time.Hour)))
+	if _, _, err := s.SaveSession(ctx, newSession(t, other, now()), limit); err != nil {
+		t.Errorf("SaveSession next to an expired session: %v", err)
+	}
+}
+
+func testSessionLimitEviction(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	userID := uuid.New()
+	start := now().Add(-time.Hour)
+
+	// Created oldest first, but the oldest was used last.
+	var sessions []domain.Session
+	for i := range 3 {
+		session := newSession(t, userID, start.Add(time.Duration(i)*time.Minute))
+		session.LastUsedAt = start.Add(time.Duration(10-i) * time.Minute)
+		session.ExpiresAt = now().Add(time.Hour)
+		sessions = append(sessions, save(t, s, session))
+	}
+
+	limit := domain.SessionLimit{MaxPerUser: 3, Policy: domain.SessionLimitEvictLRU}
+	id, evicted, err := s.SaveSession(ctx, newSession(t, userID, now()), limit)
+	if err != nil {
+		t.Fatalf("SaveSession: %v", err)
+	}
+	if want := []uuid.UUID{sessions[2].ID}; !slices.Equal(sessionIDs(evicted), want) {
+		t.Errorf("evict_lru evicted %v, want the least recently used %v", sessionIDs(evicted), want)
+	}
+	_, err = s.GetSession(ctx, sessions[2].ID)
+	wantNotFound(t, "GetSession of an evicted session", err)
+
+	limit.Policy = domain.SessionLimitEvictOldest
+	_, evicted, err = s.SaveSession(ctx, newSession(t, userID, now()), limit)
+	if err != nil {
+		t.Fatalf("SaveSession: %v", err)
+	}
+	if want := []uuid.UUID{sessions[0].ID}; !slices.Equal(sessionIDs(evicted), want) {
+		t.Errorf("evict_oldest evicted %v, want the oldest %v", sessionIDs(evicted), want)
+	}
+
+	active, err := s.ListUserSessions(ctx, userID)
+	if err != nil {
+		t.Fatalf("ListUserSessions: %v", err)
+	}
+	if len(active) != 3 || !slices.Contains(sessionIDs(active), id) {
+		t.Errorf("ListUserSessions = %v, want 3 sessions including %s", sessionIDs(active), id)
+	}
+
+	// The device type limit only counts sessions of that type.
+	limit = domain.SessionLimit{MaxPerDeviceType: map[string]int{"mobile": 1}, Policy: domain.SessionLimitEvictOldest}
+	phone := newSession(t, userID, now())
+	phone.Device.DeviceType = "mobile"
+	phone.ID, evicted, err = s.SaveSession(ctx, phone, limit)
+	if err != nil || len(evicted) != 0 {
+		t.Fatalf("SaveSession of the first mobile session: evicted %v, %v", sessionIDs(evicted), err)
+	}
+	secondPhone := newSession(t, userID, now())
+	secondPhone.Device.DeviceType = "mobile"
+	_, evicted, err = s.SaveSession(ctx, secondPhone, limit)
+	if err != nil {
+		t.Fatalf("SaveSession: %v", err)
+	}
+	if want := []uuid.UUID{phone.ID}; !slices.Equal(sessionIDs(evicted), want) {
+		t.Errorf("mobile limit evicted %v, want %v", sessionIDs(evicted), want)
+	}
+}
+
+func testSessionLimitReject(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	userID := uuid.New()
+	first := save(t, s, newSession(t, userID, now()))
+
+	limit := domain.SessionLimit{MaxPerUser: 1, Policy: domain.SessionLimitReject}
+	_, evicted, err := s.SaveSession(ctx, newSession(t, userID, now()), limit)
+	if !errors.Is(err, domain.ErrSessionLimitReached) {
+		t.Errorf("SaveSession over the limit: error %v, want %v", err, domain.ErrSessionLimitReached)
+	}
+	if len(evicted) != 0 {
+		t.Errorf("reject evicted %v", sessionIDs(evicted))
+	}
+
+	sessions, err := s.ListUserSessions(ctx, userID)
+	if err != nil {
+		t.Fatalf("ListUserSessions: %v", err)
+	}
+	if want := []uuid.UUID{first.ID}; !slices.Equal(sessionIDs(sessions), want) {
+		t.Errorf("ListUserSessions = %v, want %v", sessionIDs(sessions), want)
+	}
+}
+
+// testSessionLimitConcurrent logs in concurrently, which must not slip past
+// the limit.
+func testSessionLimitConcurrent(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	userID := uuid.New()
+
+	const (
+		logins      = 10
+		maxSessions = 3
+	)
+	limit := domain.SessionLimit{MaxPerUser: maxSessions, Policy: domain.SessionLimitReject}
+
+	errs := make([]error, logins)
+	var wg sync.WaitGroup
+	for i := range logins {
+		session := newSession(t, userID, now())
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, errs[i] = s.SaveSession(ctx, session, limit)
+		}()
+	}
+	wg.Wait()
+
+	admitted := 0
+	for _, err := range errs {
+		switch {
+		case err == nil:
+			admitted++
+		case !errors.Is(err, domain.ErrSessionLimitReached):
+			t.Errorf("SaveSession: %v", err)
+		}
+	}
+	if admitted != maxSessions {
+		t.Errorf("%d of %d concurrent logins admitted, want %d", admitted, logins, maxSessions)
+	}
+
+	sessions, err := s.ListUserSessions(ctx, userID)
+	if err != nil {
+		t.Fatalf("ListUserSessions: %v", err)
+	}
+	if len(sessions) != maxSessions {
+		t.Errorf("user has %d sessions, want %d", len(sessions), maxSessions)
+	}
+}
+
+func testDeleteUserSessions(t *testing.T, s service.Storage) {
+	ctx := context.Background()
+	userID := uuid.New()
+	first := save(t, s, newSession(t, userID, now()))
+	save(t, s, newSession(t, userID, now()))
+	other := save(t, s, newSession(t, uuid.New(), now()))
+
+	if err := s.DeleteSession(ctx, first.ID); err != nil {
+		t.Fatalf("DeleteSession: %v", err)
+	}
+	_, err := s.GetSessionByRefreshToken(ctx, first.RefreshTokenHash)
+	wantNotFound(t, "GetSessionByRefreshToken of a deleted session", err)
+
+	if err := s.DeleteUserSessions(ctx, userID); err != nil {
+		t.Fatalf("DeleteUserSessions: %v", err)
+	}
+	sessions, err := s.ListUserSessions(ctx, userID)
+	if err != nil || len(sessions) != 0 {
+		t.Errorf("ListUserSessions after DeleteUserSessions = %v, %v, want none", sessionIDs(sessions), err)
+	}
+
+	get(t, s, other.ID)
+}
@@ -0,0 +1,89 @@
+package useragent
+
+import (
+	"fmt"
+	"strings"
+	"test2auth/domain"
+
+	"github.com/mssola/useragent"
+)
+
+// Strictness controls how closely the user agent of a refresh must match the
+// one the session was created with.
+type Strictness string
+
+const (
+	// MatchExact requires the very same user agent string.
+	MatchExact Strictness = "exact"
+	// MatchFamilyOS tolerates browser and OS version updates.
+	MatchFamilyOS Strictness = "family_os"
+	// MatchOff never reports a change.
+	MatchOff Strictness = "off"
+)
+
+func ParseStrictness(s string) (Strictness, error) {
+	switch strictness := Strictness(strings.ToLower(strings.TrimSpace(s))); strictness {
+	case MatchExact, MatchFamilyOS, MatchOff:
+		return strictness, nil
+	default:
+		return "", fmt.Errorf("unknown user agent match %q", s)
+	}
+}
+
+// Matches reports whether the user agent of a request is the same client as
+// the stored one under the given strictness.
+func (m Strictness) Matches(storedUA, ua string) bool {
+	switch m {
+	case MatchOff:
+		return true
+	case MatchFamilyOS:
+		stored, current := Parse(storedUA), Parse(ua)
+		return stored.BrowserFamily == current.BrowserFamily && stored.OS == current.OS
+	default:
+		return storedUA == ua
+	}
+}
+
+func Parse(s string) domain.Device {
+	ua := useragent.New(s)
+	browser, version := ua.Browser()
+
+	return domain.Device{
+		BrowserFamily: browser,
+		BrowserMajor:  majorVersion(version),
+		OS:            osName(ua),
+		DeviceType:    deviceType(ua, s),
+	}
+}
+
+func majorVersion(version string) string {
+	major, _, _ := strings.Cut(version, ".")
+	return major
+}
+
+// osName drops the OS version, which changes with every system update.
+func osName(ua *useragent.UserAgent) string {
+	switch ua.Model() {
+	case "iPhone", "iPad", "iPod", "iPod touch":
+		return "iOS"
+	}
+	return ua.OSInfo().Name
+}
+
+func deviceType(ua *useragent.UserAgent, s string) string {
+	switch {
+	case ua.Bot():
+		return domain.DeviceBot
+	case ua.Model() == "iPad" || strings.Contains(s, "Tablet"):
+		return domain.DeviceTablet
+	// Android tablets are Android user agents without the "Mobile" token.
+	case ua.OSInfo().Name == "Android" && !strings.Contains(s, "Mobile"):
+		return domain.DeviceTablet
+	case ua.Mobile():
+		return domain.DeviceMobile
+	case ua.OS() == "":
+		return domain.DeviceUnknown
+	default:
+		return domain.DeviceDesktop
+	}
+}
@@ -0,0 +1,70 @@
+package useragent
+
+import (
+	"testing"
+
+	"test2auth/domain"
+)
+
+const (
+	chromeLinux126 = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36"
+	chromeLinux127 = "Mozilla/5.0 (X11; Linux x86_64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/127.0.6533.72 Safari/537.36"
+	firefoxLinux   = "Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0"
+	chromeWindows  = "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/126.0.0.0 Safari/537.36"
+	safariIPhone   = "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1"
+	safariIPad     = "Mozilla/5.0 (iPad; CPU OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1"
+	googlebot      = "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)"
+)
+
+func TestParse(t *testing.T) {
+	tests := []struct {
+		ua   string
+		want domain.Device
+	}{
+		{chromeLinux126, domain.Device{BrowserFamily: "Chrome", BrowserMajor: "126", OS: "Linux", DeviceType: domain.DeviceDesktop}},
+		{safariIPhone, domain.Device{BrowserFamily: "Safari", BrowserMajor: "17", OS: "iOS", DeviceType: domain.DeviceMobile}},
+		{safariIPad, domain.Device{BrowserFamily: "Safari", BrowserMajor: "17", OS: "iOS", DeviceType: domain.DeviceTablet}},
+		{googlebot, domain.Device{BrowserFamily: "Googlebot", BrowserMajor: "2", DeviceType: domain.DeviceBot}},
+	}
+
+	for _, tt := range tests {
+		if got := Parse(tt.ua); got != tt.want {
+			t.Errorf("Parse(%q) = %+v, want %+v", tt.ua, got, tt.want)
+		}
+	}
+}
+
+func TestMatches(t *testing.T) {
+	tests := []struct {
+		name       string
+		strictness Strictness
+		stored, ua string
+		want       bool
+	}{
+		{"exact same", MatchExact, chromeLinux126, chromeLinux126, true},
+		{"exact version update", MatchExact, chromeLinux126, chromeLinux127, false},
+		{"family version update", MatchFamilyOS, chromeLinux126, chromeLinux127, true},
+		{"family other browser", MatchFamilyOS, chromeLinux126, firefoxLinux, false},
+		{"family other OS", MatchFamilyOS, chromeLinux126, chromeWindows, false},
+		{"off", MatchOff, chromeLinux126, googlebot, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.strictness.Matches(tt.stored, tt.ua); got != tt.want {
+				t.Errorf("Matches = %t, want %t", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestParseStrictness(t *testing.T) {
+	for in, want := range map[string]Strictness{"exact": MatchExact, " Family_OS ": MatchFamilyOS, "off": MatchOff} {
+		if got, err := ParseStrictness(in); err != nil || got != want {
+			t.Errorf("ParseStrictness(%q) = %q, %v, want %q", in, got, err, want)
+		}
+	}
+	if _, err := ParseStrictness("loose"); err == nil {
+		t.Error("ParseStrictness(\"loose\") succeeded, want an error")
+	}
+}
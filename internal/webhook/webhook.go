@@ -0,0 +1,266 @@
+// Package webhook posts security notifications to the configured URL. They
+// are queued and delivered in the background, so a slow receiver never holds
+// up a request. With a store every delivery is logged and failed ones can be
+// replayed.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"sync"
+	"time"
+
+	"test2auth/domain"
+	"test2auth/internal/tracing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.26.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.Tracer("test2auth/internal/webhook")
+
+type Store interface {
+	SaveWebhookDelivery(ctx context.Context, delivery domain.WebhookDelivery) (int64, error)
+	UpdateWebhookDelivery(ctx context.Context, delivery domain.WebhookDelivery) error
+	GetWebhookDelivery(ctx context.Context, id int64) (domain.WebhookDelivery, error)
+	// ListWebhookDeliveries returns the newest deliveries first, only failed
+	// ones if failedOnly is set.
+	ListWebhookDeliveries(ctx context.Context, failedOnly bool, limit int) ([]domain.WebhookDelivery, error)
+}
+
+// Purger is implemented by stores that can drop old delivery logs.
+type Purger interface {
+	// DeleteWebhookDeliveries deletes at most limit deliveries created before
+	// before and returns how many it deleted.
+	DeleteWebhookDeliveries(ctx context.Context, before time.Time, limit int) (int64, error)
+}
+
+const (
+	DefaultTimeout   = 5 * time.Second
+	DefaultQueueSize = 1000
+)
+
+// ErrQueueFull is returned by Enqueue when the receiver cannot keep up.
+var ErrQueueFull = errors.New("webhook queue is full")
+
+type job struct {
+	ctx     context.Context
+	payload []byte
+	done    func(error)
+}
+
+type Sender struct {
+	url    string
+	client *http.Client
+	store  Store
+	log    *slog.Logger
+
+	// mu guards closed, so that Enqueue never sends on a closed queue.
+	mu      sync.RWMutex
+	closed  bool
+	queue   chan job
+	stopped chan struct{}
+}
+
+type Option func(*Sender)
+
+// WithStore logs every delivery to store.
+func WithStore(store Store) Option {
+	return func(s *Sender) {
+		s.store = store
+	}
+}
+
+func WithClient(client *http.Client) Option {
+	return func(s *Sender) {
+		s.client = client
+	}
+}
+
+// WithTimeout bounds each delivery, DefaultTimeout by default.
+func WithTimeout(timeout time.Duration) Option {
+	return func(s *Sender) {
+		s.client = &http.Client{Timeout: timeout}
+	}
+}
+
+// WithQueueSize bounds the payloads waiting for delivery, DefaultQueueSize by
+// default.
+func WithQueueSize(size int) Option {
+	return func(s *Sender) {
+		s.queue = make(chan job, size)
+	}
+}
+
+// NewSender starts the delivery worker, stop it with Close.
+func NewSender(url string, log *slog.Logger, opts ...Option) *Sender {
+	s := &Sender{
+		url:     url,
+		client:  &http.Client{Timeout: DefaultTimeout},
+		log:     log,
+		queue:   make(chan job, DefaultQueueSize),
+		stopped: make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(s)
+	}
+
+	go s.run()
+
+	return s
+}
+
+// Enqueue queues payload and returns without waiting for the delivery. done,
+// if not nil, is called with the result of Send once it is delivered. When
+// the queue is full or the sender is closed the payload is dropped.
+func (s *Sender) Enqueue(ctx context.Context, payload []byte, done func(error)) error {
+	const op = "webhook.Sender.Enqueue"
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if s.closed {
+		return fmt.Errorf("%s: sender is closed", op)
+	}
+
+	select {
+	case s.queue <- job{ctx: ctx, payload: payload, done: done}:
+		return nil
+	default:
+		return fmt.Errorf("%s: %w", op, ErrQueueFull)
+	}
+}
+
+// Close stops taking payloads and waits until the queued ones are delivered
+// or ctx is done.
+func (s *Sender) Close(ctx context.Context) error {
+	s.mu.Lock()
+	if !s.closed {
+		s.closed = true
+		close(s.queue)
+	}
+	s.mu.Unlock()
+
+	select {
+	case <-s.stopped:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("webhook.Sender.Close: %d payloads not delivered: %w", len(s.queue), ctx.Err())
+	}
+}
+
+func (s *Sender) run() {
+	defer close(s.stopped)
+
+	for j := range s.queue {
+		err := s.Send(j.ctx, j.payload)
+		if j.done != nil {
+			j.done(err)
+		}
+	}
+}
+
+// Send posts payload right away and logs the outcome. Failures are logged as
+// well, the returned error only tells the caller that the delivery failed.
+func (s *Sender) Send(ctx context.Context, payload []byte) error {
+	const op = "webhook.Sender.Send"
+
+	now := time.Now().UTC()
+	delivery := domain.WebhookDelivery{
+		URL:       s.url,
+		Payload:   payload,
+		Attempts:  1,
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	s.deliver(ctx, &delivery)
+
+	if s.store != nil {
+		if _, err := s.store.SaveWebhookDelivery(ctx, delivery); err != nil {
+			s.log.Error("failed to save webhook delivery", slog.String("op", op), "error", err)
+		}
+	}
+
+	if delivery.Status != domain.WebhookDelivered {
+		return fmt.Errorf("%s: %s", op, delivery.LastError)
+	}
+	return nil
+}
+
+// Replay posts a logged payload again, to the current URL, and records the
+// new outcome.
+func (s *Sender) Replay(ctx context.Context, id int64) (domain.WebhookDelivery, error) {
+	const op = "webhook.Sender.Replay"
+
+	if s.store == nil {
+		return domain.WebhookDelivery{}, fmt.Errorf("%s: no delivery store", op)
+	}
+
+	delivery, err := s.store.GetWebhookDelivery(ctx, id)
+	if err != nil {
+		return domain.WebhookDelivery{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	delivery.URL = s.url
+	delivery.Attempts++
+	delivery.UpdatedAt = time.Now().UTC()
+	s.deliver(ctx, &delivery)
+
+	if err := s.store.UpdateWebhookDelivery(ctx, delivery); err != nil {
+		return domain.WebhookDelivery{}, fmt.Errorf("%s: %w", op, err)
+	}
+
+	return delivery, nil
+}
+
+// deliver posts the payload and sets the status and error of delivery. The
+// request carries the trace context of ctx, so receivers can join the trace.
+func (s *Sender) deliver(ctx context.Context, delivery *domain.WebhookDelivery) {
+	const op = "webhook.Sender.deliver"
+
+	ctx, span := tracer.Start(ctx, op, trace.WithSpanKind(trace.SpanKindClient), trace.WithAttributes(
+		semconv.HTTPRequestMethodKey.String(http.MethodPost),
+		attribute.Int("webhook.attempt", delivery.Attempts),
+	))
+	defer span.End()
+
+	delivery.Status = domain.WebhookFailed
+	delivery.LastError = ""
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, delivery.URL, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		delivery.LastError = err.Error()
+		tracing.RecordError(span, err)
+		s.log.Error("failed to send webhook", slog.String("op", op), "error", err)
+		return
+	}
+	req.Header.Set("Content-Type", "application/json")
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		delivery.LastError = err.Error()
+		tracing.RecordError(span, err)
+		s.log.Error("failed to send webhook", slog.String("op", op), "error", err)
+		return
+	}
+	defer resp.Body.Close()
+	span.SetAttributes(semconv.HTTPResponseStatusCode(resp.StatusCode))
+
+	if resp.StatusCode != http.StatusOK {
+		delivery.LastError = resp.Status
+		tracing.RecordError(span, fmt.Errorf("webhook returned %s", resp.Status))
+		s.log.Error("webhook returned non-200 status", slog.String("op", op), "status", resp.Status)
+		return
+	}
+
+	delivery.Status = domain.WebhookDelivered
+}
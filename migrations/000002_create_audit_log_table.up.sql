@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS audit_log
+(
+    id         BIGSERIAL PRIMARY KEY,
+    event      TEXT        NOT NULL,
+    user_id    uuid        NOT NULL,
+    ip         TEXT        NOT NULL,
+    details    JSONB       NOT NULL DEFAULT '{}',
+    created_at TIMESTAMPTZ NOT NULL,
+    prev_hash  TEXT        NOT NULL,
+    hash       TEXT        NOT NULL
+);
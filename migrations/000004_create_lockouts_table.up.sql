@@ -0,0 +1,9 @@
+CREATE TABLE IF NOT EXISTS lockouts
+(
+    key             TEXT PRIMARY KEY,
+    failures        INTEGER     NOT NULL,
+    last_failure_at TIMESTAMPTZ NOT NULL,
+    locked_until    TIMESTAMPTZ
+);
+
+CREATE INDEX IF NOT EXISTS lockouts_last_failure_at_idx ON lockouts (last_failure_at);
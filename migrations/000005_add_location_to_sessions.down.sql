@@ -0,0 +1,7 @@
+ALTER TABLE sessions
+    DROP COLUMN IF EXISTS country,
+    DROP COLUMN IF EXISTS city,
+    DROP COLUMN IF EXISTS latitude,
+    DROP COLUMN IF EXISTS longitude,
+    DROP COLUMN IF EXISTS asn,
+    DROP COLUMN IF EXISTS as_org;
@@ -0,0 +1,7 @@
+ALTER TABLE sessions
+    ADD COLUMN IF NOT EXISTS country   TEXT             NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS city      TEXT             NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS latitude  DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS longitude DOUBLE PRECISION NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS asn       BIGINT           NOT NULL DEFAULT 0,
+    ADD COLUMN IF NOT EXISTS as_org    TEXT             NOT NULL DEFAULT '';
@@ -0,0 +1,5 @@
+ALTER TABLE sessions
+    DROP COLUMN IF EXISTS browser_family,
+    DROP COLUMN IF EXISTS browser_major,
+    DROP COLUMN IF EXISTS os,
+    DROP COLUMN IF EXISTS device_type;
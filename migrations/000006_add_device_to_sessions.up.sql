@@ -0,0 +1,5 @@
+ALTER TABLE sessions
+    ADD COLUMN IF NOT EXISTS browser_family TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS browser_major  TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS os             TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS device_type    TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,4 @@
+ALTER TABLE sessions
+    ADD COLUMN IF NOT EXISTS last_used_at TIMESTAMP NOT NULL DEFAULT NOW();
+
+UPDATE sessions SET last_used_at = created_at;
@@ -0,0 +1,2 @@
+-- Ports stripped by the up migration cannot be restored.
+SELECT 1;
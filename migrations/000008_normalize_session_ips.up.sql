@@ -0,0 +1,13 @@
+-- Client addresses used to be stored as "host:port". Strip the port so the
+-- column always holds a plain address that can be cast to inet.
+UPDATE sessions
+SET ip = regexp_replace(ip, '^(\d+\.\d+\.\d+\.\d+):\d+$', '\1')
+WHERE ip ~ '^\d+\.\d+\.\d+\.\d+:\d+$';
+
+UPDATE sessions
+SET ip = regexp_replace(ip, '^\[([0-9A-Fa-f:.]+)\]:\d+$', '\1')
+WHERE ip ~ '^\[[0-9A-Fa-f:.]+\]:\d+$';
+
+UPDATE sessions
+SET ip = ''
+WHERE ip <> '' AND ip !~ '^(\d+\.\d+\.\d+\.\d+|[0-9A-Fa-f:.]+)$';
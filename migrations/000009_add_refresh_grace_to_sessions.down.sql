@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS sessions_grace_until_idx;
+
+ALTER TABLE sessions
+    DROP COLUMN IF EXISTS prev_refresh_token,
+    DROP COLUMN IF EXISTS rotated_at,
+    DROP COLUMN IF EXISTS grace_tokens,
+    DROP COLUMN IF EXISTS grace_until;
@@ -0,0 +1,8 @@
+ALTER TABLE sessions
+    ADD COLUMN IF NOT EXISTS prev_refresh_token TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS rotated_at TIMESTAMP,
+    ADD COLUMN IF NOT EXISTS grace_tokens TEXT NOT NULL DEFAULT '',
+    ADD COLUMN IF NOT EXISTS grace_until TIMESTAMP;
+
+CREATE INDEX IF NOT EXISTS sessions_grace_until_idx ON sessions (grace_until)
+    WHERE grace_tokens <> '';
@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS sessions_prev_refresh_token_idx;
+DROP INDEX IF EXISTS sessions_refresh_token_idx;
@@ -0,0 +1,7 @@
+-- Refresh tokens are now stored as a keyed SHA-256 instead of bcrypt and
+-- sessions are looked up by it. Sessions with a bcrypt hash cannot be found
+-- anymore and expire on their own; their users have to log in again.
+CREATE UNIQUE INDEX IF NOT EXISTS sessions_refresh_token_idx ON sessions (refresh_token);
+
+CREATE INDEX IF NOT EXISTS sessions_prev_refresh_token_idx ON sessions (prev_refresh_token)
+    WHERE prev_refresh_token <> '';
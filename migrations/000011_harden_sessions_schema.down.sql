@@ -0,0 +1,16 @@
+DROP INDEX IF EXISTS sessions_expires_at_idx;
+DROP INDEX IF EXISTS sessions_user_id_idx;
+
+ALTER TABLE sessions
+    ALTER COLUMN expires_at TYPE TIMESTAMP,
+    ALTER COLUMN created_at TYPE TIMESTAMP,
+    ALTER COLUMN last_used_at TYPE TIMESTAMP,
+    ALTER COLUMN rotated_at TYPE TIMESTAMP,
+    ALTER COLUMN grace_until TYPE TIMESTAMP;
+
+-- Sessions are numbered again in no particular order.
+ALTER TABLE sessions DROP CONSTRAINT sessions_pkey;
+ALTER TABLE sessions RENAME COLUMN id TO uid;
+ALTER TABLE sessions ADD COLUMN id SERIAL;
+ALTER TABLE sessions DROP COLUMN uid;
+ALTER TABLE sessions ADD CONSTRAINT sessions_pkey PRIMARY KEY (id);
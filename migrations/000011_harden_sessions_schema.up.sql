@@ -0,0 +1,22 @@
+-- Session IDs become random UUIDs instead of a guessable sequence. Existing
+-- sessions get a fresh ID; access tokens carrying an old numeric ID are
+-- rejected and have to be refreshed.
+ALTER TABLE sessions ADD COLUMN uid uuid NOT NULL DEFAULT gen_random_uuid();
+ALTER TABLE sessions DROP CONSTRAINT sessions_pkey;
+ALTER TABLE sessions DROP COLUMN id;
+ALTER TABLE sessions RENAME COLUMN uid TO id;
+ALTER TABLE sessions ADD CONSTRAINT sessions_pkey PRIMARY KEY (id);
+
+-- The old columns hold wall clock times in the application's time zone. They
+-- are read in the TimeZone of the migrating connection, so run the migration
+-- with the application's zone if it is not the server default, e.g. by
+-- adding options=-c%20TimeZone%3DEurope/Moscow to the URL.
+ALTER TABLE sessions
+    ALTER COLUMN expires_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN created_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN last_used_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN rotated_at TYPE TIMESTAMPTZ,
+    ALTER COLUMN grace_until TYPE TIMESTAMPTZ;
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
+CREATE INDEX IF NOT EXISTS sessions_expires_at_idx ON sessions (expires_at);
@@ -0,0 +1,8 @@
+CREATE TABLE IF NOT EXISTS signing_keys
+(
+    id            TEXT PRIMARY KEY,
+    sealed_secret TEXT        NOT NULL,
+    created_at    TIMESTAMPTZ NOT NULL,
+    activate_at   TIMESTAMPTZ NOT NULL,
+    retired_at    TIMESTAMPTZ
+);
@@ -0,0 +1,16 @@
+CREATE TABLE IF NOT EXISTS webhook_deliveries
+(
+    id         BIGSERIAL PRIMARY KEY,
+    url        TEXT        NOT NULL,
+    payload    JSONB       NOT NULL,
+    status     TEXT        NOT NULL,
+    attempts   INTEGER     NOT NULL,
+    last_error TEXT        NOT NULL DEFAULT '',
+    created_at TIMESTAMPTZ NOT NULL,
+    updated_at TIMESTAMPTZ NOT NULL
+);
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_failed_idx ON webhook_deliveries (id)
+    WHERE status = 'failed';
+
+CREATE INDEX IF NOT EXISTS webhook_deliveries_created_at_idx ON webhook_deliveries (created_at);
@@ -0,0 +1,8 @@
+// Package migrations embeds the SQL migrations into the binary: the Postgres
+// set at the top level and the SQLite set in sqlite/.
+package migrations
+
+import "embed"
+
+//go:embed *.sql sqlite/*.sql
+var FS embed.FS
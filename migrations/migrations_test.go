@@ -0,0 +1,277 @@
+package migrations_test
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/url"
+	"os"
+	"slices"
+	"testing"
+	"time"
+
+	"test2auth/migrations"
+
+	"github.com/golang-migrate/migrate/v4"
+	_ "github.com/golang-migrate/migrate/v4/database/postgres"
+	"github.com/golang-migrate/migrate/v4/source/iofs"
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// schemaVersion is the last version before sessions got UUID IDs and
+// timestamptz columns.
+const schemaVersion = 10
+
+type seededSession struct {
+	userID       uuid.UUID
+	refreshToken string
+	ip           string
+	expiresAt    time.Time
+}
+
+var seededSessions = []seededSession{
+	{
+		userID:       uuid.MustParse("6f1c0f6e-2f55-4a35-9a40-1b7c0d1f0a01"),
+		refreshToken: "token-1",
+		ip:           "203.0.113.7",
+		expiresAt:    time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC),
+	},
+	{
+		userID:       uuid.MustParse("6f1c0f6e-2f55-4a35-9a40-1b7c0d1f0a02"),
+		refreshToken: "token-2",
+		ip:           "2001:db8::1",
+		expiresAt:    time.Date(2030, 6, 7, 8, 9, 10, 0, time.UTC),
+	},
+}
+
+// TestPostgresMigrations seeds sessions in the schema of version 10, migrates
+// to the latest version and back and checks that the sessions survive both
+// ways. It runs against the database in TEST_POSTGRES_DSN, in a schema of its
+// own that is dropped afterwards.
+func TestPostgresMigrations(t *testing.T) {
+	dsn := os.Getenv("TEST_POSTGRES_DSN")
+	if dsn == "" {
+		t.Skip("TEST_POSTGRES_DSN is not set")
+	}
+	ctx := context.Background()
+
+	schemaURL := newSchema(t, dsn)
+	m := newMigrate(t, schemaURL)
+
+	pool, err := pgxpool.New(ctx, schemaURL)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	t.Cleanup(pool.Close)
+
+	if err := m.Migrate(schemaVersion); err != nil {
+		t.Fatalf("migrate to %d: %v", schemaVersion, err)
+	}
+	for _, s := range seededSessions {
+		_, err := pool.Exec(ctx, `
+			INSERT INTO sessions (user_id, refresh_token, user_agent, ip, expires_at, created_at, last_used_at)
+			VALUES ($1, $2, 'Mozilla/5.0', $3, $4, $4 - INTERVAL '1 hour', $4 - INTERVAL '1 hour')`,
+			s.userID, s.refreshToken, s.ip, s.expiresAt.Format(time.DateTime))
+		if err != nil {
+			t.Fatalf("seed session: %v", err)
+		}
+	}
+
+	if err := m.Up(); err != nil {
+		t.Fatalf("migrate up: %v", err)
+	}
+
+	wantColumnType(t, pool, "sessions", "id", "uuid")
+	for _, column := range []string{"expires_at", "created_at", "last_used_at", "rotated_at", "grace_until"} {
+		wantColumnType(t, pool, "sessions", column, "timestamp with time zone")
+	}
+	wantIndexes(t, pool, "sessions",
+		"sessions_pkey",
+		"sessions_refresh_token_idx",
+		"sessions_prev_refresh_token_idx",
+		"sessions_user_id_idx",
+		"sessions_expires_at_idx",
+		"sessions_grace_until_idx",
+	)
+	wantIndexes(t, pool, "rate_limits", "rate_limits_full_at_idx")
+	wantIndexes(t, pool, "lockouts", "lockouts_last_failure_at_idx")
+	wantIndexes(t, pool, "webhook_deliveries", "webhook_deliveries_failed_idx", "webhook_deliveries_created_at_idx")
+	wantSessions(t, pool)
+
+	var ids []uuid.UUID
+	rows, err := pool.Query(ctx, `SELECT id FROM sessions`)
+	if err != nil {
+		t.Fatalf("select ids: %v", err)
+	}
+	for rows.Next() {
+		var id uuid.UUID
+		if err := rows.Scan(&id); err != nil {
+			t.Fatalf("scan id: %v", err)
+		}
+		ids = append(ids, id)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("select ids: %v", err)
+	}
+	if len(ids) != len(seededSessions) || ids[0] == ids[1] {
+		t.Errorf("session IDs = %v, want %d distinct UUIDs", ids, len(seededSessions))
+	}
+
+	if err := m.Migrate(schemaVersion); err != nil {
+		t.Fatalf("migrate down to %d: %v", schemaVersion, err)
+	}
+
+	wantColumnType(t, pool, "sessions", "id", "integer")
+	for _, column := range []string{"expires_at", "created_at", "last_used_at", "rotated_at", "grace_until"} {
+		wantColumnType(t, pool, "sessions", column, "timestamp without time zone")
+	}
+	wantSessions(t, pool)
+}
+
+// newSchema creates a schema for the test and returns dsn with it as the
+// search path. Times are read in UTC.
+func newSchema(t *testing.T, dsn string) string {
+	t.Helper()
+	ctx := context.Background()
+
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		t.Fatal(err)
+	}
+	schema := "migrations_test_" + hex.EncodeToString(b)
+
+	pool, err := pgxpool.New(ctx, dsn)
+	if err != nil {
+		t.Fatalf("connect: %v", err)
+	}
+	defer pool.Close()
+
+	if _, err := pool.Exec(ctx, `CREATE SCHEMA `+schema); err != nil {
+		t.Fatalf("create schema: %v", err)
+	}
+	t.Cleanup(func() {
+		pool, err := pgxpool.New(ctx, dsn)
+		if err != nil {
+			t.Errorf("connect: %v", err)
+			return
+		}
+		defer pool.Close()
+
+		if _, err := pool.Exec(ctx, `DROP SCHEMA `+schema+` CASCADE`); err != nil {
+			t.Errorf("drop schema: %v", err)
+		}
+	})
+
+	u, err := url.Parse(dsn)
+	if err != nil {
+		t.Fatalf("parse TEST_POSTGRES_DSN: %v", err)
+	}
+	q := u.Query()
+	q.Set("search_path", schema)
+	q.Set("timezone", "UTC")
+	u.RawQuery = q.Encode()
+	return u.String()
+}
+
+func newMigrate(t *testing.T, databaseURL string) *migrate.Migrate {
+	t.Helper()
+
+	source, err := iofs.New(migrations.FS, ".")
+	if err != nil {
+		t.Fatalf("migrations: %v", err)
+	}
+
+	m, err := migrate.NewWithSourceInstance("iofs", source, databaseURL)
+	if err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	t.Cleanup(func() { m.Close() })
+
+	return m
+}
+
+func wantColumnType(t *testing.T, pool *pgxpool.Pool, table, column, want string) {
+	t.Helper()
+
+	var got string
+	err := pool.QueryRow(context.Background(), `
+		SELECT data_type FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = $1 AND column_name = $2`,
+		table, column).Scan(&got)
+	if err != nil {
+		t.Fatalf("type of %s.%s: %v", table, column, err)
+	}
+	if got != want {
+		t.Errorf("type of %s.%s = %q, want %q", table, column, got, want)
+	}
+}
+
+func wantIndexes(t *testing.T, pool *pgxpool.Pool, table string, want ...string) {
+	t.Helper()
+
+	rows, err := pool.Query(context.Background(), `
+		SELECT indexname FROM pg_indexes
+		WHERE schemaname = current_schema() AND tablename = $1`, table)
+	if err != nil {
+		t.Fatalf("indexes of %s: %v", table, err)
+	}
+	defer rows.Close()
+
+	var got []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatalf("indexes of %s: %v", table, err)
+		}
+		got = append(got, name)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("indexes of %s: %v", table, err)
+	}
+
+	for _, name := range want {
+		if !slices.Contains(got, name) {
+			t.Errorf("indexes of %s = %v, want %s", table, got, name)
+		}
+	}
+}
+
+// wantSessions checks that the seeded sessions are still there with their
+// data, whatever type the time columns have.
+func wantSessions(t *testing.T, pool *pgxpool.Pool) {
+	t.Helper()
+
+	rows, err := pool.Query(context.Background(), `
+		SELECT user_id, refresh_token, ip, to_char(expires_at, 'YYYY-MM-DD HH24:MI:SS')
+		FROM sessions ORDER BY refresh_token`)
+	if err != nil {
+		t.Fatalf("select sessions: %v", err)
+	}
+	defer rows.Close()
+
+	var got []seededSession
+	for rows.Next() {
+		var (
+			s         seededSession
+			expiresAt string
+		)
+		if err := rows.Scan(&s.userID, &s.refreshToken, &s.ip, &expiresAt); err != nil {
+			t.Fatalf("scan session: %v", err)
+		}
+		s.expiresAt, err = time.Parse(time.DateTime, expiresAt)
+		if err != nil {
+			t.Fatalf("parse expires_at: %v", err)
+		}
+		got = append(got, s)
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("select sessions: %v", err)
+	}
+
+	if !slices.EqualFunc(got, seededSessions, func(a, b seededSession) bool {
+		return a.userID == b.userID && a.refreshToken == b.refreshToken && a.ip == b.ip && a.expiresAt.Equal(b.expiresAt)
+	}) {
+		t.Errorf("sessions = %+v, want %+v", got, seededSessions)
+	}
+}
@@ -0,0 +1,36 @@
+-- Times are stored as Unix microseconds, like the precision Postgres keeps.
+CREATE TABLE IF NOT EXISTS sessions
+(
+    id                 INTEGER PRIMARY KEY AUTOINCREMENT,
+    user_id            TEXT    NOT NULL,
+    refresh_token      TEXT    NOT NULL,
+    user_agent         TEXT    NOT NULL,
+    ip                 TEXT    NOT NULL,
+    expires_at         INTEGER NOT NULL,
+    created_at         INTEGER NOT NULL,
+    last_used_at       INTEGER NOT NULL,
+    country            TEXT    NOT NULL DEFAULT '',
+    city               TEXT    NOT NULL DEFAULT '',
+    latitude           REAL    NOT NULL DEFAULT 0,
+    longitude          REAL    NOT NULL DEFAULT 0,
+    asn                INTEGER NOT NULL DEFAULT 0,
+    as_org             TEXT    NOT NULL DEFAULT '',
+    browser_family     TEXT    NOT NULL DEFAULT '',
+    browser_major      TEXT    NOT NULL DEFAULT '',
+    os                 TEXT    NOT NULL DEFAULT '',
+    device_type        TEXT    NOT NULL DEFAULT '',
+    prev_refresh_token TEXT    NOT NULL DEFAULT '',
+    rotated_at         INTEGER NOT NULL DEFAULT 0,
+    grace_tokens       TEXT    NOT NULL DEFAULT '',
+    grace_until        INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS sessions_refresh_token_idx ON sessions (refresh_token);
+
+CREATE INDEX IF NOT EXISTS sessions_prev_refresh_token_idx ON sessions (prev_refresh_token)
+    WHERE prev_refresh_token <> '';
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
+
+CREATE INDEX IF NOT EXISTS sessions_grace_until_idx ON sessions (grace_until)
+    WHERE grace_tokens <> '';
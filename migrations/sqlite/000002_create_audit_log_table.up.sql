@@ -0,0 +1,11 @@
+CREATE TABLE IF NOT EXISTS audit_log
+(
+    id         INTEGER PRIMARY KEY AUTOINCREMENT,
+    event      TEXT    NOT NULL,
+    user_id    TEXT    NOT NULL,
+    ip         TEXT    NOT NULL,
+    details    TEXT    NOT NULL DEFAULT '{}',
+    created_at INTEGER NOT NULL,
+    prev_hash  TEXT    NOT NULL,
+    hash       TEXT    NOT NULL
+);
@@ -0,0 +1,54 @@
+-- SQLite cannot change a primary key in place, so the table is rebuilt with
+-- random UUIDs (version 4) for the existing sessions.
+CREATE TABLE sessions_new
+(
+    id                 TEXT    PRIMARY KEY,
+    user_id            TEXT    NOT NULL,
+    refresh_token      TEXT    NOT NULL,
+    user_agent         TEXT    NOT NULL,
+    ip                 TEXT    NOT NULL,
+    expires_at         INTEGER NOT NULL,
+    created_at         INTEGER NOT NULL,
+    last_used_at       INTEGER NOT NULL,
+    country            TEXT    NOT NULL DEFAULT '',
+    city               TEXT    NOT NULL DEFAULT '',
+    latitude           REAL    NOT NULL DEFAULT 0,
+    longitude          REAL    NOT NULL DEFAULT 0,
+    asn                INTEGER NOT NULL DEFAULT 0,
+    as_org             TEXT    NOT NULL DEFAULT '',
+    browser_family     TEXT    NOT NULL DEFAULT '',
+    browser_major      TEXT    NOT NULL DEFAULT '',
+    os                 TEXT    NOT NULL DEFAULT '',
+    device_type        TEXT    NOT NULL DEFAULT '',
+    prev_refresh_token TEXT    NOT NULL DEFAULT '',
+    rotated_at         INTEGER NOT NULL DEFAULT 0,
+    grace_tokens       TEXT    NOT NULL DEFAULT '',
+    grace_until        INTEGER NOT NULL DEFAULT 0
+);
+
+INSERT INTO sessions_new (id, user_id, refresh_token, user_agent, ip, expires_at, created_at, last_used_at,
+       country, city, latitude, longitude, asn, as_org,
+       browser_family, browser_major, os, device_type,
+       prev_refresh_token, rotated_at, grace_tokens, grace_until)
+SELECT lower(hex(randomblob(4)) || '-' || hex(randomblob(2)) || '-4' || substr(hex(randomblob(2)), 2) || '-' ||
+             substr('89ab', 1 + abs(random()) % 4, 1) || substr(hex(randomblob(2)), 2) || '-' || hex(randomblob(6))),
+       user_id, refresh_token, user_agent, ip, expires_at, created_at, last_used_at,
+       country, city, latitude, longitude, asn, as_org,
+       browser_family, browser_major, os, device_type,
+       prev_refresh_token, rotated_at, grace_tokens, grace_until
+FROM sessions;
+
+DROP TABLE sessions;
+ALTER TABLE sessions_new RENAME TO sessions;
+
+CREATE UNIQUE INDEX IF NOT EXISTS sessions_refresh_token_idx ON sessions (refresh_token);
+
+CREATE INDEX IF NOT EXISTS sessions_prev_refresh_token_idx ON sessions (prev_refresh_token)
+    WHERE prev_refresh_token <> '';
+
+CREATE INDEX IF NOT EXISTS sessions_user_id_idx ON sessions (user_id);
+
+CREATE INDEX IF NOT EXISTS sessions_grace_until_idx ON sessions (grace_until)
+    WHERE grace_tokens <> '';
+
+CREATE INDEX IF NOT EXISTS sessions_expires_at_idx ON sessions (expires_at);